@@ -0,0 +1,166 @@
+// Package keys loads PEM private keys for request signing from a file, an
+// environment variable or Secret Manager.
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"secretmanager/secrets"
+)
+
+var (
+	// ErrNoPEM is returned when the input holds no PEM block
+	ErrNoPEM = errors.New("keys: no PEM data found")
+	// ErrPassphraseRequired is returned for an encrypted key without a passphrase
+	ErrPassphraseRequired = errors.New("keys: key is encrypted and no passphrase was given")
+	// ErrUnsupportedKey is returned for keys that are not RSA or ECDSA
+	ErrUnsupportedKey = errors.New("keys: unsupported key type")
+)
+
+// ParsePrivateKey parses a PEM RSA or ECDSA private key in PKCS#1, SEC 1 or
+// PKCS#8 form. Encrypted keys, either legacy "Proc-Type: 4,ENCRYPTED" PEM
+// or PKCS#8 "ENCRYPTED PRIVATE KEY", are decrypted with passphrase.
+func ParsePrivateKey(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoPEM
+	}
+
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, fmt.Errorf("keys: decrypt %s: %w", block.Type, err)
+		}
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("keys: parse PKCS#1 key: %w", err)
+		}
+		return key, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("keys: parse EC key: %w", err)
+		}
+		return key, nil
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+		return parsePKCS8(der)
+	case "PRIVATE KEY":
+		return parsePKCS8(der)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+}
+
+func parsePKCS8(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("keys: parse PKCS#8 key: %w", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+// FromFile loads a key from a PEM file
+func FromFile(path string, passphrase []byte) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// FromEnv loads a key from the PEM text in environment variable name
+func FromEnv(name string, passphrase []byte) (crypto.Signer, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("keys: $%s is not set", name)
+	}
+	key, err := ParsePrivateKey([]byte(value), passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("$%s: %w", name, err)
+	}
+	return key, nil
+}
+
+// FromSecretManager loads a key stored as PEM text in a Secret Manager
+// secret version
+func FromSecretManager(projectID, secretID, version string, passphrase []byte) (crypto.Signer, error) {
+	value, err := secrets.GetSecret(projectID, secretID, version)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey([]byte(value), passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", secretID, err)
+	}
+	return key, nil
+}
+
+// Load loads a key from source, one of
+//
+//	file:<path>
+//	env:<NAME>
+//	projects/<p>/secrets/<s>[/versions/<v>]
+//
+// A source without a prefix is a file path.
+func Load(source string, passphrase []byte) (crypto.Signer, error) {
+	switch {
+	case strings.HasPrefix(source, "env:"):
+		return FromEnv(strings.TrimPrefix(source, "env:"), passphrase)
+	case strings.HasPrefix(source, "projects/"):
+		project, secret, version, err := ParseSecretName(source)
+		if err != nil {
+			return nil, err
+		}
+		return FromSecretManager(project, secret, version, passphrase)
+	default:
+		return FromFile(strings.TrimPrefix(source, "file:"), passphrase)
+	}
+}
+
+// ParseSecretName splits projects/<p>/secrets/<s>[/versions/<v>]; the
+// version defaults to latest
+func ParseSecretName(name string) (project, secret, version string, err error) {
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets":
+		return parts[1], parts[3], "latest", nil
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions":
+		return parts[1], parts[3], parts[5], nil
+	default:
+		return "", "", "", fmt.Errorf("invalid secret name %q: want projects/<p>/secrets/<s>[/versions/<v>]", name)
+	}
+}
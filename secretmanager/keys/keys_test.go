@@ -0,0 +1,118 @@
+package keys_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"secretmanager/keys"
+)
+
+var passphrase = []byte("correct-horse")
+
+func encode(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func TestParsePrivateKeyForms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaPKCS8, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	ecSEC1, _ := x509.MarshalECPrivateKey(ecKey)
+	ecPKCS8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	legacy, _ := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), passphrase, x509.PEMCipherAES256)
+
+	for name, tc := range map[string]struct {
+		pem  []byte
+		want crypto.PublicKey
+	}{
+		"PKCS#1":        {encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), &rsaKey.PublicKey},
+		"PKCS#8 RSA":    {encode("PRIVATE KEY", rsaPKCS8), &rsaKey.PublicKey},
+		"SEC 1":         {encode("EC PRIVATE KEY", ecSEC1), &ecKey.PublicKey},
+		"PKCS#8 ECDSA":  {encode("PRIVATE KEY", ecPKCS8), &ecKey.PublicKey},
+		"legacy PKCS#1": {pem.EncodeToMemory(legacy), &rsaKey.PublicKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := keys.ParsePrivateKey(tc.pem, passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(tc.want) {
+				t.Fatalf("parsed the wrong key")
+			}
+		})
+	}
+}
+
+func TestParseEncryptedPKCS8(t *testing.T) {
+	// Written by openssl pkcs8 -topk8 -v2 aes-256-cbc / aes-128-cbc
+	for file, want := range map[string]string{
+		"ec_p256_encrypted.pem": "*ecdsa.PrivateKey",
+		"rsa_encrypted.pem":     "*rsa.PrivateKey",
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keys.ParsePrivateKey(data, passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if got := fmt.Sprintf("%T", key); got != want {
+			t.Fatalf("%s: got %s, want %s", file, got, want)
+		}
+
+		if _, err := keys.ParsePrivateKey(data, nil); !errors.Is(err, keys.ErrPassphraseRequired) {
+			t.Fatalf("%s: expected a passphrase to be required, got %v", file, err)
+		}
+		if _, err := keys.ParsePrivateKey(data, []byte("wrong")); err == nil {
+			t.Fatalf("%s: expected the wrong passphrase to fail", file)
+		}
+	}
+}
+
+func TestParsePrivateKeyRejects(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	if _, err := keys.ParsePrivateKey(encode("PRIVATE KEY", edPKCS8), nil); !errors.Is(err, keys.ErrUnsupportedKey) {
+		t.Fatalf("expected ed25519 to be unsupported, got %v", err)
+	}
+	if _, err := keys.ParsePrivateKey([]byte("not a key"), nil); !errors.Is(err, keys.ErrNoPEM) {
+		t.Fatalf("expected no PEM, got %v", err)
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(ecKey)
+	data := encode("EC PRIVATE KEY", der)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(path, data, 0o600)
+	t.Setenv("SIGNING_KEY", string(data))
+
+	for _, source := range []string{path, "file:" + path, "env:SIGNING_KEY"} {
+		key, err := keys.Load(source, nil)
+		if err != nil || !ecKey.Equal(key) {
+			t.Fatalf("%s: %v", source, err)
+		}
+	}
+	if _, err := keys.Load("projects/p/secrets", nil); err == nil {
+		t.Fatalf("expected a malformed secret name to be rejected")
+	}
+
+	project, secret, version, err := keys.ParseSecretName("projects/p/secrets/s")
+	if err != nil || project != "p" || secret != "s" || version != "latest" {
+		t.Fatalf("ParseSecretName = %s %s %s, %v", project, secret, version, err)
+	}
+}
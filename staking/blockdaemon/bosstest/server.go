@@ -0,0 +1,420 @@
+// Package bosstest provides an in-process stand-in for the Blockdaemon BOSS
+// API, routed by network the way the real one is. Requests are checked and
+// errors written from the API reference, not from bossclient, so the client
+// is tested against what BOSS accepts rather than against itself.
+//
+// https://docs.blockdaemon.com/reference/staking-api-overview
+package bosstest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	bossclient "blockdaemon/client"
+)
+
+const customerID = "bosstest-customer"
+
+// Server is a fake BOSS API backed by in-memory state
+type Server struct {
+	*httptest.Server
+
+	// APIKey is the bearer token the server accepts
+	APIKey string
+
+	mu           sync.Mutex
+	intents      map[string]*bossclient.StakeIntent
+	order        []string
+	validators   map[string]*validator
+	deactivation map[string]*bossclient.DeactivationIntent
+	requests     []string
+	nextID       int
+	// nextIndex is the beacon index the next activated validator gets
+	nextIndex uint64
+}
+
+type validator struct {
+	bossclient.Validator
+	network           string
+	withdrawalAddress string
+}
+
+// NewServer starts a fake BOSS API. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:       "bosstest-" + randomHex(8),
+		intents:      make(map[string]*bossclient.StakeIntent),
+		validators:   make(map[string]*validator),
+		deactivation: make(map[string]*bossclient.DeactivationIntent),
+		nextIndex:    700000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /boss/v1/ethereum/{network}/stake-intents", network(s.handleCreateStakeIntent))
+	mux.HandleFunc("GET /boss/v1/ethereum/{network}/stake-intents", network(s.handleListStakeIntents))
+	mux.HandleFunc("GET /boss/v1/ethereum/{network}/stake-intents/{id}", network(s.handleGetStakeIntent))
+	mux.HandleFunc("POST /boss/v1/ethereum/{network}/deactivation-intents", network(s.handleCreateDeactivation))
+	mux.HandleFunc("GET /boss/v1/ethereum/{network}/deactivation-intents/{id}", network(s.handleGetDeactivation))
+	mux.HandleFunc("GET /boss/v1/ethereum/{network}/validators/{pubkey}", network(s.handleGetValidator))
+	mux.HandleFunc("GET /boss/v1/ethereum/{network}/accounts/{address}", network(s.handleGetAccount))
+
+	s.Server = httptest.NewServer(s.authorize(mux))
+	return s
+}
+
+// Client returns an API client for the server
+func (s *Server) Client() *bossclient.Client {
+	c := bossclient.NewClient(s.APIKey, s.Server.Client())
+	c.BaseURL = s.URL + "/boss/v1"
+	return c
+}
+
+// Requests returns the "METHOD path" of every request served so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// SetValidatorStatus moves a validator to status. Active validators get an
+// index and their 32 ETH balance.
+func (s *Server) SetValidatorStatus(pubkey string, status bossclient.ValidatorStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.validators[pubkey]
+	if !ok {
+		return fmt.Errorf("unknown validator %s", pubkey)
+	}
+	v.Status = status
+	if status == bossclient.StatusActiveOngoing && v.Index == nil {
+		index := s.nextIndex
+		s.nextIndex++
+		v.Index = &index
+		v.Balance = "32000000000"
+	}
+	return nil
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+			writeError(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+   ---------- WIRE FORMAT ----------
+*/
+
+// networks are the Ethereum networks BOSS routes
+var networks = []string{"mainnet", "holesky", "hoodi"}
+
+// errorBody is the body of every failed request, e.g.
+// {"code": 404, "status": "Not Found", "message": "stake intent not found"}
+type errorBody struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// stakeIntentRequest is the body of POST .../stake-intents
+type stakeIntentRequest struct {
+	PlanID string         `json:"plan_id"`
+	Stakes []stakeRequest `json:"stakes"`
+}
+
+type stakeRequest struct {
+	Amount            string `json:"amount"`
+	WithdrawalAddress string `json:"withdrawal_address"`
+	Quantity          int    `json:"quantity"`
+	FeeRecipient      string `json:"fee_recipient"`
+}
+
+// validate returns the message BOSS rejects req with, or "" if it is
+// accepted
+func (req stakeIntentRequest) validate() string {
+	if len(req.Stakes) == 0 {
+		return "stakes must not be empty"
+	}
+	for i, stake := range req.Stakes {
+		switch {
+		case stake.Quantity < 1:
+			return fmt.Sprintf("stakes[%d].quantity must be at least 1", i)
+		case !isGwei(stake.Amount):
+			return fmt.Sprintf("stakes[%d].amount must be an integer amount of gwei", i)
+		case !isAddress(stake.WithdrawalAddress):
+			return fmt.Sprintf("stakes[%d].withdrawal_address must be a 0x-prefixed 20 byte address", i)
+		case stake.FeeRecipient != "" && !isAddress(stake.FeeRecipient):
+			return fmt.Sprintf("stakes[%d].fee_recipient must be a 0x-prefixed 20 byte address", i)
+		}
+	}
+	return ""
+}
+
+// deactivationRequest is the body of POST .../deactivation-intents
+type deactivationRequest struct {
+	ValidatorPublicKeys []string `json:"validator_public_keys"`
+}
+
+func isGwei(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+func isAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+/*
+   ---------- HANDLERS ----------
+*/
+
+// network refuses networks BOSS does not stake on, as the real API does
+func network(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(networks, r.PathValue("network")) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("network %q is not supported", r.PathValue("network")))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleCreateStakeIntent(w http.ResponseWriter, r *http.Request) {
+	var req stakeIntentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	prefix := "0x01"
+	if r.URL.Query().Get("validator_type") == string(bossclient.ValidatorType0x02) {
+		prefix = "0x02"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	intent := &bossclient.StakeIntent{
+		CustomerID:    customerID,
+		Network:       r.PathValue("network"),
+		Protocol:      "ethereum",
+		StakeIntentID: fmt.Sprintf("si-%d", s.nextID),
+		Ethereum: bossclient.EthereumStakeIntent{
+			ContractAddress:     "0x" + randomHex(20),
+			EstimatedGas:        60000,
+			UnsignedTransaction: "0x" + randomHex(64),
+		},
+	}
+	for _, stake := range req.Stakes {
+		creds := prefix + "0000000000000000000000" + strings.ToLower(stake.WithdrawalAddress[2:])
+		feeRecipient := stake.FeeRecipient
+		if feeRecipient == "" {
+			feeRecipient = stake.WithdrawalAddress
+		}
+		for range stake.Quantity {
+			pubkey := "0x" + randomHex(48)
+			s.nextID++
+			intent.Ethereum.Stakes = append(intent.Ethereum.Stakes, bossclient.Stake{
+				Amount:                stake.Amount,
+				FeeRecipient:          feeRecipient,
+				StakeID:               fmt.Sprintf("stake-%d", s.nextID),
+				ValidatorPublicKey:    pubkey,
+				WithdrawalCredentials: creds,
+			})
+			s.validators[pubkey] = &validator{
+				Validator: bossclient.Validator{
+					ValidatorPublicKey:    pubkey,
+					Status:                bossclient.StatusPendingInitialized,
+					StakeIntentID:         intent.StakeIntentID,
+					WithdrawalCredentials: creds,
+					Balance:               "0",
+				},
+				network:           intent.Network,
+				withdrawalAddress: strings.ToLower(stake.WithdrawalAddress),
+			}
+		}
+	}
+	s.intents[intent.StakeIntentID] = intent
+	s.order = append(s.order, intent.StakeIntentID)
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) handleGetStakeIntent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok || intent.Network != r.PathValue("network") {
+		writeError(w, http.StatusNotFound, "stake intent not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) handleListStakeIntents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	size := 50
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page_size must be a positive integer")
+			return
+		}
+		size = n
+	}
+	start := 0
+	if v := q.Get("page_token"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid page_token")
+			return
+		}
+		start = n
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Newest first; the page token is the offset of the next page
+	var all []bossclient.StakeIntent
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if intent := s.intents[s.order[i]]; intent.Network == r.PathValue("network") {
+			all = append(all, *intent)
+		}
+	}
+	page := bossclient.StakeIntentPage{StakeIntents: all[min(start, len(all)):min(start+size, len(all))]}
+	if start+size < len(all) {
+		page.NextPageToken = strconv.Itoa(start + size)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleCreateDeactivation(w http.ResponseWriter, r *http.Request) {
+	var req deactivationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ValidatorPublicKeys) == 0 {
+		writeError(w, http.StatusBadRequest, "validator_public_keys are required")
+		return
+	}
+	network := r.PathValue("network")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every validator before exiting any
+	for _, pk := range req.ValidatorPublicKeys {
+		v, ok := s.validators[pk]
+		switch {
+		case !ok || v.network != network:
+			writeError(w, http.StatusNotFound, "validator "+pk+" not found")
+			return
+		case v.Status != bossclient.StatusActiveOngoing:
+			writeError(w, http.StatusConflict, "validator "+pk+" is "+string(v.Status))
+			return
+		}
+	}
+	s.nextID++
+	intent := &bossclient.DeactivationIntent{
+		DeactivationIntentID: fmt.Sprintf("di-%d", s.nextID),
+		CustomerID:           customerID,
+		Network:              network,
+		Protocol:             "ethereum",
+	}
+	for _, pk := range req.ValidatorPublicKeys {
+		s.validators[pk].Status = bossclient.StatusActiveExiting
+		intent.Validators = append(intent.Validators, s.validators[pk].Validator)
+	}
+	s.deactivation[intent.DeactivationIntentID] = intent
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) handleGetDeactivation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.deactivation[r.PathValue("id")]
+	if !ok || intent.Network != r.PathValue("network") {
+		writeError(w, http.StatusNotFound, "deactivation intent not found")
+		return
+	}
+	// Report the validators as they are now
+	current := *intent
+	current.Validators = nil
+	for _, v := range intent.Validators {
+		current.Validators = append(current.Validators, s.validators[v.ValidatorPublicKey].Validator)
+	}
+	writeJSON(w, http.StatusOK, current)
+}
+
+func (s *Server) handleGetValidator(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.validators[r.PathValue("pubkey")]
+	if !ok || v.network != r.PathValue("network") {
+		writeError(w, http.StatusNotFound, "validator not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, v.Validator)
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(r.PathValue("address"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := bossclient.Account{Address: address, Validators: []bossclient.Validator{}}
+	var total uint64
+	for _, v := range s.validators {
+		if v.network == r.PathValue("network") && v.withdrawalAddress == address {
+			account.Validators = append(account.Validators, v.Validator)
+			balance, _ := strconv.ParseUint(v.Balance, 10, 64)
+			total += balance
+		}
+	}
+	sort.Slice(account.Validators, func(a, b int) bool {
+		return account.Validators[a].ValidatorPublicKey < account.Validators[b].ValidatorPublicKey
+	})
+	account.TotalStaked = strconv.FormatUint(total, 10)
+	writeJSON(w, http.StatusOK, account)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorBody{Code: code, Status: http.StatusText(code), Message: msg})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
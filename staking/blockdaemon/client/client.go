@@ -0,0 +1,473 @@
+// Package bossclient calls Blockdaemon's Ethereum staking API, BOSS. Every
+// route is under the network the request is for.
+//
+// https://docs.blockdaemon.com/reference/staking-api-overview
+package bossclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// BaseURL is the BOSS API
+const BaseURL = "https://svc.blockdaemon.com/boss/v1"
+
+/*
+   ---------- CLIENT ----------
+*/
+
+// Client talks to the BOSS API
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the BOSS API. A nil httpClient means one
+// with a 30s timeout.
+func NewClient(apiKey string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{BaseURL: BaseURL, APIKey: apiKey, HTTPClient: httpClient}
+}
+
+// NetworkName represents the name of a network
+type NetworkName string
+
+const (
+	// Mainnet is the Ethereum mainnet
+	Mainnet NetworkName = "mainnet"
+	// Holesky is the Holesky network
+	Holesky NetworkName = "holesky"
+	// Hoodi is the Hoodi network
+	Hoodi NetworkName = "hoodi"
+)
+
+// ErrUnknownNetwork is returned for a NetworkName BOSS does not stake on
+var ErrUnknownNetwork = errors.New("bossclient: unknown network")
+
+// Validate checks n is a network BOSS stakes on
+func (n NetworkName) Validate() error {
+	switch n {
+	case Mainnet, Holesky, Hoodi:
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnknownNetwork, n)
+}
+
+// networkPath is the path of a resource on network, e.g.
+// /ethereum/hoodi/stake-intents
+func networkPath(network NetworkName, elem ...string) (string, error) {
+	if err := network.Validate(); err != nil {
+		return "", err
+	}
+	path := "/ethereum/" + string(network)
+	for _, e := range elem {
+		path += "/" + url.PathEscape(e)
+	}
+	return path, nil
+}
+
+/*
+   ---------- ERRORS ----------
+*/
+
+// Error is the body BOSS answers a failed request with, e.g.
+// {"code": 404, "status": "Not Found", "message": "stake intent not found"}
+type Error struct {
+	// Code is the HTTP status, repeated in the body
+	Code int `json:"code"`
+	// Status is the status text
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("boss: %d %s: %s", e.Code, e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is a BOSS 404
+func IsNotFound(err error) bool {
+	return hasCode(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a BOSS 409, e.g. a deactivation of a
+// validator that is not active
+func IsConflict(err error) bool {
+	return hasCode(err, http.StatusConflict)
+}
+
+func hasCode(err error, code int) bool {
+	var bossErr *Error
+	return errors.As(err, &bossErr) && bossErr.Code == code
+}
+
+/*
+   ---------- REQUESTS ----------
+*/
+
+// send calls path on the API with in as the JSON body, if any, and decodes
+// the response into out
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	u := strings.TrimRight(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	// Marshal request body to JSON
+	var body io.Reader
+	if in != nil {
+		jsonData, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	if in != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	// Execute request
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Non-2xx answers carry an Error; one that does not, e.g. from a proxy
+	// in front of BOSS, keeps its raw body as the message
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bossErr := &Error{}
+		if json.Unmarshal(respBody, bossErr) != nil || bossErr.Message == "" {
+			bossErr.Message = strings.TrimSpace(string(respBody))
+		}
+		bossErr.Code = resp.StatusCode
+		if bossErr.Status == "" {
+			bossErr.Status = http.StatusText(resp.StatusCode)
+		}
+		return bossErr
+	}
+
+	// Unmarshal response
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+/*
+   ---------- STAKE INTENTS ----------
+*/
+
+type ValidatorType string
+
+const (
+	ValidatorType0x01 ValidatorType = "0x01"
+	ValidatorType0x02 ValidatorType = "0x02"
+)
+
+// PostStakeIntentRequest represents the request to CreateStakeIntent
+type PostStakeIntentRequest struct {
+	// NetworkName picks the network the intent is created on
+	NetworkName NetworkName `json:"-"`
+	// PlanID is the ID of the plan defining the staking parameters (region, etc.)
+	// This feature enables you to stake to validators from the specified plan(s). When no plan id is specified, validators across all plans that match the API route will be available for staking. If it is a shared plan, you can to stake to validators on a shared node from the specified plan.
+	PlanID string `json:"plan_id,omitempty"`
+	// Stakes is a list of stake parameters to generate intents for.
+	Stakes []StakeRequest `json:"stakes"`
+}
+
+// StakeRequest represents a single stake tx in the PostStakeIntentRequest
+type StakeRequest struct {
+	// Amount of ETH to be staked (denominated in Gwei).
+	Amount string `json:"amount"`
+	// WithdrawalAddress is an hex-encoded ethereum account or smart contract address. (e.g. 0x93247f2209abcacf57b75a51dafae777f9dd38bc)
+	WithdrawalAddress string `json:"withdrawal_address"`
+	// Quantity is the number of validators to create that will share the same withdrawal credentials.
+	Quantity int `json:"quantity"`
+	// FeeRecipient is an ethereum address to receive transaction fees from published blocks. 20-bytes, hex encoded with 0x prefix, case insensitive.
+	// Defaults to the withdrawal address if not provided
+	FeeRecipient string `json:"fee_recipient,omitempty"`
+}
+
+// Validate checks the request before it is sent
+func (r PostStakeIntentRequest) Validate() error {
+	if err := r.NetworkName.Validate(); err != nil {
+		return err
+	}
+	if len(r.Stakes) == 0 {
+		return errors.New("bossclient: no stakes requested")
+	}
+	for i, s := range r.Stakes {
+		switch {
+		case s.Quantity < 1:
+			return fmt.Errorf("bossclient: stake %d: quantity must be at least 1", i)
+		case s.Amount == "":
+			return fmt.Errorf("bossclient: stake %d: amount is required", i)
+		case !isAddress(s.WithdrawalAddress):
+			return fmt.Errorf("bossclient: stake %d: withdrawal_address %q is not a hex address", i, s.WithdrawalAddress)
+		case s.FeeRecipient != "" && !isAddress(s.FeeRecipient):
+			return fmt.Errorf("bossclient: stake %d: fee_recipient %q is not a hex address", i, s.FeeRecipient)
+		}
+	}
+	return nil
+}
+
+// EthereumStakeIntent represents the ethereum's stake intents
+type EthereumStakeIntent struct {
+	// ContractAddress is an hex-encoded ethereum account or smart contract address.
+	ContractAddress string `json:"contract_address"`
+	// EstimatedGas is the estimated gas for the transaction
+	EstimatedGas int `json:"estimated_gas"`
+	// ExpirationTime is the transaction expiration time
+	ExpirationTime int `json:"expiration_time"`
+	// Stakes being made.
+	Stakes []Stake `json:"stakes"`
+	// UnsignedTransaction is the unsigned transaction to be signed by the user.
+	UnsignedTransaction string `json:"unsigned_transaction"`
+}
+
+// Stake represents a single stake tx in a stake intent
+type Stake struct {
+	// Amount of ETH (denominated in Gwei).
+	Amount string `json:"amount"`
+	// FeeRecipient is an ethereum address to receive transaction fees from published blocks. 20-bytes, hex encoded with 0x prefix, case insensitive.
+	FeeRecipient string `json:"fee_recipient"`
+	// StakeID is the unique identifier for the stake.
+	StakeID string `json:"stake_id"`
+	// ValidatorPublicKey is a BLS public Key.
+	ValidatorPublicKey string `json:"validator_public_key"`
+	// WithdrawalCredentials is an hexadecimal encoded withdrawal credentials which can be either a BLS public key or an ethereum account address.
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+}
+
+// StakeIntent represents the response body for a stake intent
+type StakeIntent struct {
+	// CustomerID is the ID of the customer who made the request
+	CustomerID string `json:"customer_id"`
+	// Ethereum is the response for Ethereum staking
+	Ethereum EthereumStakeIntent `json:"ethereum"`
+	// Network is the network on which the staking is being done (e.g. mainnet, holesky)
+	Network string `json:"network"`
+	// Protocol is the protocol on which the staking is being done (e.g. ethereum)
+	Protocol string `json:"protocol"`
+	// StakeIntentID is an unique idenifier for a group of stakes.
+	StakeIntentID string `json:"stake_intent_id"`
+}
+
+// CreateStakeIntent creates validators on req.NetworkName and returns the
+// deposit transaction to sign
+func (c *Client) CreateStakeIntent(ctx context.Context, req PostStakeIntentRequest, validatorType ValidatorType) (*StakeIntent, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	path, err := networkPath(req.NetworkName, "stake-intents")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if validatorType != "" {
+		query.Set("validator_type", string(validatorType))
+	}
+	var intent StakeIntent
+	if err := c.send(ctx, http.MethodPost, path, query, req, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// GetStakeIntent returns a stake intent by ID
+func (c *Client) GetStakeIntent(ctx context.Context, network NetworkName, id string) (*StakeIntent, error) {
+	path, err := networkPath(network, "stake-intents", id)
+	if err != nil {
+		return nil, err
+	}
+	var intent StakeIntent
+	if err := c.send(ctx, http.MethodGet, path, nil, nil, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// ListOptions pages through a list; zero values use the API defaults
+type ListOptions struct {
+	// PageToken continues from a page's NextPageToken
+	PageToken string
+	PageSize  int
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.PageToken != "" {
+		query.Set("page_token", o.PageToken)
+	}
+	if o.PageSize > 0 {
+		query.Set("page_size", fmt.Sprint(o.PageSize))
+	}
+	return query
+}
+
+// StakeIntentPage is one page of stake intents, newest first
+type StakeIntentPage struct {
+	StakeIntents  []StakeIntent `json:"stake_intents"`
+	NextPageToken string        `json:"next_page_token,omitempty"`
+}
+
+// ListStakeIntents returns a page of the customer's stake intents on network
+func (c *Client) ListStakeIntents(ctx context.Context, network NetworkName, opts ListOptions) (*StakeIntentPage, error) {
+	path, err := networkPath(network, "stake-intents")
+	if err != nil {
+		return nil, err
+	}
+	var page StakeIntentPage
+	if err := c.send(ctx, http.MethodGet, path, opts.query(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+/*
+   ---------- DEACTIVATION ----------
+*/
+
+// DeactivationIntentRequest asks BOSS to exit validators it runs
+type DeactivationIntentRequest struct {
+	NetworkName NetworkName `json:"-"`
+	// ValidatorPublicKeys are the BLS public keys of the validators to exit
+	ValidatorPublicKeys []string `json:"validator_public_keys"`
+}
+
+// DeactivationIntent is an accepted exit of one or more validators
+type DeactivationIntent struct {
+	DeactivationIntentID string `json:"deactivation_intent_id"`
+	CustomerID           string `json:"customer_id"`
+	Network              string `json:"network"`
+	Protocol             string `json:"protocol"`
+	// Validators are the exiting validators as of the request
+	Validators []Validator `json:"validators"`
+}
+
+// CreateDeactivationIntent exits validators. BOSS refuses validators that
+// are not active, or are already exiting, with a 409 Error.
+func (c *Client) CreateDeactivationIntent(ctx context.Context, req DeactivationIntentRequest) (*DeactivationIntent, error) {
+	if len(req.ValidatorPublicKeys) == 0 {
+		return nil, errors.New("bossclient: no validators to deactivate")
+	}
+	path, err := networkPath(req.NetworkName, "deactivation-intents")
+	if err != nil {
+		return nil, err
+	}
+	var intent DeactivationIntent
+	if err := c.send(ctx, http.MethodPost, path, nil, req, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// GetDeactivationIntent returns a deactivation intent by ID
+func (c *Client) GetDeactivationIntent(ctx context.Context, network NetworkName, id string) (*DeactivationIntent, error) {
+	path, err := networkPath(network, "deactivation-intents", id)
+	if err != nil {
+		return nil, err
+	}
+	var intent DeactivationIntent
+	if err := c.send(ctx, http.MethodGet, path, nil, nil, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+/*
+   ---------- STATUS ----------
+*/
+
+// ValidatorStatus is a beacon chain validator state
+type ValidatorStatus string
+
+const (
+	StatusPendingInitialized ValidatorStatus = "pending_initialized"
+	StatusPendingQueued      ValidatorStatus = "pending_queued"
+	StatusActiveOngoing      ValidatorStatus = "active_ongoing"
+	StatusActiveExiting      ValidatorStatus = "active_exiting"
+	StatusExitedUnslashed    ValidatorStatus = "exited_unslashed"
+	StatusWithdrawalPossible ValidatorStatus = "withdrawal_possible"
+	StatusWithdrawalDone     ValidatorStatus = "withdrawal_done"
+)
+
+// Validator is the state of one validator BOSS runs
+type Validator struct {
+	ValidatorPublicKey string          `json:"validator_public_key"`
+	Status             ValidatorStatus `json:"status"`
+	// Index is set once the deposit is processed
+	Index                 *uint64 `json:"validator_index,omitempty"`
+	StakeIntentID         string  `json:"stake_intent_id,omitempty"`
+	WithdrawalCredentials string  `json:"withdrawal_credentials"`
+	// Balance is in Gwei
+	Balance string `json:"balance"`
+}
+
+// GetValidator returns the status of a validator by its BLS public key
+func (c *Client) GetValidator(ctx context.Context, network NetworkName, pubkey string) (*Validator, error) {
+	path, err := networkPath(network, "validators", pubkey)
+	if err != nil {
+		return nil, err
+	}
+	var validator Validator
+	if err := c.send(ctx, http.MethodGet, path, nil, nil, &validator); err != nil {
+		return nil, err
+	}
+	return &validator, nil
+}
+
+// Account is a withdrawal address and the validators staked to it
+type Account struct {
+	Address string `json:"address"`
+	// TotalStaked is the sum of the validators' balances in Gwei
+	TotalStaked string      `json:"total_staked"`
+	Validators  []Validator `json:"validators"`
+}
+
+// GetAccount returns the validators whose withdrawal address is address
+func (c *Client) GetAccount(ctx context.Context, network NetworkName, address string) (*Account, error) {
+	if !isAddress(address) {
+		return nil, fmt.Errorf("bossclient: %q is not a hex address", address)
+	}
+	path, err := networkPath(network, "accounts", address)
+	if err != nil {
+		return nil, err
+	}
+	var account Account
+	if err := c.send(ctx, http.MethodGet, path, nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// isAddress reports whether s is a 0x-prefixed 20-byte address, in any case
+func isAddress(s string) bool {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	return err == nil && len(b) == 20 && strings.HasPrefix(s, "0x")
+}
@@ -0,0 +1,206 @@
+package bossclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blockdaemon/bosstest"
+	bossclient "blockdaemon/client"
+)
+
+const withdrawal = "0x601cae643a1cbad5509762dca13d54498eab171b"
+
+func stakeRequest(network bossclient.NetworkName, quantity int) bossclient.PostStakeIntentRequest {
+	return bossclient.PostStakeIntentRequest{
+		NetworkName: network,
+		Stakes: []bossclient.StakeRequest{
+			{Amount: "32000000000", WithdrawalAddress: withdrawal, Quantity: quantity},
+		},
+	}
+}
+
+func TestRoutesFollowNetwork(t *testing.T) {
+	for _, network := range []bossclient.NetworkName{bossclient.Mainnet, bossclient.Holesky, bossclient.Hoodi} {
+		t.Run(string(network), func(t *testing.T) {
+			srv := bosstest.NewServer()
+			defer srv.Close()
+			client := srv.Client()
+			ctx := context.Background()
+
+			intent, err := client.CreateStakeIntent(ctx, stakeRequest(network, 1), bossclient.ValidatorType0x02)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if intent.Network != string(network) || !strings.HasPrefix(intent.Ethereum.Stakes[0].WithdrawalCredentials, "0x02") {
+				t.Fatalf("unexpected stake intent %+v", intent)
+			}
+			pubkey := intent.Ethereum.Stakes[0].ValidatorPublicKey
+			if _, err := client.GetStakeIntent(ctx, network, intent.StakeIntentID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.ListStakeIntents(ctx, network, bossclient.ListOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.GetValidator(ctx, network, pubkey); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.GetAccount(ctx, network, withdrawal); err != nil {
+				t.Fatal(err)
+			}
+
+			prefix := "/boss/v1/ethereum/" + string(network) + "/"
+			for _, r := range srv.Requests() {
+				if _, path, _ := strings.Cut(r, " "); !strings.HasPrefix(path, prefix) {
+					t.Fatalf("%s was not routed under %s", r, prefix)
+				}
+			}
+
+			// Nothing made on one network is found on another
+			other := bossclient.Hoodi
+			if network == bossclient.Hoodi {
+				other = bossclient.Holesky
+			}
+			if _, err := client.GetStakeIntent(ctx, other, intent.StakeIntentID); !bossclient.IsNotFound(err) {
+				t.Fatalf("expected the intent to be missing on %s, got %v", other, err)
+			}
+			if _, err := client.GetValidator(ctx, other, pubkey); !bossclient.IsNotFound(err) {
+				t.Fatalf("expected the validator to be missing on %s, got %v", other, err)
+			}
+		})
+	}
+}
+
+func TestDeactivation(t *testing.T) {
+	srv := bosstest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	intent, err := client.CreateStakeIntent(ctx, stakeRequest(bossclient.Hoodi, 2), bossclient.ValidatorType0x01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubkeys []string
+	for _, stake := range intent.Ethereum.Stakes {
+		pubkeys = append(pubkeys, stake.ValidatorPublicKey)
+	}
+	deactivate := bossclient.DeactivationIntentRequest{NetworkName: bossclient.Hoodi, ValidatorPublicKeys: pubkeys[:1]}
+
+	// Pending validators cannot exit
+	if _, err := client.CreateDeactivationIntent(ctx, deactivate); !bossclient.IsConflict(err) {
+		t.Fatalf("expected a pending validator to be refused, got %v", err)
+	}
+
+	indices := map[uint64]bool{}
+	for _, pubkey := range pubkeys {
+		if err := srv.SetValidatorStatus(pubkey, bossclient.StatusActiveOngoing); err != nil {
+			t.Fatal(err)
+		}
+		v, err := client.GetValidator(ctx, bossclient.Hoodi, pubkey)
+		if err != nil || v.Index == nil || v.StakeIntentID != intent.StakeIntentID {
+			t.Fatalf("get validator %+v: %v", v, err)
+		}
+		if indices[*v.Index] {
+			t.Fatalf("validator index %d given twice", *v.Index)
+		}
+		indices[*v.Index] = true
+	}
+	if _, err := client.GetAccount(ctx, bossclient.Hoodi, withdrawal[2:]); err == nil {
+		t.Fatal("expected an address without 0x to be refused")
+	}
+	account, err := client.GetAccount(ctx, bossclient.Hoodi, withdrawal)
+	if err != nil || len(account.Validators) != 2 || account.TotalStaked != "64000000000" {
+		t.Fatalf("get account %+v: %v", account, err)
+	}
+
+	exit, err := client.CreateDeactivationIntent(ctx, deactivate)
+	if err != nil || exit.Validators[0].Status != bossclient.StatusActiveExiting {
+		t.Fatalf("deactivate %+v: %v", exit, err)
+	}
+	if _, err := client.CreateDeactivationIntent(ctx, deactivate); !bossclient.IsConflict(err) {
+		t.Fatalf("expected an exiting validator to be refused, got %v", err)
+	}
+	if err := srv.SetValidatorStatus(pubkeys[0], bossclient.StatusExitedUnslashed); err != nil {
+		t.Fatal(err)
+	}
+	exit, err = client.GetDeactivationIntent(ctx, bossclient.Hoodi, exit.DeactivationIntentID)
+	if err != nil || exit.Validators[0].Status != bossclient.StatusExitedUnslashed {
+		t.Fatalf("get deactivation %+v: %v", exit, err)
+	}
+}
+
+func TestListStakeIntentsPages(t *testing.T) {
+	srv := bosstest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	var want []string
+	for range 5 {
+		intent, err := client.CreateStakeIntent(ctx, stakeRequest(bossclient.Hoodi, 1), bossclient.ValidatorType0x01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append([]string{intent.StakeIntentID}, want...)
+	}
+
+	var got []string
+	opts := bossclient.ListOptions{PageSize: 2}
+	for {
+		page, err := client.ListStakeIntents(ctx, bossclient.Hoodi, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, intent := range page.StakeIntents {
+			got = append(got, intent.StakeIntentID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		opts.PageToken = page.NextPageToken
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v newest first, got %v", want, got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := bosstest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	// Bad requests are refused before they are sent
+	if _, err := client.CreateStakeIntent(ctx, stakeRequest("sepolia", 1), ""); !errors.Is(err, bossclient.ErrUnknownNetwork) {
+		t.Fatalf("expected an unknown network to be refused, got %v", err)
+	}
+	if _, err := client.CreateStakeIntent(ctx, stakeRequest(bossclient.Hoodi, 0), ""); err == nil {
+		t.Fatal("expected a zero quantity to be refused")
+	}
+	if len(srv.Requests()) != 0 {
+		t.Fatalf("expected nothing sent, got %v", srv.Requests())
+	}
+
+	// BOSS's error body
+	client.APIKey = "wrong"
+	_, err := client.ListStakeIntents(ctx, bossclient.Hoodi, bossclient.ListOptions{})
+	var bossErr *bossclient.Error
+	if !errors.As(err, &bossErr) || bossErr.Code != http.StatusUnauthorized || bossErr.Status != "Unauthorized" || bossErr.Message == "" {
+		t.Fatalf("expected a 401 Error, got %v", err)
+	}
+
+	// An answer from something other than BOSS keeps its body
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream timed out", http.StatusGatewayTimeout)
+	}))
+	defer proxy.Close()
+	client.BaseURL = proxy.URL
+	_, err = client.GetValidator(ctx, bossclient.Hoodi, "0xabc")
+	if !errors.As(err, &bossErr) || bossErr.Code != http.StatusGatewayTimeout || bossErr.Message != "upstream timed out" {
+		t.Fatalf("expected a 504 Error with the proxy's body, got %v", err)
+	}
+}
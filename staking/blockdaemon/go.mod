@@ -1,4 +1,4 @@
-module galaxydigital
+module blockdaemon
 
 go 1.25.0
 
@@ -37,4 +37,4 @@ require (
 	google.golang.org/protobuf v1.36.7 // indirect
 )
 
-replace secretmanager => ../secretmanager
+replace secretmanager => ../../secretmanager
@@ -0,0 +1,135 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BeaconClient talks to a consensus-layer node's standard REST API
+type BeaconClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewBeaconClient returns a client for the beacon node at baseURL
+func NewBeaconClient(baseURL string) *BeaconClient {
+	return &BeaconClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// BeaconError is the error body returned by the beacon node API
+type BeaconError struct {
+	StatusCode int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *BeaconError) Error() string {
+	return fmt.Sprintf("beacon node returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// SubmitVoluntaryExit adds a signed exit to the node's operation pool for
+// gossip
+func (b *BeaconClient) SubmitVoluntaryExit(ctx context.Context, exit *SignedVoluntaryExit) error {
+	body, err := json.Marshal(exit)
+	if err != nil {
+		return err
+	}
+
+	url := b.BaseURL + "/eth/v1/beacon/pool/voluntary_exits"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = b.do(req)
+	return err
+}
+
+func (b *BeaconClient) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		beaconErr := &BeaconError{}
+		if json.Unmarshal(body, beaconErr) != nil || beaconErr.Message == "" {
+			beaconErr.Message = string(body)
+		}
+		beaconErr.StatusCode = resp.StatusCode
+		return nil, beaconErr
+	}
+	return body, nil
+}
+
+// BeaconValidator is a validator as reported by the beacon state
+type BeaconValidator struct {
+	Index  uint64
+	Status string
+	Pubkey BLSPubkey
+	// WithdrawalCredentials is the 0x-prefixed hex of the 32-byte credentials
+	WithdrawalCredentials string
+}
+
+// Exited reports whether the validator has left the active set
+func (v *BeaconValidator) Exited() bool {
+	return strings.HasPrefix(v.Status, "exited") || strings.HasPrefix(v.Status, "withdrawal")
+}
+
+// GetValidator looks a validator up in the head state by index or pubkey
+func (b *BeaconClient) GetValidator(ctx context.Context, id string) (*BeaconValidator, error) {
+	url := fmt.Sprintf("%s/eth/v1/beacon/states/head/validators/%s", b.BaseURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Index     string `json:"index"`
+			Status    string `json:"status"`
+			Validator struct {
+				Pubkey                BLSPubkey `json:"pubkey"`
+				WithdrawalCredentials string    `json:"withdrawal_credentials"`
+			} `json:"validator"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseUint(resp.Data.Index, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator index %q: %w", resp.Data.Index, err)
+	}
+	return &BeaconValidator{
+		Index:  index,
+		Status: resp.Data.Status,
+		Pubkey: resp.Data.Validator.Pubkey,
+
+		WithdrawalCredentials: resp.Data.Validator.WithdrawalCredentials,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package consensus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+)
+
+// blsDST is the ciphersuite the beacon chain signs with
+var blsDST = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+// ErrInvalidSignature is returned when a BLS signature does not verify
+var ErrInvalidSignature = errors.New("consensus: invalid BLS signature")
+
+// BLSPubkey is a compressed BLS12-381 G1 public key
+type BLSPubkey [48]byte
+
+// BLSSignature is a compressed BLS12-381 G2 signature
+type BLSSignature [96]byte
+
+// ParseBLSPubkey decodes a 48-byte hex public key, with or without 0x
+func ParseBLSPubkey(s string) (BLSPubkey, error) {
+	var pk BLSPubkey
+	err := decodeFixedHex(s, pk[:], "BLS public key")
+	return pk, err
+}
+
+// ParseBLSSignature decodes a 96-byte hex signature, with or without 0x
+func ParseBLSSignature(s string) (BLSSignature, error) {
+	var sig BLSSignature
+	err := decodeFixedHex(s, sig[:], "BLS signature")
+	return sig, err
+}
+
+func (pk BLSPubkey) String() string {
+	return "0x" + hex.EncodeToString(pk[:])
+}
+
+func (pk BLSPubkey) MarshalText() ([]byte, error) {
+	return []byte(pk.String()), nil
+}
+
+func (pk *BLSPubkey) UnmarshalText(text []byte) error {
+	return decodeFixedHex(string(text), pk[:], "BLS public key")
+}
+
+func (sig BLSSignature) String() string {
+	return "0x" + hex.EncodeToString(sig[:])
+}
+
+func (sig BLSSignature) MarshalText() ([]byte, error) {
+	return []byte(sig.String()), nil
+}
+
+func (sig *BLSSignature) UnmarshalText(text []byte) error {
+	return decodeFixedHex(string(text), sig[:], "BLS signature")
+}
+
+// VerifyBLS checks sig over msg against pk, including subgroup checks on both
+func VerifyBLS(pk BLSPubkey, msg []byte, sig BLSSignature) error {
+	pub, err := pubkeyPoint(pk)
+	if err != nil {
+		return err
+	}
+	s, err := signaturePoint(sig)
+	if err != nil {
+		return err
+	}
+	h, err := bls12381.HashToG2(msg, blsDST)
+	if err != nil {
+		return err
+	}
+	return pairingCheck(pub, h, s)
+}
+
+func pubkeyPoint(pk BLSPubkey) (bls12381.G1Affine, error) {
+	var pub bls12381.G1Affine
+	if _, err := pub.SetBytes(pk[:]); err != nil {
+		return pub, fmt.Errorf("consensus: invalid BLS public key: %w", err)
+	}
+	if pub.IsInfinity() {
+		return pub, errors.New("consensus: BLS public key is the point at infinity")
+	}
+	return pub, nil
+}
+
+func signaturePoint(sig BLSSignature) (bls12381.G2Affine, error) {
+	var s bls12381.G2Affine
+	if _, err := s.SetBytes(sig[:]); err != nil {
+		return s, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return s, nil
+}
+
+// pairingCheck checks s signs the message hashed to h under pub
+func pairingCheck(pub bls12381.G1Affine, h, s bls12381.G2Affine) error {
+	// e(pk, H(m)) == e(g1, sig)  <=>  e(pk, H(m)) * e(-g1, sig) == 1
+	_, _, g1, _ := bls12381.Generators()
+	var negG1 bls12381.G1Affine
+	negG1.Neg(&g1)
+
+	ok, err := bls12381.PairingCheck(
+		[]bls12381.G1Affine{pub, negG1},
+		[]bls12381.G2Affine{h, s},
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func decodeFixedHex(s string, dst []byte, what string) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", what, s, err)
+	}
+	if len(b) != len(dst) {
+		return fmt.Errorf("invalid %s: want %d bytes, got %d", what, len(dst), len(b))
+	}
+	copy(dst, b)
+	return nil
+}
+
+func sha256Sum(chunks ...[]byte) [32]byte {
+	h := sha256.New()
+	for _, c := range chunks {
+		h.Write(c)
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
@@ -0,0 +1,57 @@
+// Package blstest provides validator BLS keys for fake staking servers and
+// tests
+package blstest
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"consensus"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+)
+
+var blsDST = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+// Key is a validator signing key
+type Key struct {
+	secret *big.Int
+	Pubkey consensus.BLSPubkey
+}
+
+// NewKey returns a random validator key
+func NewKey() Key {
+	secret, err := rand.Int(rand.Reader, fr.Modulus())
+	if err != nil {
+		panic(err)
+	}
+	var pub bls12381.G1Affine
+	pub.ScalarMultiplicationBase(secret)
+	return Key{secret: secret, Pubkey: pub.Bytes()}
+}
+
+// Sign signs msg, normally a signing root
+func (k Key) Sign(msg []byte) consensus.BLSSignature {
+	h, err := bls12381.HashToG2(msg, blsDST)
+	if err != nil {
+		panic(err)
+	}
+	var sig bls12381.G2Affine
+	sig.ScalarMultiplication(&h, k.secret)
+	return sig.Bytes()
+}
+
+// Deposit returns a deposit signed for network
+func (k Key) Deposit(creds [32]byte, amountGwei uint64, network consensus.Network) consensus.DepositData {
+	msg := consensus.DepositMessage{Pubkey: k.Pubkey, WithdrawalCredentials: creds, AmountGwei: amountGwei}
+	root := consensus.DepositSigningRoot(msg, network)
+	return consensus.DepositData{DepositMessage: msg, Signature: k.Sign(root[:])}
+}
+
+// Exit returns a signed voluntary exit for the validator at index
+func (k Key) Exit(index, epoch uint64, network consensus.Network) consensus.SignedVoluntaryExit {
+	exit := consensus.VoluntaryExit{Epoch: epoch, ValidatorIndex: index}
+	root := consensus.ExitSigningRoot(exit, network)
+	return consensus.SignedVoluntaryExit{Message: exit, Signature: k.Sign(root[:])}
+}
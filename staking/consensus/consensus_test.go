@@ -0,0 +1,115 @@
+package consensus_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"consensus"
+	"consensus/blstest"
+)
+
+func TestExitDomainDiffersPerNetwork(t *testing.T) {
+	seen := map[[32]byte]string{}
+	for _, n := range []consensus.Network{consensus.Mainnet, consensus.Holesky, consensus.Hoodi} {
+		d := consensus.ExitDomain(n)
+		if d[0] != 0x04 || d[1] != 0 || d[2] != 0 || d[3] != 0 {
+			t.Fatalf("%s domain has wrong type prefix %x", n.Name, d[:4])
+		}
+		if other, dup := seen[d]; dup {
+			t.Fatalf("%s and %s share an exit domain", n.Name, other)
+		}
+		seen[d] = n.Name
+	}
+}
+
+// Known answers from outside this package, so a wrong domain or signing root
+// cannot agree with itself
+func TestKnownAnswers(t *testing.T) {
+	hexBytes := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// The mainnet deposit domain every deposit tool signs with
+	deposit := consensus.DepositDomain(consensus.Mainnet)
+	if got := hex.EncodeToString(deposit[:]); got != "03000000f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a9" {
+		t.Fatalf("mainnet deposit domain %s", got)
+	}
+
+	// The exit domain embeds the mainnet Capella fork digest, 0xbba4da96
+	domain := consensus.ExitDomain(consensus.Mainnet)
+	if got := hex.EncodeToString(domain[:8]); got != "04000000bba4da96" {
+		t.Fatalf("mainnet exit domain %x", domain)
+	}
+
+	// compute_signing_root of VoluntaryExit{epoch 194048, index 1}, by hand
+	var leaves [64]byte
+	binary.LittleEndian.PutUint64(leaves[0:], 194048)
+	binary.LittleEndian.PutUint64(leaves[32:], 1)
+	exitRoot := sha256.Sum256(leaves[:])
+	want := sha256.Sum256(append(exitRoot[:], domain[:]...))
+	if got := consensus.ExitSigningRoot(consensus.VoluntaryExit{Epoch: 194048, ValidatorIndex: 1}, consensus.Mainnet); got != want {
+		t.Fatalf("exit signing root %x, want %x", got, want)
+	}
+
+	// The BLS sign vector for secret key 0x263dbd79... over 32 zero bytes,
+	// from the consensus spec test suite (ethereum/bls12-381-tests)
+	var pubkey consensus.BLSPubkey
+	var sig consensus.BLSSignature
+	copy(pubkey[:], hexBytes("a491d1b0ecd9bb917989f0e74f0dea0422eac4a873e5e2644f368dffb9a6e20fd6e10c1b77654d067c0618f6e5a7f79a"))
+	copy(sig[:], hexBytes("b6ed936746e01f8ecf281f020953fbf1f01debd5657c4a383940b020b26507f6076334f91e2366c96e9ab279fb5158090352ea1c5b0c9274504f4f0e7053af24802e51e4568d164fe986834f41e55c8e850ce1f98458c0cfc9ab380b55285a55"))
+	if err := consensus.VerifyBLS(pubkey, make([]byte, 32), sig); err != nil {
+		t.Fatalf("spec vector failed to verify: %v", err)
+	}
+	if err := consensus.VerifyBLS(pubkey, want[:], sig); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected the spec signature to fail over another message, got %v", err)
+	}
+}
+
+func TestVerifyRejectsOtherNetwork(t *testing.T) {
+	key := blstest.NewKey()
+
+	exit := key.Exit(7, 1000, consensus.Hoodi)
+	if err := exit.Verify(key.Pubkey, consensus.Hoodi); err != nil {
+		t.Fatalf("exit failed to verify: %v", err)
+	}
+	if err := exit.Verify(key.Pubkey, consensus.Mainnet); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature on mainnet, got %v", err)
+	}
+
+	deposit := key.Deposit([32]byte{0x02}, 32_000_000_000, consensus.Hoodi)
+	if err := deposit.Verify(consensus.Hoodi); err != nil {
+		t.Fatalf("deposit failed to verify: %v", err)
+	}
+	deposit.AmountGwei++
+	if err := deposit.Verify(consensus.Hoodi); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for tampered amount, got %v", err)
+	}
+}
+
+func TestMatchExitSigners(t *testing.T) {
+	a, b, stranger := blstest.NewKey(), blstest.NewKey(), blstest.NewKey()
+	exits := []consensus.SignedVoluntaryExit{
+		b.Exit(2, 1000, consensus.Hoodi),
+		stranger.Exit(3, 1000, consensus.Hoodi),
+		a.Exit(1, 1000, consensus.Hoodi),
+		b.Exit(2, 1001, consensus.Hoodi),
+	}
+
+	signers, err := consensus.MatchExitSigners(exits, []consensus.BLSPubkey{a.Pubkey, b.Pubkey}, consensus.Hoodi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*consensus.BLSPubkey{&b.Pubkey, nil, &a.Pubkey, &b.Pubkey}
+	for i := range want {
+		if (signers[i] == nil) != (want[i] == nil) || signers[i] != nil && *signers[i] != *want[i] {
+			t.Fatalf("exit %d: expected signer %v, got %v", i, want[i], signers[i])
+		}
+	}
+}
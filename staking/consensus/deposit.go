@@ -0,0 +1,80 @@
+package consensus
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// domainDeposit is DOMAIN_DEPOSIT from the consensus specs
+var domainDeposit = [4]byte{0x03, 0x00, 0x00, 0x00}
+
+// DepositMessage is what a validator key signs to authorise a deposit
+type DepositMessage struct {
+	Pubkey                BLSPubkey
+	WithdrawalCredentials [32]byte
+	AmountGwei            uint64
+}
+
+// HashTreeRoot is the SSZ root of the deposit message
+func (m DepositMessage) HashTreeRoot() [32]byte {
+	var amountLeaf [32]byte
+	binary.LittleEndian.PutUint64(amountLeaf[:8], m.AmountGwei)
+
+	pubkeyRoot := pubkeyRoot(m.Pubkey)
+	var zero [32]byte
+	left := sha256Sum(pubkeyRoot[:], m.WithdrawalCredentials[:])
+	right := sha256Sum(amountLeaf[:], zero[:])
+	return sha256Sum(left[:], right[:])
+}
+
+// DepositData is a deposit message with its signature, as the deposit
+// contract receives it
+type DepositData struct {
+	DepositMessage
+	Signature BLSSignature
+}
+
+// HashTreeRoot is the SSZ root the deposit contract recomputes and checks
+func (d DepositData) HashTreeRoot() [32]byte {
+	var amountLeaf [32]byte
+	binary.LittleEndian.PutUint64(amountLeaf[:8], d.AmountGwei)
+
+	var sigHighLeaf [64]byte
+	copy(sigHighLeaf[:], d.Signature[64:])
+	sigLow := sha256Sum(d.Signature[:64])
+	sigHigh := sha256Sum(sigHighLeaf[:])
+	sigRoot := sha256Sum(sigLow[:], sigHigh[:])
+
+	pubkeyRoot := pubkeyRoot(d.Pubkey)
+	left := sha256Sum(pubkeyRoot[:], d.WithdrawalCredentials[:])
+	right := sha256Sum(amountLeaf[:], sigRoot[:])
+	return sha256Sum(left[:], right[:])
+}
+
+// DepositDomain is the deposit signing domain on network. Deposits are valid
+// across forks, so it uses the genesis fork version and a zero genesis
+// validators root.
+func DepositDomain(network Network) [32]byte {
+	return computeDomain(domainDeposit, network.GenesisForkVersion, [32]byte{})
+}
+
+// DepositSigningRoot is the message a validator key signs to deposit on
+// network
+func DepositSigningRoot(m DepositMessage, network Network) [32]byte {
+	return signingRoot(m.HashTreeRoot(), DepositDomain(network))
+}
+
+// Verify checks the deposit signature for network
+func (d DepositData) Verify(network Network) error {
+	root := DepositSigningRoot(d.DepositMessage, network)
+	if err := VerifyBLS(d.Pubkey, root[:], d.Signature); err != nil {
+		return fmt.Errorf("deposit for %s on %s: %w", d.Pubkey, network.Name, err)
+	}
+	return nil
+}
+
+func pubkeyRoot(pk BLSPubkey) [32]byte {
+	var leaf [64]byte
+	copy(leaf[:], pk[:])
+	return sha256Sum(leaf[:])
+}
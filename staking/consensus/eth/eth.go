@@ -0,0 +1,32 @@
+// Package eth holds the execution-layer contract ABIs shared by the staking
+// providers
+package eth
+
+import (
+	"strings"
+
+	"consensus"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// DepositABI is the deposit function of the beacon chain deposit contract
+var DepositABI = MustParseABI(`[{"name":"deposit","type":"function","stateMutability":"payable","inputs":[` +
+	`{"name":"pubkey","type":"bytes"},{"name":"withdrawal_credentials","type":"bytes"},` +
+	`{"name":"signature","type":"bytes"},{"name":"deposit_data_root","type":"bytes32"}],"outputs":[]}]`)
+
+// DepositCalldata packs a deposit contract call for d, with the deposit data
+// root the contract recomputes and checks
+func DepositCalldata(d consensus.DepositData) ([]byte, error) {
+	root := d.HashTreeRoot()
+	return DepositABI.Pack("deposit", d.Pubkey[:], d.WithdrawalCredentials[:], d.Signature[:], root)
+}
+
+// MustParseABI parses a JSON ABI definition, panicking if it is malformed
+func MustParseABI(def string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
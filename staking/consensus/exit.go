@@ -0,0 +1,156 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+)
+
+// domainVoluntaryExit is DOMAIN_VOLUNTARY_EXIT from the consensus specs
+var domainVoluntaryExit = [4]byte{0x04, 0x00, 0x00, 0x00}
+
+// VoluntaryExit is the consensus-layer voluntary exit message
+type VoluntaryExit struct {
+	Epoch          uint64
+	ValidatorIndex uint64
+}
+
+func (e VoluntaryExit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Epoch          string `json:"epoch"`
+		ValidatorIndex string `json:"validator_index"`
+	}{
+		Epoch:          strconv.FormatUint(e.Epoch, 10),
+		ValidatorIndex: strconv.FormatUint(e.ValidatorIndex, 10),
+	})
+}
+
+// UnmarshalJSON accepts integers either quoted, as the beacon API sends
+// them, or bare
+func (e *VoluntaryExit) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Epoch          json.Number `json:"epoch"`
+		ValidatorIndex json.Number `json:"validator_index"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	epoch, err := strconv.ParseUint(raw.Epoch.String(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid epoch %q: %w", raw.Epoch, err)
+	}
+	index, err := strconv.ParseUint(raw.ValidatorIndex.String(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid validator_index %q: %w", raw.ValidatorIndex, err)
+	}
+	e.Epoch, e.ValidatorIndex = epoch, index
+	return nil
+}
+
+// HashTreeRoot is the SSZ root of the exit: two uint64 leaves
+func (e VoluntaryExit) HashTreeRoot() [32]byte {
+	var leaves [64]byte
+	binary.LittleEndian.PutUint64(leaves[0:8], e.Epoch)
+	binary.LittleEndian.PutUint64(leaves[32:40], e.ValidatorIndex)
+	return sha256Sum(leaves[:])
+}
+
+// SignedVoluntaryExit is a voluntary exit with the validator's BLS signature
+type SignedVoluntaryExit struct {
+	Message   VoluntaryExit `json:"message"`
+	Signature BLSSignature  `json:"signature"`
+}
+
+// ParseSignedVoluntaryExits decodes a decrypted VEM result: a JSON array of
+// signed exits, or a single one
+func ParseSignedVoluntaryExits(b []byte) ([]SignedVoluntaryExit, error) {
+	trimmed := bytes.TrimSpace(b)
+	var exits []SignedVoluntaryExit
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		exits = make([]SignedVoluntaryExit, 1)
+		if err := json.Unmarshal(trimmed, &exits[0]); err != nil {
+			return nil, fmt.Errorf("malformed signed voluntary exit: %w", err)
+		}
+		return exits, nil
+	}
+	if err := json.Unmarshal(trimmed, &exits); err != nil {
+		return nil, fmt.Errorf("malformed signed voluntary exits: %w", err)
+	}
+	if len(exits) == 0 {
+		return nil, errors.New("no signed voluntary exits")
+	}
+	return exits, nil
+}
+
+// ExitDomain is the voluntary exit signing domain on network. Since Deneb
+// (EIP-7044) it is pinned to the Capella fork version.
+func ExitDomain(network Network) [32]byte {
+	return computeDomain(domainVoluntaryExit, network.CapellaForkVersion, network.GenesisValidatorsRoot)
+}
+
+// ExitSigningRoot is the message a validator signs to exit on network
+func ExitSigningRoot(exit VoluntaryExit, network Network) [32]byte {
+	return signingRoot(exit.HashTreeRoot(), ExitDomain(network))
+}
+
+// Verify checks the exit was signed by pubkey for network
+func (e *SignedVoluntaryExit) Verify(pubkey BLSPubkey, network Network) error {
+	root := ExitSigningRoot(e.Message, network)
+	if err := VerifyBLS(pubkey, root[:], e.Signature); err != nil {
+		return fmt.Errorf("exit for validator %d on %s: %w", e.Message.ValidatorIndex, network.Name, err)
+	}
+	return nil
+}
+
+// MatchExitSigners finds which of pubkeys signed each exit on network:
+// signers[i] is the signer of exits[i], or nil if none of them did. Each key
+// and exit is decoded and hashed once, and keys that have already matched are
+// tried last, so a well-formed result costs about half the pairings of
+// checking every exit against every key.
+func MatchExitSigners(exits []SignedVoluntaryExit, pubkeys []BLSPubkey, network Network) ([]*BLSPubkey, error) {
+	type candidate struct {
+		pubkey BLSPubkey
+		point  bls12381.G1Affine
+	}
+	candidates := make([]candidate, len(pubkeys))
+	for i, pk := range pubkeys {
+		point, err := pubkeyPoint(pk)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pk, err)
+		}
+		candidates[i] = candidate{pubkey: pk, point: point}
+	}
+
+	signers := make([]*BLSPubkey, len(exits))
+	fresh := len(candidates)
+	for i := range exits {
+		s, err := signaturePoint(exits[i].Signature)
+		if err != nil {
+			continue
+		}
+		root := ExitSigningRoot(exits[i].Message, network)
+		h, err := bls12381.HashToG2(root[:], blsDST)
+		if err != nil {
+			return nil, err
+		}
+		for j := range candidates {
+			if pairingCheck(candidates[j].point, h, s) != nil {
+				continue
+			}
+			pk := candidates[j].pubkey
+			signers[i] = &pk
+			// Move the key behind the ones still waiting for their exit
+			if j < fresh {
+				fresh--
+				candidates[j], candidates[fresh] = candidates[fresh], candidates[j]
+			}
+			break
+		}
+	}
+	return signers, nil
+}
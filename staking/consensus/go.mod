@@ -0,0 +1,17 @@
+module consensus
+
+go 1.25.0
+
+require (
+	github.com/consensys/gnark-crypto v0.18.0
+	github.com/ethereum/go-ethereum v1.16.8
+)
+
+require (
+	github.com/ProjectZKM/Ziren/crates/go-runtime/zkvm_runtime v0.0.0-20251001021608-1fe7b43fc4d6 // indirect
+	github.com/bits-and-blooms/bitset v1.20.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	github.com/holiman/uint256 v1.3.2 // indirect
+	golang.org/x/crypto v0.36.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
+)
@@ -0,0 +1,94 @@
+package consensus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Network holds the parameters needed to compute signing domains for a
+// beacon chain and to reach its deposit contract
+type Network struct {
+	Name string
+	// GenesisForkVersion signs deposits on every fork
+	GenesisForkVersion [4]byte
+	// CapellaForkVersion signs every voluntary exit since Deneb (EIP-7044)
+	CapellaForkVersion    [4]byte
+	GenesisValidatorsRoot [32]byte
+	// GenesisTime is the start of slot 0
+	GenesisTime     time.Time
+	DepositContract common.Address
+}
+
+// Slot timing shared by every supported network
+const (
+	SecondsPerSlot = 12
+	SlotsPerEpoch  = 32
+)
+
+var (
+	// Mainnet is the Ethereum mainnet beacon chain
+	Mainnet = Network{
+		Name:                  "mainnet",
+		GenesisForkVersion:    [4]byte{0x00, 0x00, 0x00, 0x00},
+		CapellaForkVersion:    [4]byte{0x03, 0x00, 0x00, 0x00},
+		GenesisValidatorsRoot: common.HexToHash("0x4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"),
+		GenesisTime:           time.Unix(1606824023, 0).UTC(),
+		DepositContract:       common.HexToAddress("0x00000000219ab540356cBB839Cbe05303d7705Fa"),
+	}
+	// Holesky is the Holesky testnet beacon chain
+	Holesky = Network{
+		Name:                  "holesky",
+		GenesisForkVersion:    [4]byte{0x01, 0x01, 0x70, 0x00},
+		CapellaForkVersion:    [4]byte{0x04, 0x01, 0x70, 0x00},
+		GenesisValidatorsRoot: common.HexToHash("0x9143aa7c615a7f7115e2b6aac319c03529df8242ae705fba9df39b79c59fa8b1"),
+		GenesisTime:           time.Unix(1695902400, 0).UTC(),
+		DepositContract:       common.HexToAddress("0x4242424242424242424242424242424242424242"),
+	}
+	// Hoodi is the Hoodi testnet beacon chain
+	Hoodi = Network{
+		Name:                  "hoodi",
+		GenesisForkVersion:    [4]byte{0x10, 0x00, 0x09, 0x10},
+		CapellaForkVersion:    [4]byte{0x40, 0x00, 0x09, 0x10},
+		GenesisValidatorsRoot: common.HexToHash("0x212f13fc4df078b6cb7db228f1c8307566dcecf900867401a92023d7ba99cb5f"),
+		GenesisTime:           time.Unix(1742213400, 0).UTC(),
+		DepositContract:       common.HexToAddress("0x00000000219ab540356cBB839Cbe05303d7705Fa"),
+	}
+)
+
+// NetworkByName looks up one of the known networks
+func NetworkByName(name string) (Network, error) {
+	for _, n := range []Network{Mainnet, Holesky, Hoodi} {
+		if n.Name == name {
+			return n, nil
+		}
+	}
+	return Network{}, fmt.Errorf("unknown network %q", name)
+}
+
+// EpochAt returns the epoch in progress at t, or 0 before genesis
+func (n Network) EpochAt(t time.Time) uint64 {
+	if !t.After(n.GenesisTime) {
+		return 0
+	}
+	return uint64(t.Sub(n.GenesisTime)/time.Second) / (SecondsPerSlot * SlotsPerEpoch)
+}
+
+// computeDomain is compute_domain from the consensus specs
+func computeDomain(domainType, forkVersion [4]byte, genesisValidatorsRoot [32]byte) [32]byte {
+	var forkData [64]byte
+	copy(forkData[0:4], forkVersion[:])
+	copy(forkData[32:64], genesisValidatorsRoot[:])
+	forkDataRoot := sha256Sum(forkData[:])
+
+	var domain [32]byte
+	copy(domain[0:4], domainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+	return domain
+}
+
+// signingRoot is compute_signing_root: the root of SigningData
+func signingRoot(objectRoot, domain [32]byte) [32]byte {
+	return sha256Sum(objectRoot[:], domain[:])
+}
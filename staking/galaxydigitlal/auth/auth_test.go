@@ -0,0 +1,389 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"galaxydigital/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const apiKey = "test-api-key"
+
+var testKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+func config() auth.AuthConfig {
+	return auth.AuthConfig{
+		PrivateKey:    testKey,
+		SigningMethod: jwt.SigningMethodRS256,
+		TokenDuration: auth.MaxTokenDuration,
+		ApiKey:        apiKey,
+	}
+}
+
+func verifier(t *testing.T, now func() time.Time) *auth.Verifier {
+	t.Helper()
+	v, err := auth.NewVerifier(auth.VerifierConfig{PublicKey: &testKey.PublicKey, ApiKey: apiKey, Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// signedRequest is a request to path with body as AuthRoundTripper would
+// send it
+func signedRequest(t *testing.T, path, body string) *http.Request {
+	t.Helper()
+	token, err := config().SignToken(path, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("X-API-KEY", apiKey)
+	return r
+}
+
+func TestRoundTripperPassesVerifier(t *testing.T) {
+	v := verifier(t, nil)
+	var got *auth.AuthClaims
+	var gotBody string
+	srv := httptest.NewServer(v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.ClaimsFromContext(r.Context())
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	})))
+	defer srv.Close()
+
+	rt, err := auth.NewAuthRoundTripper(config(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+	for range 2 {
+		resp, err := client.Post(srv.URL+"/v1/stake", "application/json", strings.NewReader(`{"amount":"32"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+	if got == nil || got.URI != "/v1/stake" || got.Sub != apiKey || gotBody != `{"amount":"32"}` {
+		t.Fatalf("unexpected claims %+v, body %q", got, gotBody)
+	}
+
+	resp, err := client.Get(srv.URL + "/v1/validators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 without a body, got %d", resp.StatusCode)
+	}
+}
+
+func TestVerifierRejects(t *testing.T) {
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	sign := func(method jwt.SigningMethod, key any, claims auth.AuthClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	claims := func(window time.Duration) auth.AuthClaims {
+		now := time.Now()
+		return auth.AuthClaims{
+			URI: "/v1/stake", Nonce: "n", Sub: apiKey, BodyHash: auth.HashBody([]byte("{}")),
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(window)),
+			},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		request func() *http.Request
+		now     func() time.Time
+		want    error
+	}{
+		"no token": {
+			request: func() *http.Request { return httptest.NewRequest(http.MethodGet, "/v1/stake", nil) },
+			want:    auth.ErrMissingToken,
+		},
+		"other key": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.Header.Set("Authorization", "Bearer "+sign(jwt.SigningMethodRS256, otherKey, claims(10*time.Second)))
+				return r
+			},
+			want: auth.ErrInvalidToken,
+		},
+		"hmac": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.Header.Set("Authorization", "Bearer "+sign(jwt.SigningMethodHS256, []byte("secret"), claims(10*time.Second)))
+				return r
+			},
+			want: auth.ErrInvalidToken,
+		},
+		"long window": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.Header.Set("Authorization", "Bearer "+sign(jwt.SigningMethodRS256, testKey, claims(time.Minute)))
+				return r
+			},
+			want: auth.ErrTokenWindow,
+		},
+		"expired": {
+			request: func() *http.Request { return signedRequest(t, "/v1/stake", "{}") },
+			now:     func() time.Time { return time.Now().Add(time.Minute) },
+			want:    auth.ErrTokenWindow,
+		},
+		"body changed": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.Body = io.NopCloser(strings.NewReader(`{"amount":"64"}`))
+				return r
+			},
+			want: auth.ErrBodyHash,
+		},
+		"other uri": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.URL.Path = "/v1/exit"
+				return r
+			},
+			want: auth.ErrURI,
+		},
+		"api key header": {
+			request: func() *http.Request {
+				r := signedRequest(t, "/v1/stake", "{}")
+				r.Header.Set("X-API-KEY", "someone-else")
+				return r
+			},
+			want: auth.ErrAPIKey,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier(t, tc.now).Verify(tc.request())
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifierRejectsReplay(t *testing.T) {
+	v := verifier(t, nil)
+	r := signedRequest(t, "/v1/stake", "{}")
+	replay := r.Clone(r.Context())
+	replay.Body = io.NopCloser(strings.NewReader("{}"))
+
+	if _, err := v.Verify(r); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := v.Verify(replay); !errors.Is(err, auth.ErrReplay) {
+		t.Fatalf("expected a replay to be refused, got %v", err)
+	}
+}
+
+func TestECDSAKeysSignES256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cfg := auth.AuthConfig{PrivateKey: key, TokenDuration: 10 * time.Second, ApiKey: apiKey}
+	token, err := cfg.SignToken("/v1/stake", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &auth.AuthClaims{})
+	if parsed.Method.Alg() != "ES256" {
+		t.Fatalf("expected ES256, got %s", parsed.Method.Alg())
+	}
+
+	v, err := auth.NewVerifier(auth.VerifierConfig{PublicKey: &key.PublicKey, ApiKey: apiKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v1/stake", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("X-API-KEY", apiKey)
+	if _, err := v.Verify(r); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// An RSA verifier does not accept an ES256 token, even for the same claims
+	if _, err := verifier(t, nil).Verify(r); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected ES256 to be refused by an RSA verifier, got %v", err)
+	}
+
+	cfg.SigningMethod = jwt.SigningMethodRS256
+	if _, err := cfg.SignToken("/v1/stake", nil); err == nil {
+		t.Fatalf("expected RS256 with an ECDSA key to be refused")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldKid, _ := auth.KeyID(oldKey.Public())
+	newKid, _ := auth.KeyID(newKey.Public())
+
+	keys, err := auth.NewKeySet(oldKid, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := auth.NewVerifier(auth.VerifierConfig{PublicKeys: map[string]crypto.PublicKey{oldKid: oldKey.Public()}, ApiKey: apiKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signWith := func(keys *auth.KeySet) (*http.Request, string) {
+		t.Helper()
+		cfg := auth.AuthConfig{Keys: keys, TokenDuration: 10 * time.Second, ApiKey: apiKey}
+		token, err := cfg.SignToken("/v1/stake", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, _ := jwt.NewParser().ParseUnverified(token, &auth.AuthClaims{})
+		r := httptest.NewRequest(http.MethodGet, "/v1/stake", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("X-API-KEY", apiKey)
+		return r, parsed.Header["kid"].(string)
+	}
+	sign := func() (*http.Request, string) { return signWith(keys) }
+
+	before, kid := sign()
+	if kid != oldKid {
+		t.Fatalf("expected kid %s, got %s", oldKid, kid)
+	}
+
+	// The new key is registered before it signs anything
+	if err := keys.Add(newKid, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Schedule(newKid, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, kid := sign(); kid != newKid {
+		t.Fatalf("expected the due rotation to sign with %s, got %s", newKid, kid)
+	}
+	after, _ := sign()
+	if _, err := v.Verify(after); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected an unregistered kid to be refused, got %v", err)
+	}
+	if err := v.AddKey(newKid, newKey.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(after); err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+
+	// Tokens signed before the rotation verify until the old key is revoked
+	if err := keys.Remove(newKid); err == nil {
+		t.Fatalf("expected the active key to be kept")
+	}
+	if err := keys.Remove(oldKid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(before); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// A holder of the old key can still sign until the verifier revokes it
+	oldKeys, err := auth.NewKeySet(oldKid, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := signWith(oldKeys)
+	if _, err := v.Verify(fresh); err != nil {
+		t.Fatalf("old key before revocation: %v", err)
+	}
+	late, kid := signWith(oldKeys)
+	if kid != oldKid {
+		t.Fatalf("expected kid %s, got %s", oldKid, kid)
+	}
+	v.RemoveKey(oldKid)
+	if _, err := v.Verify(late); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected a revoked kid to be refused, got %v", err)
+	}
+}
+
+func TestRoundTripperStreamsBodyAndLogs(t *testing.T) {
+	srv := httptest.NewServer(verifier(t, nil).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	cfg := config()
+	cfg.Logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	rt, err := auth.NewAuthRoundTripper(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+
+	body := strings.Repeat("x", 1<<20)
+	ctx := auth.WithLogAttrs(context.Background(), slog.String("job", "stake-1"))
+	for name, newBody := range map[string]func() io.Reader{
+		// http.NewRequest sets GetBody for a strings.Reader, so it is hashed from a copy
+		"streamed": func() io.Reader { return strings.NewReader(body) },
+		// without GetBody the body is buffered once
+		"buffered": func() io.Reader { return io.MultiReader(strings.NewReader(body)) },
+	} {
+		logs.Reset()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1/stake", newBody())
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", name, resp.StatusCode)
+		}
+
+		var record struct {
+			Msg      string `json:"msg"`
+			URI      string `json:"uri"`
+			BodyHash string `json:"body_hash"`
+			BodySize int64  `json:"body_size"`
+			Streamed bool   `json:"body_streamed"`
+			Job      string `json:"job"`
+		}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("%s: log %q: %v", name, logs.String(), err)
+		}
+		if record.Msg != "galaxy request signed" || record.URI != "/v1/stake" || record.Job != "stake-1" ||
+			record.BodySize != 1<<20 || record.BodyHash != auth.Base64Encoding.Hash([]byte(body)) ||
+			record.Streamed != (name == "streamed") {
+			t.Fatalf("%s: unexpected log record %+v", name, record)
+		}
+	}
+
+	// Base64 is the default; a hex verifier refuses it
+	hexVerifier, err := auth.NewVerifier(auth.VerifierConfig{PublicKey: &testKey.PublicKey, ApiKey: apiKey, BodyHashEncoding: auth.HexEncoding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/v1/stake", strings.NewReader("{}"))
+	token, _ := cfg.SignToken("/v1/stake", []byte("{}"))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("X-API-KEY", apiKey)
+	if _, err := hexVerifier.Verify(r); !errors.Is(err, auth.ErrBodyHash) {
+		t.Fatalf("expected a base64 hash to be refused by a hex verifier, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningMethodFor picks the JWT algorithm for a private or public key:
+// RS256 for RSA, and ES256, ES384 or ES512 by ECDSA curve
+func SigningMethodFor(key any) (jwt.SigningMethod, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", key.Curve.Params().Name)
+	default:
+		return nil, fmt.Errorf("unsupported signing key %T", key)
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyID derives a key ID from a public key: the unpadded base64url SHA-256
+// of its PKIX encoding, so both sides compute the same kid for a key
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicKeyPEM encodes the public half of key as a PKIX "PUBLIC KEY" PEM
+// block, the form a key is registered with Galaxy in
+func PublicKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// KeySet holds the signing keys of an API key by kid and which one signs.
+// Keys can be added ahead of time and activated explicitly or at a
+// scheduled time, so a new key is registered with Galaxy before it is used
+// and the old one stays valid for requests already signed with it.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     map[string]crypto.Signer
+	active   string
+	schedule []rotation
+	now      func() time.Time
+}
+
+type rotation struct {
+	kid string
+	at  time.Time
+}
+
+// NewKeySet returns a set that signs with key under kid
+func NewKeySet(kid string, key crypto.Signer) (*KeySet, error) {
+	s := &KeySet{keys: make(map[string]crypto.Signer), now: time.Now}
+	if err := s.Add(kid, key); err != nil {
+		return nil, err
+	}
+	s.active = kid
+	return s, nil
+}
+
+// Add makes key available under kid without signing with it
+func (s *KeySet) Add(kid string, key crypto.Signer) error {
+	if kid == "" {
+		return errors.New("key ID is not set")
+	}
+	if _, err := SigningMethodFor(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keys[kid]; exists {
+		return fmt.Errorf("key %s is already in the set", kid)
+	}
+	s.keys[kid] = key
+	return nil
+}
+
+// Activate signs with kid from now on. Requests already signed keep the
+// key they were signed with.
+func (s *KeySet) Activate(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[kid]; !ok {
+		return fmt.Errorf("unknown key %s", kid)
+	}
+	s.active = kid
+	return nil
+}
+
+// Schedule activates kid at at
+func (s *KeySet) Schedule(kid string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[kid]; !ok {
+		return fmt.Errorf("unknown key %s", kid)
+	}
+	s.schedule = append(s.schedule, rotation{kid: kid, at: at})
+	sort.Slice(s.schedule, func(a, b int) bool { return s.schedule[a].at.Before(s.schedule[b].at) })
+	return nil
+}
+
+// Remove drops a key that no longer signs. The active key, and a key with
+// a rotation still scheduled, cannot be removed.
+func (s *KeySet) Remove(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate()
+	if kid == s.active {
+		return fmt.Errorf("key %s is active", kid)
+	}
+	for _, r := range s.schedule {
+		if r.kid == kid {
+			return fmt.Errorf("key %s is scheduled to activate at %s", kid, r.at)
+		}
+	}
+	delete(s.keys, kid)
+	return nil
+}
+
+// Current returns the key that signs now and its kid
+func (s *KeySet) Current() (string, crypto.Signer) {
+	s.mu.RLock()
+	due := len(s.schedule) > 0 && !s.now().Before(s.schedule[0].at)
+	if !due {
+		defer s.mu.RUnlock()
+		return s.active, s.keys[s.active]
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate()
+	return s.active, s.keys[s.active]
+}
+
+// rotate applies scheduled rotations that are due. It must be called with
+// s.mu held for writing.
+func (s *KeySet) rotate() {
+	now := s.now()
+	for len(s.schedule) > 0 && !now.Before(s.schedule[0].at) {
+		s.active = s.schedule[0].kid
+		s.schedule = s.schedule[1:]
+	}
+}
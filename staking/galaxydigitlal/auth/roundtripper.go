@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type AuthConfig struct {
+	// PrivateKey is an RSA or ECDSA key, e.g. from secretmanager/keys
+	PrivateKey crypto.Signer
+	// SigningMethod defaults to SigningMethodFor(PrivateKey)
+	SigningMethod jwt.SigningMethod
+	// Keys replaces PrivateKey and SigningMethod with a rotating key set;
+	// tokens then carry the signing key's kid header
+	Keys          *KeySet
+	TokenDuration time.Duration
+	ApiKey        string
+	// BodyHashEncoding is how bodyHash is written, base64 by default
+	BodyHashEncoding BodyHashEncoding
+	// Logger gets a debug record for every request AuthRoundTripper signs,
+	// slog.Default() if nil
+	Logger *slog.Logger
+}
+
+func (c AuthConfig) validate() error {
+	switch {
+	case c.Keys != nil && c.PrivateKey != nil:
+		return errors.New("set a private key or a key set, not both")
+	case c.Keys == nil && c.PrivateKey == nil:
+		return errors.New("private key is not set")
+	case c.PrivateKey != nil:
+		method, err := SigningMethodFor(c.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if c.SigningMethod != nil && c.SigningMethod.Alg() != method.Alg() {
+			return fmt.Errorf("signing method %s does not match the %s key", c.SigningMethod.Alg(), method.Alg())
+		}
+	}
+	if c.TokenDuration > MaxTokenDuration {
+		return errors.New("token duration cannot be longer than 30 seconds")
+	}
+	if c.TokenDuration <= 0 {
+		return errors.New("token duration must be positive")
+	}
+	if c.ApiKey == "" {
+		return errors.New("API key is not set")
+	}
+	return c.BodyHashEncoding.validate()
+}
+
+// SignToken returns a bearer token for a request to uri carrying body
+func (c AuthConfig) SignToken(uri string, body []byte) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	signed, _, err := c.sign(uri, c.BodyHashEncoding.Hash(body))
+	return signed, err
+}
+
+// sign returns a token for uri and an already encoded body hash, and the
+// claims and kid it carries
+func (c AuthConfig) sign(uri, bodyHash string) (string, signedToken, error) {
+	now := time.Now()
+	claims := AuthClaims{
+		URI:      uri,
+		Nonce:    uuid.NewString(),
+		Sub:      c.ApiKey,
+		BodyHash: bodyHash,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(c.TokenDuration)),
+		},
+	}
+
+	key, method, kid := c.PrivateKey, c.SigningMethod, ""
+	if c.Keys != nil {
+		kid, key = c.Keys.Current()
+		method = nil
+	}
+	if method == nil {
+		method, _ = SigningMethodFor(key)
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", signedToken{}, fmt.Errorf("failed to sign Auth token: %w", err)
+	}
+	return signed, signedToken{claims: claims, kid: kid, alg: method.Alg()}, nil
+}
+
+// signedToken describes a token for logging
+type signedToken struct {
+	claims AuthClaims
+	kid    string
+	alg    string
+}
+
+// AuthRoundTripper signs every request it sends with a fresh token
+type AuthRoundTripper struct {
+	base   http.RoundTripper
+	opts   AuthConfig
+	logger *slog.Logger
+}
+
+func NewAuthRoundTripper(opts AuthConfig, baseRoundTripper http.RoundTripper) (*AuthRoundTripper, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if baseRoundTripper == nil {
+		baseRoundTripper = http.DefaultTransport
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &AuthRoundTripper{
+		base:   baseRoundTripper,
+		opts:   opts,
+		logger: logger,
+	}, nil
+}
+
+func (b *AuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the caller's request
+	ctx := req.Context()
+	req = req.Clone(ctx)
+
+	bodyHash, size, streamed, err := b.hashBody(req)
+	if err != nil {
+		return nil, err
+	}
+	bearer, token, err := b.opts.sign(req.URL.Path, bodyHash)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req.Header.Set("X-API-KEY", b.opts.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	if b.logger.Enabled(ctx, slog.LevelDebug) {
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("uri", token.claims.URI),
+			slog.String("nonce", token.claims.Nonce),
+			slog.String("alg", token.alg),
+			slog.String("body_hash", bodyHash),
+			slog.Int64("body_size", size),
+			slog.Bool("body_streamed", streamed),
+		}
+		if token.kid != "" {
+			attrs = append(attrs, slog.String("kid", token.kid))
+		}
+		attrs = append(attrs, logAttrs(ctx)...)
+		b.logger.LogAttrs(ctx, slog.LevelDebug, "galaxy request signed", attrs...)
+	}
+
+	return b.base.RoundTrip(req)
+}
+
+// hashBody hashes the body of req. With GetBody, as set by
+// http.NewRequest, the hash is taken from a fresh copy of the body and
+// req.Body is sent untouched; otherwise the body is read into memory once
+// and req gets a replayable copy of it.
+func (b *AuthRoundTripper) hashBody(req *http.Request) (hash string, size int64, streamed bool, err error) {
+	enc := b.opts.BodyHashEncoding
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", 0, false, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to read request body: %w", err)
+		}
+		defer body.Close()
+		hash, size, err := enc.HashReader(body)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to read request body: %w", err)
+		}
+		return hash, size, true, nil
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return "", 0, false, err
+	}
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return enc.Hash(body), int64(len(body)), false, nil
+}
+
+// readBody reads and restores the request body so it can be hashed
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type logAttrsKey struct{}
+
+// WithLogAttrs returns a context whose requests AuthRoundTripper logs with
+// attrs added, e.g. a job or validator ID
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	attrs = append(slices.Clip(logAttrs(ctx)), attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+func logAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Verification failures. Every error Verify returns wraps one of these.
+var (
+	ErrMissingToken = errors.New("auth: missing bearer token")
+	ErrInvalidToken = errors.New("auth: invalid token")
+	ErrTokenWindow  = errors.New("auth: token outside its validity window")
+	ErrAPIKey       = errors.New("auth: API key mismatch")
+	ErrURI          = errors.New("auth: token signed for another uri")
+	ErrBodyHash     = errors.New("auth: body hash mismatch")
+	ErrReplay       = errors.New("auth: nonce already used")
+)
+
+type VerifierConfig struct {
+	// PublicKey is the registered RSA or ECDSA key for tokens without a kid
+	PublicKey crypto.PublicKey
+	// PublicKeys are registered keys by kid; see also Verifier.AddKey
+	PublicKeys map[string]crypto.PublicKey
+	ApiKey     string
+	// BodyHashEncoding is how clients write bodyHash, base64 by default
+	BodyHashEncoding BodyHashEncoding
+	// Leeway absorbs clock skew between client and server (default 5s)
+	Leeway time.Duration
+	// Now is the clock, time.Now by default
+	Now func() time.Time
+}
+
+// Verifier checks requests signed by AuthRoundTripper the way Galaxy does:
+// a signature by the registered key in the algorithm its type implies, exp
+// no more than MaxTokenDuration after iat, sub and X-API-KEY naming the API
+// key, uri and bodyHash matching the request, and a nonce not seen before
+type Verifier struct {
+	cfg VerifierConfig
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	// nonces maps each nonce seen to the expiry of its token; a nonce can
+	// be forgotten once its token could no longer verify
+	nonces map[string]time.Time
+}
+
+func NewVerifier(cfg VerifierConfig) (*Verifier, error) {
+	if cfg.PublicKey == nil && len(cfg.PublicKeys) == 0 {
+		return nil, errors.New("public key is not set")
+	}
+	if cfg.PublicKey != nil {
+		if _, err := SigningMethodFor(cfg.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	v := &Verifier{keys: make(map[string]crypto.PublicKey), nonces: make(map[string]time.Time)}
+	for kid, pub := range cfg.PublicKeys {
+		if err := v.AddKey(kid, pub); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ApiKey == "" {
+		return nil, errors.New("API key is not set")
+	}
+	if err := cfg.BodyHashEncoding.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = 5 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	v.cfg = cfg
+	return v, nil
+}
+
+// AddKey registers pub under kid, e.g. ahead of a client's key rotation
+func (v *Verifier) AddKey(kid string, pub crypto.PublicKey) error {
+	if _, err := SigningMethodFor(pub); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[kid] = pub
+	return nil
+}
+
+// RemoveKey revokes kid
+func (v *Verifier) RemoveKey(kid string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.keys, kid)
+}
+
+// key finds the key a token names in its kid header and checks the token
+// uses the algorithm that key implies
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	pub := v.cfg.PublicKey
+	if kid, ok := token.Header["kid"].(string); ok {
+		v.mu.Lock()
+		pub, ok = v.keys[kid]
+		v.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+	}
+	if pub == nil {
+		return nil, errors.New("token has no kid")
+	}
+	method, _ := SigningMethodFor(pub)
+	if token.Method.Alg() != method.Alg() {
+		return nil, fmt.Errorf("token is signed with %s, key needs %s", token.Method.Alg(), method.Alg())
+	}
+	return pub, nil
+}
+
+// Verify checks the token on r against r itself and returns its claims.
+// The body is read and restored.
+func (v *Verifier) Verify(r *http.Request) (*AuthClaims, error) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || bearer == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims := &AuthClaims{}
+	_, err := jwt.ParseWithClaims(bearer, claims,
+		v.key,
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.cfg.Leeway),
+		jwt.WithTimeFunc(v.cfg.Now),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return nil, fmt.Errorf("%w: %v", ErrTokenWindow, err)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: iat is required", ErrInvalidToken)
+	}
+	if window := claims.ExpiresAt.Sub(claims.IssuedAt.Time); window <= 0 || window > MaxTokenDuration {
+		return nil, fmt.Errorf("%w: exp is %s after iat, limit is %s", ErrTokenWindow, window, MaxTokenDuration)
+	}
+
+	if claims.Sub != v.cfg.ApiKey || r.Header.Get("X-API-KEY") != v.cfg.ApiKey {
+		return nil, ErrAPIKey
+	}
+	if claims.URI != r.URL.Path {
+		return nil, fmt.Errorf("%w: signed for %q, request is %q", ErrURI, claims.URI, r.URL.Path)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if claims.BodyHash != v.cfg.BodyHashEncoding.Hash(body) {
+		return nil, ErrBodyHash
+	}
+	if claims.Nonce == "" {
+		return nil, fmt.Errorf("%w: nonce is required", ErrInvalidToken)
+	}
+	if err := v.useNonce(claims.Nonce, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// useNonce records nonce, failing if it was already used
+func (v *Verifier) useNonce(nonce string, exp time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.cfg.Now()
+	for n, until := range v.nonces {
+		if now.After(until.Add(v.cfg.Leeway)) {
+			delete(v.nonces, n)
+		}
+	}
+	if _, used := v.nonces[nonce]; used {
+		return ErrReplay
+	}
+	v.nonces[nonce] = exp
+	return nil
+}
+
+type claimsKey struct{}
+
+// Middleware rejects requests that fail Verify with 401 and passes the
+// claims of the rest to next; see ClaimsFromContext
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.Verify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+// ClaimsFromContext returns the claims Middleware verified
+func ClaimsFromContext(ctx context.Context) (*AuthClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*AuthClaims)
+	return claims, ok
+}
@@ -0,0 +1,346 @@
+// Package galaxyclient calls the Galaxy staking API. Every request is signed
+// by auth.AuthRoundTripper.
+package galaxyclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"galaxydigital/auth"
+)
+
+const (
+	// BaseURL is the Galaxy staking API
+	BaseURL = "https://api.staking.galaxy.com"
+
+	stakePath      = "/v1/stake"
+	validatorsPath = "/v1/validators"
+	rewardsPath    = "/v1/rewards"
+)
+
+/*
+   ---------- CLIENT ----------
+*/
+
+// Client talks to the Galaxy staking API
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for baseURL that signs requests with config
+func NewClient(baseURL string, config auth.AuthConfig) (*Client, error) {
+	rt, err := auth.NewAuthRoundTripper(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Transport: rt, Timeout: 15 * time.Second},
+	}, nil
+}
+
+/*
+   ---------- ERRORS ----------
+*/
+
+// Error codes the API returns
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeNotFound       = "NOT_FOUND"
+	CodeAlreadyExiting = "ALREADY_EXITING"
+)
+
+// APIError is returned when the API answers with a non-2xx status
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// Body is the raw response when it did not carry a structured error
+	Body string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("galaxy: API returned status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("galaxy: API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsCode reports whether err is an APIError with code
+func IsCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+type errorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+/*
+   ---------- REQUESTS ----------
+*/
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do executes req and decodes the response into T
+func do[T any](c *Client, req *http.Request) (*T, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{Body: string(body)}
+		var env errorEnvelope
+		if json.Unmarshal(body, &env) == nil && env.Error != nil {
+			apiErr = env.Error
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return nil, apiErr
+	}
+
+	var result T
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("galaxyclient: decode %s response: %w", req.URL.Path, err)
+	}
+	return &result, nil
+}
+
+/*
+   ---------- STAKING ----------
+*/
+
+// Networks the API stakes on
+const (
+	NetworkMainnet = "mainnet"
+	NetworkHolesky = "holesky"
+	NetworkHoodi   = "hoodi"
+)
+
+// CreateStakeRequest asks Galaxy to set up validators. Amount is in gwei
+// per validator.
+type CreateStakeRequest struct {
+	Network             string `json:"network"`
+	ValidatorCount      int    `json:"validatorCount"`
+	AmountPerValidator  string `json:"amountPerValidator"`
+	WithdrawalAddress   string `json:"withdrawalAddress"`
+	FeeRecipientAddress string `json:"feeRecipientAddress,omitempty"`
+}
+
+// Validate checks the request before it is sent
+func (r CreateStakeRequest) Validate() error {
+	switch {
+	case r.Network != NetworkMainnet && r.Network != NetworkHolesky && r.Network != NetworkHoodi:
+		return fmt.Errorf("galaxyclient: unknown network %q", r.Network)
+	case r.ValidatorCount < 1:
+		return errors.New("galaxyclient: validatorCount must be at least 1")
+	case r.AmountPerValidator == "":
+		return errors.New("galaxyclient: amountPerValidator is required")
+	case !isHexAddress(r.WithdrawalAddress):
+		return fmt.Errorf("galaxyclient: withdrawalAddress %q is not a hex address", r.WithdrawalAddress)
+	case r.FeeRecipientAddress != "" && !isHexAddress(r.FeeRecipientAddress):
+		return fmt.Errorf("galaxyclient: feeRecipientAddress %q is not a hex address", r.FeeRecipientAddress)
+	}
+	return nil
+}
+
+// Stake is a stake request and the validators created for it
+type Stake struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"`
+	Network    string      `json:"network"`
+	Validators []Validator `json:"validators"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+// Validator statuses
+const (
+	ValidatorPending = "pending"
+	ValidatorActive  = "active"
+	ValidatorExiting = "exiting"
+	ValidatorExited  = "exited"
+)
+
+// Validator is one validator Galaxy runs. DepositData is set until the
+// deposit is seen on chain.
+type Validator struct {
+	Pubkey            string       `json:"pubkey"`
+	Index             *uint64      `json:"index,omitempty"`
+	Status            string       `json:"status"`
+	Network           string       `json:"network"`
+	WithdrawalAddress string       `json:"withdrawalAddress"`
+	DepositData       *DepositData `json:"depositData,omitempty"`
+}
+
+// DepositData is a validator's signed deposit, hex fields 0x-prefixed
+type DepositData struct {
+	WithdrawalCredentials string `json:"withdrawalCredentials"`
+	Amount                string `json:"amount"`
+	Signature             string `json:"signature"`
+	DepositDataRoot       string `json:"depositDataRoot"`
+}
+
+// CreateStake asks Galaxy to set up validators
+func (c *Client) CreateStake(ctx context.Context, request CreateStakeRequest) (*Stake, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, stakePath, nil, request)
+	if err != nil {
+		return nil, err
+	}
+	return do[Stake](c, req)
+}
+
+// GetStake returns a stake request by ID
+func (c *Client) GetStake(ctx context.Context, id string) (*Stake, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, stakePath+"/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do[Stake](c, req)
+}
+
+// ListValidatorsOptions filters ListValidators; zero fields match all
+type ListValidatorsOptions struct {
+	Network string
+	Status  string
+	// Cursor continues from ValidatorPage.NextCursor
+	Cursor string
+	Limit  int
+}
+
+// ValidatorPage is one page of validators
+type ValidatorPage struct {
+	Validators []Validator `json:"validators"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// ListValidators returns a page of validators. The filters travel in the
+// query, which the request token does not sign.
+func (c *Client) ListValidators(ctx context.Context, opts ListValidatorsOptions) (*ValidatorPage, error) {
+	query := url.Values{}
+	for k, v := range map[string]string{"network": opts.Network, "status": opts.Status, "cursor": opts.Cursor} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", fmt.Sprint(opts.Limit))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, validatorsPath, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do[ValidatorPage](c, req)
+}
+
+// ExitRequest asks Galaxy to exit validators
+type ExitRequest struct {
+	Pubkeys []string `json:"pubkeys"`
+}
+
+// Exit is an accepted exit request
+type Exit struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"`
+	Validators []Validator `json:"validators"`
+}
+
+// RequestExit asks Galaxy to exit validators
+func (c *Client) RequestExit(ctx context.Context, request ExitRequest) (*Exit, error) {
+	if len(request.Pubkeys) == 0 {
+		return nil, errors.New("galaxyclient: no validators to exit")
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, validatorsPath+"/exit", nil, request)
+	if err != nil {
+		return nil, err
+	}
+	return do[Exit](c, req)
+}
+
+// RewardsOptions picks the validator and the period of GetRewards
+type RewardsOptions struct {
+	Pubkey string
+	From   time.Time
+	To     time.Time
+}
+
+// Rewards are a validator's earnings over a period, in gwei
+type Rewards struct {
+	Pubkey           string    `json:"pubkey"`
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	ConsensusRewards string    `json:"consensusRewards"`
+	ExecutionRewards string    `json:"executionRewards"`
+	TotalRewards     string    `json:"totalRewards"`
+}
+
+// GetRewards returns a validator's rewards over a period. The period
+// travels in the query, which the request token does not sign.
+func (c *Client) GetRewards(ctx context.Context, opts RewardsOptions) (*Rewards, error) {
+	if opts.Pubkey == "" {
+		return nil, errors.New("galaxyclient: rewards need a pubkey")
+	}
+	if !opts.To.IsZero() && opts.To.Before(opts.From) {
+		return nil, errors.New("galaxyclient: rewards period ends before it starts")
+	}
+	query := url.Values{}
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.UTC().Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.UTC().Format(time.RFC3339))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, rewardsPath+"/"+url.PathEscape(opts.Pubkey), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do[Rewards](c, req)
+}
+
+func isHexAddress(s string) bool {
+	s, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package galaxyclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	galaxyclient "galaxydigital/client"
+	"galaxydigital/galaxytest"
+)
+
+const withdrawal = "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17"
+
+func TestStakeExitAndRewards(t *testing.T) {
+	srv := galaxytest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	stake, err := client.CreateStake(ctx, galaxyclient.CreateStakeRequest{
+		Network:            galaxyclient.NetworkHoodi,
+		ValidatorCount:     3,
+		AmountPerValidator: "32000000000",
+		WithdrawalAddress:  withdrawal,
+	})
+	if err != nil {
+		t.Fatalf("create stake: %v", err)
+	}
+	if len(stake.Validators) != 3 || stake.Validators[0].DepositData == nil {
+		t.Fatalf("unexpected stake %+v", stake)
+	}
+	pubkey := stake.Validators[0].Pubkey
+
+	// Exiting a validator that is not active yet is refused
+	if _, err := client.RequestExit(ctx, galaxyclient.ExitRequest{Pubkeys: []string{pubkey}}); !galaxyclient.IsCode(err, galaxyclient.CodeInvalidRequest) {
+		t.Fatalf("expected a pending validator to be refused, got %v", err)
+	}
+	if err := srv.SetValidatorStatus(pubkey, galaxyclient.ValidatorActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SetValidatorStatus(stake.Validators[1].Pubkey, galaxyclient.ValidatorActive); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.GetStake(ctx, stake.ID)
+	if err != nil || got.Validators[0].Status != galaxyclient.ValidatorActive || got.Validators[0].Index == nil {
+		t.Fatalf("get stake %+v: %v", got, err)
+	}
+	if got.Validators[1].Index == nil || *got.Validators[1].Index == *got.Validators[0].Index {
+		t.Fatalf("expected each active validator to get its own index, got %+v", got.Validators)
+	}
+
+	exit, err := client.RequestExit(ctx, galaxyclient.ExitRequest{Pubkeys: []string{pubkey}})
+	if err != nil || exit.Validators[0].Status != galaxyclient.ValidatorExiting {
+		t.Fatalf("exit %+v: %v", exit, err)
+	}
+	_, err = client.RequestExit(ctx, galaxyclient.ExitRequest{Pubkeys: []string{pubkey}})
+	var apiErr *galaxyclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Code != galaxyclient.CodeAlreadyExiting {
+		t.Fatalf("expected a second exit to conflict, got %v", err)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.SetRewards(galaxyclient.Rewards{Pubkey: pubkey, ConsensusRewards: "1500", ExecutionRewards: "500", TotalRewards: "2000"})
+	rewards, err := client.GetRewards(ctx, galaxyclient.RewardsOptions{Pubkey: pubkey, From: from, To: from.AddDate(0, 1, 0)})
+	if err != nil || rewards.TotalRewards != "2000" || !rewards.From.Equal(from) {
+		t.Fatalf("rewards %+v: %v", rewards, err)
+	}
+}
+
+func TestListValidatorsPages(t *testing.T) {
+	srv := galaxytest.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	for _, network := range []string{galaxyclient.NetworkHoodi, galaxyclient.NetworkHolesky} {
+		_, err := client.CreateStake(ctx, galaxyclient.CreateStakeRequest{
+			Network: network, ValidatorCount: 3, AmountPerValidator: "32000000000", WithdrawalAddress: withdrawal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	opts := galaxyclient.ListValidatorsOptions{Network: galaxyclient.NetworkHoodi, Limit: 2}
+	for {
+		page, err := client.ListValidators(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range page.Validators {
+			seen = append(seen, v.Pubkey)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected the 3 hoodi validators, got %d", len(seen))
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := galaxytest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Invalid requests are not sent
+	_, err := srv.Client().CreateStake(ctx, galaxyclient.CreateStakeRequest{Network: "sepolia", ValidatorCount: 1})
+	if err == nil || errors.As(err, new(*galaxyclient.APIError)) {
+		t.Fatalf("expected a local validation error, got %v", err)
+	}
+
+	if _, err := srv.Client().GetStake(ctx, "missing"); !galaxyclient.IsCode(err, galaxyclient.CodeNotFound) {
+		t.Fatalf("expected NOT_FOUND, got %v", err)
+	}
+
+	// A client with the wrong API key fails the server's verifier
+	config := srv.Config()
+	config.ApiKey = "someone-else"
+	client, err := galaxyclient.NewClient(srv.URL, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetStake(ctx, "stake-1")
+	var apiErr *galaxyclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
@@ -0,0 +1,383 @@
+// Package galaxytest provides an in-process stand-in for the Galaxy staking
+// API. It verifies every request the way Galaxy does, with auth.Verifier.
+// The routes, request checks and error codes follow the Galaxy staking API
+// reference rather than galaxyclient, so the client is tested against what
+// Galaxy accepts and not against itself.
+//
+// https://docs.staking.galaxy.com
+//
+// The uri claim signs only the request path, as the authentication docs
+// define it. The query filters of GET /v1/validators and GET
+// /v1/rewards/{pubkey} are therefore not covered by the token, and the
+// server applies whatever query arrives with a valid one.
+package galaxytest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"galaxydigital/auth"
+	galaxyclient "galaxydigital/client"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Server is a fake Galaxy staking API backed by in-memory state
+type Server struct {
+	*httptest.Server
+
+	// ApiKey and Key are the credentials the server accepts
+	ApiKey string
+	Key    *rsa.PrivateKey
+
+	verifier *auth.Verifier
+
+	mu         sync.Mutex
+	stakes     map[string]*galaxyclient.Stake
+	validators map[string]*galaxyclient.Validator
+	rewards    map[string]galaxyclient.Rewards
+	nextID     int
+	// nextIndex is the beacon index the next activated validator gets
+	nextIndex uint64
+}
+
+// NewServer starts a fake Galaxy API with a fresh signing key. Callers must
+// Close it.
+func NewServer() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ApiKey:     "galaxytest-" + randomHex(8),
+		Key:        key,
+		stakes:     make(map[string]*galaxyclient.Stake),
+		validators: make(map[string]*galaxyclient.Validator),
+		rewards:    make(map[string]galaxyclient.Rewards),
+		nextIndex:  500000,
+	}
+	verifier, err := auth.NewVerifier(auth.VerifierConfig{PublicKey: &key.PublicKey, ApiKey: s.ApiKey})
+	if err != nil {
+		panic(err)
+	}
+	s.verifier = verifier
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/stake", s.handleCreateStake)
+	mux.HandleFunc("GET /v1/stake/{id}", s.handleGetStake)
+	mux.HandleFunc("GET /v1/validators", s.handleListValidators)
+	mux.HandleFunc("POST /v1/validators/exit", s.handleExit)
+	mux.HandleFunc("GET /v1/rewards/{pubkey}", s.handleRewards)
+
+	s.Server = httptest.NewServer(verifier.Middleware(mux))
+	return s
+}
+
+// Config returns signing settings the server accepts
+func (s *Server) Config() auth.AuthConfig {
+	return auth.AuthConfig{
+		PrivateKey:    s.Key,
+		SigningMethod: jwt.SigningMethodRS256,
+		TokenDuration: auth.MaxTokenDuration,
+		ApiKey:        s.ApiKey,
+	}
+}
+
+// Client returns an API client for the server
+func (s *Server) Client() *galaxyclient.Client {
+	c, err := galaxyclient.NewClient(s.URL, s.Config())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// RegisterKey accepts tokens signed by pub under kid, as registering a
+// public key with Galaxy does
+func (s *Server) RegisterKey(kid string, pub crypto.PublicKey) error {
+	return s.verifier.AddKey(kid, pub)
+}
+
+// RevokeKey stops accepting tokens signed under kid
+func (s *Server) RevokeKey(kid string) {
+	s.verifier.RemoveKey(kid)
+}
+
+// SetValidatorStatus moves a validator to status
+func (s *Server) SetValidatorStatus(pubkey, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.validators[pubkey]
+	if !ok {
+		return fmt.Errorf("unknown validator %s", pubkey)
+	}
+	v.Status = status
+	if status != galaxyclient.ValidatorPending {
+		v.DepositData = nil
+	}
+	if status == galaxyclient.ValidatorActive && v.Index == nil {
+		index := s.nextIndex
+		s.nextIndex++
+		v.Index = &index
+	}
+	return nil
+}
+
+// SetRewards sets what GetRewards returns for pubkey
+func (s *Server) SetRewards(rewards galaxyclient.Rewards) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rewards[rewards.Pubkey] = rewards
+}
+
+/*
+   ---------- WIRE FORMAT ----------
+*/
+
+// Error codes the API returns
+const (
+	codeInvalidRequest = "INVALID_REQUEST"
+	codeNotFound       = "NOT_FOUND"
+	codeAlreadyExiting = "ALREADY_EXITING"
+)
+
+// apiError is the body of every non-2xx response, under "error"
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// networks are the networks POST /v1/stake accepts
+var networks = []string{"mainnet", "holesky", "hoodi"}
+
+// createStakeRequest is the body of POST /v1/stake
+type createStakeRequest struct {
+	Network             string `json:"network"`
+	ValidatorCount      int    `json:"validatorCount"`
+	AmountPerValidator  string `json:"amountPerValidator"`
+	WithdrawalAddress   string `json:"withdrawalAddress"`
+	FeeRecipientAddress string `json:"feeRecipientAddress"`
+}
+
+// validate returns the message Galaxy rejects req with, or "" if it is
+// accepted
+func (req createStakeRequest) validate() string {
+	switch {
+	case !slices.Contains(networks, req.Network):
+		return fmt.Sprintf("network must be one of %s", strings.Join(networks, ", "))
+	case req.ValidatorCount < 1:
+		return "validatorCount must be at least 1"
+	case !isAmount(req.AmountPerValidator):
+		return "amountPerValidator must be an integer amount of gwei"
+	case !isAddress(req.WithdrawalAddress):
+		return "withdrawalAddress must be a 0x-prefixed 20 byte address"
+	case req.FeeRecipientAddress != "" && !isAddress(req.FeeRecipientAddress):
+		return "feeRecipientAddress must be a 0x-prefixed 20 byte address"
+	}
+	return ""
+}
+
+// exitRequest is the body of POST /v1/validators/exit
+type exitRequest struct {
+	Pubkeys []string `json:"pubkeys"`
+}
+
+func isAmount(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+func isAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+/*
+   ---------- HANDLERS ----------
+*/
+
+func (s *Server) handleCreateStake(w http.ResponseWriter, r *http.Request) {
+	var req createStakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, msg)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	stake := &galaxyclient.Stake{
+		ID:        fmt.Sprintf("stake-%d", s.nextID),
+		Status:    "awaiting_deposit",
+		Network:   req.Network,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	creds := "0x010000000000000000000000" + req.WithdrawalAddress[2:]
+	for range req.ValidatorCount {
+		v := &galaxyclient.Validator{
+			Pubkey:            "0x" + randomHex(48),
+			Status:            galaxyclient.ValidatorPending,
+			Network:           req.Network,
+			WithdrawalAddress: req.WithdrawalAddress,
+			DepositData: &galaxyclient.DepositData{
+				WithdrawalCredentials: creds,
+				Amount:                req.AmountPerValidator,
+				Signature:             "0x" + randomHex(96),
+				DepositDataRoot:       "0x" + randomHex(32),
+			},
+		}
+		s.validators[v.Pubkey] = v
+		stake.Validators = append(stake.Validators, *v)
+	}
+	s.stakes[stake.ID] = stake
+	writeJSON(w, http.StatusCreated, stake)
+}
+
+func (s *Server) handleGetStake(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stake, ok := s.stakes[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "stake not found")
+		return
+	}
+	// Report the validators as they are now
+	current := *stake
+	current.Validators = nil
+	for _, v := range stake.Validators {
+		current.Validators = append(current.Validators, *s.validators[v.Pubkey])
+	}
+	writeJSON(w, http.StatusOK, current)
+}
+
+// handleListValidators filters on the query, which the token does not sign
+func (s *Server) handleListValidators(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var all []galaxyclient.Validator
+	for _, v := range s.validators {
+		if (q.Get("network") == "" || v.Network == q.Get("network")) && (q.Get("status") == "" || v.Status == q.Get("status")) {
+			all = append(all, *v)
+		}
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].Pubkey < all[b].Pubkey })
+
+	// The cursor is the last pubkey of the previous page
+	start := sort.Search(len(all), func(i int) bool { return all[i].Pubkey > q.Get("cursor") })
+	page := galaxyclient.ValidatorPage{Validators: all[start:min(start+limit, len(all))]}
+	if start+limit < len(all) {
+		page.NextCursor = page.Validators[len(page.Validators)-1].Pubkey
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleExit(w http.ResponseWriter, r *http.Request) {
+	var req exitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Pubkeys) == 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, "pubkeys are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every validator before exiting any
+	for _, pk := range req.Pubkeys {
+		v, ok := s.validators[pk]
+		switch {
+		case !ok:
+			writeError(w, http.StatusNotFound, codeNotFound, "validator "+pk+" not found")
+			return
+		case v.Status == galaxyclient.ValidatorExiting || v.Status == galaxyclient.ValidatorExited:
+			writeError(w, http.StatusConflict, codeAlreadyExiting, "validator "+pk+" is already exiting")
+			return
+		case v.Status != galaxyclient.ValidatorActive:
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "validator "+pk+" is not active")
+			return
+		}
+	}
+	s.nextID++
+	exit := galaxyclient.Exit{ID: fmt.Sprintf("exit-%d", s.nextID), Status: "submitted"}
+	for _, pk := range req.Pubkeys {
+		s.validators[pk].Status = galaxyclient.ValidatorExiting
+		exit.Validators = append(exit.Validators, *s.validators[pk])
+	}
+	writeJSON(w, http.StatusAccepted, exit)
+}
+
+// handleRewards reads the period from the query, which the token does not
+// sign
+func (s *Server) handleRewards(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pubkey := r.PathValue("pubkey")
+	if _, ok := s.validators[pubkey]; !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "validator "+pubkey+" not found")
+		return
+	}
+	rewards, ok := s.rewards[pubkey]
+	if !ok {
+		rewards = galaxyclient.Rewards{Pubkey: pubkey, ConsensusRewards: "0", ExecutionRewards: "0", TotalRewards: "0"}
+	}
+	for name, field := range map[string]*time.Time{"from": &rewards.From, "to": &rewards.To} {
+		if v := r.URL.Query().Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidRequest, name+" must be RFC 3339")
+				return
+			}
+			*field = t
+		}
+	}
+	writeJSON(w, http.StatusOK, rewards)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, map[string]any{"error": apiError{Code: code, Message: msg}})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"galaxydigital/auth"
+)
+
+// keygen writes a new private key in PKCS#8 PEM to -out and prints its kid
+// and the public key PEM to register with Galaxy
+func keygen(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.SetOutput(out)
+	keyType := fs.String("type", "rsa", "key type: rsa (RS256) or ecdsa (ES256)")
+	path := fs.String("out", "", "file to write the private key to (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("keygen: -out is required")
+	}
+
+	var key crypto.Signer
+	var err error
+	switch *keyType {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return fmt.Errorf("keygen: unknown key type %q", *keyType)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	// O_EXCL so an existing key is never overwritten
+	f, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	kid, err := auth.KeyID(key.Public())
+	if err != nil {
+		return err
+	}
+	pub, err := auth.PublicKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	method, _ := auth.SigningMethodFor(key)
+	fmt.Fprintf(out, "Wrote %s\nkid: %s\nalg: %s\n\n%s", *path, kid, method.Alg(), pub)
+	return nil
+}
@@ -1,21 +1,16 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/hex"
-	"encoding/pem"
-	"errors"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
 	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
+	"galaxydigital/auth"
+	galaxyclient "galaxydigital/client"
+
+	"secretmanager/keys"
 )
 
 const (
@@ -23,157 +18,106 @@ const (
 	devPrivateKeyFile = "keys/private_key.pem"
 )
 
-type JWTSignablePayload struct {
-	Url string `json:"url"`
-	// Nonce is a unique request ID
-	Nonce string `json:"nonce"`
-	// Iat is the request generated timestamp in UTC
-	Iat int64 `json:"iat"`
-	// Exp is the expiration timestamp of request in UTC (must be less than iat+ 30sec)
-	Exp int64 `json:"exp"`
-	// Sub is the API key shared by the BlueShift
-	Sub string `json:"sub"`
-	// BodyHash is the SHA256 hash of the request body if applicable.
-	BodyHash string `json:"bodyHash"`
-}
-
-// loadPrivateKey loads an RSA private key from PEM file
-func loadPrivateKey() (any, error) {
-	data, err := os.ReadFile(devPrivateKeyFile)
-	if err != nil {
-		return nil, err
-	}
-	block, _ := pem.Decode(data)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block containing private key")
-	}
-	return x509.ParsePKCS8PrivateKey(block.Bytes)
-}
-
 func main() {
-	if _, err := os.Stat(devPrivateKeyFile); os.IsNotExist(err) {
-		panic(err)
-	}
-
-	// Step 2: load private key from file
-	privateKey, err := loadPrivateKey()
+	// keygen: make a keypair to register with Galaxy before rotating to it
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		if err := keygen(os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Step 1: load the signing key from $GALAXY_SIGNING_KEY, a file path,
+	// env:<NAME> or a Secret Manager secret name, by default the dev key
+	// file; $GALAXY_SIGNING_KEY_PASSPHRASE unlocks an encrypted key
+	source := os.Getenv("GALAXY_SIGNING_KEY")
+	if source == "" {
+		source = devPrivateKeyFile
+	}
+	keySet, err := loadKeySet(source)
 	if err != nil {
 		panic(err)
 	}
 
-	// Step 3: build JWT claims
-	claims := jwt.MapClaims{
-		"uri":      "/v1/resource",
-		"nonce":    uuid.New().String(),
-		"iat":      time.Now().UTC().Unix(),
-		"exp":      time.Now().UTC().Add(30 * time.Second).Unix(),
-		"sub":      devApiKey,
-		"bodyHash": "BASE64_SHA256_OF_BODY",
+	// $GALAXY_NEXT_SIGNING_KEY, once registered with Galaxy, takes over at
+	// $GALAXY_ROTATE_AT (RFC 3339), or straight away without it
+	if next := os.Getenv("GALAXY_NEXT_SIGNING_KEY"); next != "" {
+		if err := scheduleRotation(keySet, next, os.Getenv("GALAXY_ROTATE_AT")); err != nil {
+			panic(err)
+		}
 	}
 
-	// Step 4: sign the token
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	tokenString, err := token.SignedString(privateKey)
+	// Step 2: sign a token for a body-less request, with the same claims
+	// AuthRoundTripper puts on every request. RSA keys sign RS256 and ECDSA
+	// keys ES256; the kid header names the key. $GALAXY_BODY_HASH_ENCODING
+	// switches bodyHash from base64 to hex, and $GALAXY_DEBUG logs every
+	// signed request to stderr.
+	config := auth.AuthConfig{
+		Keys:             keySet,
+		TokenDuration:    auth.MaxTokenDuration,
+		ApiKey:           devApiKey,
+		BodyHashEncoding: auth.BodyHashEncoding(os.Getenv("GALAXY_BODY_HASH_ENCODING")),
+	}
+	if os.Getenv("GALAXY_DEBUG") != "" {
+		config.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	tokenString, err := config.SignToken("/v1/resource", nil)
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Println("JWT token:")
 	fmt.Println(tokenString)
-}
-
-type AuthRoundTripper struct {
-	base http.RoundTripper
-	opts AuthConfig
-}
-
-type AuthConfig struct {
-	PrivateKey    *rsa.PrivateKey
-	SigningMethod jwt.SigningMethod
-	TokenDuration time.Duration
-	ApiKey        string
-}
-
-type AuthClaims struct {
-	URI      string `json:"uri"`
-	Nonce    string `json:"nonce"`
-	Sub      string `json:"sub"`
-	BodyHash string `json:"bodyHash,omitempty"`
-	jwt.RegisteredClaims
-}
 
-func NewAuthRoundTripper(opts AuthConfig, baseRoundTripper http.RoundTripper) (*AuthRoundTripper, error) {
-	if opts.PrivateKey == nil {
-		return nil, errors.New("RSA private key is not set")
+	// Step 3: with $GALAXY_BASE_URL set, list the validators the key can see
+	baseURL := os.Getenv("GALAXY_BASE_URL")
+	if baseURL == "" {
+		return
 	}
-	if opts.SigningMethod == nil {
-		return nil, errors.New("signing method is not set")
-	}
-	if opts.TokenDuration > 30*time.Second {
-		return nil, errors.New("token duration cannot be longer than 30 seconds")
-	}
-	if opts.TokenDuration <= 0 {
-		return nil, errors.New("token duration must be positive")
+	client, err := galaxyclient.NewClient(baseURL, config)
+	if err != nil {
+		panic(err)
 	}
-	if opts.ApiKey == "" {
-		return nil, errors.New("API key is not set")
+	page, err := client.ListValidators(context.Background(), galaxyclient.ListValidatorsOptions{Network: galaxyclient.NetworkHoodi})
+	if err != nil {
+		panic(err)
 	}
-	if baseRoundTripper == nil {
-		baseRoundTripper = http.DefaultTransport
+	for _, v := range page.Validators {
+		fmt.Println(v.Pubkey, v.Status)
 	}
-	return &AuthRoundTripper{
-		base: baseRoundTripper,
-		opts: opts,
-	}, nil
 }
 
-// https://docs.staking.galaxy.com/authentication-and-authorization
-func (b *AuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	claims := AuthClaims{
-		URI:      req.URL.Path,
-		Nonce:    uuid.NewString(),
-		Sub:      b.opts.ApiKey,
-		BodyHash: hashBody(req),
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(b.opts.TokenDuration)),
-		},
+func loadKeySet(source string) (*auth.KeySet, error) {
+	key, err := keys.Load(source, []byte(os.Getenv("GALAXY_SIGNING_KEY_PASSPHRASE")))
+	if err != nil {
+		return nil, err
 	}
-
-	token := jwt.NewWithClaims(b.opts.SigningMethod, claims)
-	bearer, err := token.SignedString(b.opts.PrivateKey)
+	kid, err := auth.KeyID(key.Public())
 	if err != nil {
-		return nil, errors.New("failed to sign Auth token")
+		return nil, err
 	}
-
-	req.Header.Set("Authorization", "Bearer "+bearer)
-	req.Header.Set("X-API-KEY", b.opts.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	return b.base.RoundTrip(req)
+	return auth.NewKeySet(kid, key)
 }
 
-func hashBody(req *http.Request) string {
-	if req.Body == nil {
-		return ""
+func scheduleRotation(keySet *auth.KeySet, source, at string) error {
+	key, err := keys.Load(source, []byte(os.Getenv("GALAXY_NEXT_SIGNING_KEY_PASSPHRASE")))
+	if err != nil {
+		return err
 	}
-
-	bodyBytes, err := io.ReadAll(req.Body)
+	kid, err := auth.KeyID(key.Public())
 	if err != nil {
-		fmt.Println(req.Context(), "failed to read request body", "error", err)
-		return ""
+		return err
 	}
-
-	// Restore the body
-	req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	if len(bodyBytes) == 0 {
-		return ""
+	if err := keySet.Add(kid, key); err != nil {
+		return err
 	}
-
-	// Hash the raw body bytes as sent
-	hash := sha256.Sum256(bodyBytes)
-	hashStr := hex.EncodeToString(hash[:])
-	fmt.Println(req.Context(), "hashing request body", "bodyLength", len(bodyBytes), "hash", hashStr)
-	return hashStr
+	if at == "" {
+		return keySet.Activate(kid)
+	}
+	when, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return fmt.Errorf("invalid GALAXY_ROTATE_AT: %w", err)
+	}
+	return keySet.Schedule(kid, when)
 }
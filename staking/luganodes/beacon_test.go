@@ -0,0 +1,73 @@
+package luganodes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"consensus"
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestSubmitVoluntaryExit(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	beacon := luganodestest.NewBeaconServer(srv)
+	defer beacon.Close()
+
+	client := newTestClient(t, srv)
+	client.Network = &consensus.Hoodi
+	ctx := context.Background()
+
+	keyHex := newWithdrawalKey(t)
+	pubkey := provisionActive(t, srv, client, keyHex, 1)[0]
+	sig, _ := luganodes.SignMessage([]byte("c"), keyHex)
+
+	exit, err := client.GenerateVerifiedExit(ctx, pubkey, "c", sig)
+	if err != nil {
+		t.Fatalf("verified exit failed: %v", err)
+	}
+
+	node := consensus.NewBeaconClient(beacon.URL)
+	if err := node.SubmitVoluntaryExit(ctx, exit); err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	if _, ok := beacon.PoolExit(exit.Message.ValidatorIndex); !ok {
+		t.Fatalf("exit not in the beacon pool")
+	}
+	if status, _ := srv.ValidatorStatus(pubkey); status != luganodestest.ValidatorExiting {
+		t.Fatalf("expected validator to be exiting, got %s", status)
+	}
+}
+
+func TestSubmitVoluntaryExitRejected(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	beacon := luganodestest.NewBeaconServer(srv)
+	defer beacon.Close()
+
+	client := newTestClient(t, srv)
+	client.Network = &consensus.Hoodi
+	ctx := context.Background()
+
+	keyHex := newWithdrawalKey(t)
+	pubkey := provisionActive(t, srv, client, keyHex, 1)[0]
+	sig, _ := luganodes.SignMessage([]byte("c"), keyHex)
+
+	exit, err := client.GenerateVerifiedExit(ctx, pubkey, "c", sig)
+	if err != nil {
+		t.Fatalf("verified exit failed: %v", err)
+	}
+	exit.Message.Epoch--
+
+	err = consensus.NewBeaconClient(beacon.URL).SubmitVoluntaryExit(ctx, exit)
+	var beaconErr *consensus.BeaconError
+	if !errors.As(err, &beaconErr) || beaconErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 BeaconError, got %v", err)
+	}
+	if status, _ := srv.ValidatorStatus(pubkey); status != luganodestest.ValidatorActive {
+		t.Fatalf("expected validator to stay active, got %s", status)
+	}
+}
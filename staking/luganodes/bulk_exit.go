@@ -0,0 +1,342 @@
+package luganodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"consensus"
+)
+
+// ExitSigner returns the challenge and withdrawal-address signature that
+// authorise an exit for the validator pubkey
+type ExitSigner func(pubkey string) (challenge, signature string, err error)
+
+// WithdrawalKeySigner signs challenge(pubkey) with the withdrawal address key
+func WithdrawalKeySigner(privateKeyHex string, challenge func(pubkey string) string) ExitSigner {
+	return func(pubkey string) (string, string, error) {
+		c := challenge(pubkey)
+		sig, err := SignMessage([]byte(c), privateKeyHex)
+		if err != nil {
+			return "", "", err
+		}
+		return c, sig, nil
+	}
+}
+
+// BulkExitRunner walks a set of validators through request, exit message,
+// beacon submission and exit, recording every step in a journal. Running it
+// again with the same journal resumes each validator where it stopped and
+// never repeats a step that already succeeded.
+type BulkExitRunner struct {
+	// Client must have a Network so exit messages can be verified
+	Client  *Client
+	Beacon  *consensus.BeaconClient
+	Journal *ExitJournal
+	Signer  ExitSigner
+	// Interval is the minimum spacing between outbound API calls
+	Interval time.Duration
+
+	last time.Time
+}
+
+// BulkExitReport summarises a run
+type BulkExitReport struct {
+	Total int
+	// Counts holds the journal state of every validator that resolved to a
+	// pubkey; the rest appear only in Failures
+	Counts map[ExitState]int
+	// Failures maps pubkey to the error that stopped it during this run
+	Failures map[string]string
+}
+
+func (r *BulkExitReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d validators:", r.Total)
+	for _, s := range []ExitState{ExitPending, ExitRequested, ExitMessageReceived, ExitSubmitted, ExitExited} {
+		fmt.Fprintf(&b, " %s=%d", s, r.Counts[s])
+	}
+	fmt.Fprintf(&b, " failed=%d", len(r.Failures))
+
+	pubkeys := make([]string, 0, len(r.Failures))
+	for pk := range r.Failures {
+		pubkeys = append(pubkeys, pk)
+	}
+	sort.Strings(pubkeys)
+	for _, pk := range pubkeys {
+		fmt.Fprintf(&b, "\n  %s: %s", pk, r.Failures[pk])
+	}
+	return b.String()
+}
+
+// Run advances every validator, given as a 0x pubkey or a decimal index, as
+// far as it can go. Validators whose exit has been submitted but not yet
+// processed by the chain are re-checked on every run. Per-validator failures
+// are recorded and reported; only context cancellation or a journal write
+// failure aborts the run.
+func (r *BulkExitRunner) Run(ctx context.Context, validators []string) (*BulkExitReport, error) {
+	if r.Client == nil || r.Client.Network == nil {
+		return nil, errors.New("luganodes: bulk exit needs a client with a network")
+	}
+	if r.Beacon == nil || r.Journal == nil || r.Signer == nil {
+		return nil, errors.New("luganodes: bulk exit needs a beacon client, journal and signer")
+	}
+
+	report := &BulkExitReport{
+		Total:    len(validators),
+		Counts:   make(map[ExitState]int),
+		Failures: make(map[string]string),
+	}
+
+	var pubkeys []string
+	seen := make(map[string]bool)
+	for _, id := range validators {
+		pubkey, err := r.resolve(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.Failures[id] = err.Error()
+			continue
+		}
+		// A validator listed twice, or by pubkey and by index, runs once
+		if seen[pubkey] {
+			report.Total--
+			continue
+		}
+		seen[pubkey] = true
+		pubkeys = append(pubkeys, pubkey)
+	}
+
+	for _, pubkey := range pubkeys {
+		if err := r.advance(ctx, pubkey); err != nil {
+			if ctx.Err() != nil {
+				return r.summarise(report, pubkeys), ctx.Err()
+			}
+			var journalErr *journalError
+			if errors.As(err, &journalErr) {
+				return r.summarise(report, pubkeys), journalErr.err
+			}
+			report.Failures[pubkey] = err.Error()
+		}
+	}
+	return r.summarise(report, pubkeys), nil
+}
+
+func (r *BulkExitRunner) summarise(report *BulkExitReport, pubkeys []string) *BulkExitReport {
+	for _, pk := range pubkeys {
+		e, ok := r.Journal.Entry(pk)
+		if !ok {
+			e.State = ExitPending
+		}
+		report.Counts[e.State]++
+	}
+	return report
+}
+
+// resolve turns a validator index into its pubkey, preferring the journal
+// over a beacon lookup
+func (r *BulkExitRunner) resolve(ctx context.Context, id string) (string, error) {
+	if strings.HasPrefix(id, "0x") {
+		pk, err := consensus.ParseBLSPubkey(id)
+		if err != nil {
+			return "", err
+		}
+		return pk.String(), nil
+	}
+
+	index, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither a pubkey nor a validator index", id)
+	}
+	for _, e := range r.Journal.Entries() {
+		if e.Index != nil && *e.Index == index {
+			return e.Pubkey, nil
+		}
+	}
+
+	if err := r.wait(ctx); err != nil {
+		return "", err
+	}
+	v, err := r.Beacon.GetValidator(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("resolve validator %d: %w", index, err)
+	}
+	pubkey := v.Pubkey.String()
+	return pubkey, r.journal(pubkey, func(e *ExitJournalEntry) { e.Index = &v.Index })
+}
+
+// advance moves one validator forward until it is exited, is waiting on the
+// chain, or a step fails
+func (r *BulkExitRunner) advance(ctx context.Context, pubkey string) error {
+	for {
+		e, ok := r.Journal.Entry(pubkey)
+		if !ok {
+			e.State = ExitPending
+		}
+
+		var err error
+		switch e.State {
+		case ExitPending:
+			err = r.request(ctx, pubkey)
+		case ExitRequested:
+			err = r.fetchMessage(ctx, pubkey)
+		case ExitMessageReceived:
+			err = r.submit(ctx, pubkey, e.Exit)
+		case ExitSubmitted:
+			var exited bool
+			exited, err = r.checkExited(ctx, pubkey)
+			if err == nil && !exited {
+				return nil
+			}
+		case ExitExited:
+			return nil
+		}
+		if err != nil {
+			var journalErr *journalError
+			if errors.As(err, &journalErr) || ctx.Err() != nil {
+				return err
+			}
+			if jerr := r.journal(pubkey, func(e *ExitJournalEntry) {
+				e.Attempts++
+				e.LastError = err.Error()
+			}); jerr != nil {
+				return jerr
+			}
+			return err
+		}
+	}
+}
+
+func (r *BulkExitRunner) request(ctx context.Context, pubkey string) error {
+	challenge, signature, err := r.Signer(pubkey)
+	if err != nil {
+		return fmt.Errorf("sign exit challenge: %w", err)
+	}
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+
+	_, err = r.Client.SubmitExit(ctx, pubkey, challenge, signature)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return r.resolveConflict(ctx, pubkey, err)
+	}
+	if err != nil {
+		return fmt.Errorf("request exit: %w", err)
+	}
+	return r.transition(pubkey, ExitRequested, nil)
+}
+
+// resolveConflict settles a 409 from the exit endpoint by the beacon state:
+// a validator that is already exiting or exited was requested by an earlier
+// run that died before journaling it. Anything else keeps the conflict.
+func (r *BulkExitRunner) resolveConflict(ctx context.Context, pubkey string, conflict error) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	v, err := r.Beacon.GetValidator(ctx, pubkey)
+	if err != nil {
+		return fmt.Errorf("request exit: %w (and beacon lookup failed: %v)", conflict, err)
+	}
+	switch {
+	case v.Exited():
+		return r.transition(pubkey, ExitExited, nil)
+	case v.Status == "active_exiting" || v.Status == "active_slashed":
+		// The exit is on chain already, so there is nothing left to submit
+		return r.transition(pubkey, ExitSubmitted, nil)
+	}
+	return fmt.Errorf("request exit: %w (beacon status %s)", conflict, v.Status)
+}
+
+func (r *BulkExitRunner) fetchMessage(ctx context.Context, pubkey string) error {
+	challenge, signature, err := r.Signer(pubkey)
+	if err != nil {
+		return fmt.Errorf("sign exit challenge: %w", err)
+	}
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+
+	exit, err := r.Client.GenerateVerifiedExit(ctx, pubkey, challenge, signature)
+	if err != nil {
+		return fmt.Errorf("fetch exit message: %w", err)
+	}
+	return r.transition(pubkey, ExitMessageReceived, func(e *ExitJournalEntry) {
+		e.Exit = exit
+		index := exit.Message.ValidatorIndex
+		e.Index = &index
+	})
+}
+
+func (r *BulkExitRunner) submit(ctx context.Context, pubkey string, exit *consensus.SignedVoluntaryExit) error {
+	if exit == nil {
+		return errors.New("journal has no exit message to submit")
+	}
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	if err := r.Beacon.SubmitVoluntaryExit(ctx, exit); err != nil {
+		return fmt.Errorf("submit exit to beacon node: %w", err)
+	}
+	return r.transition(pubkey, ExitSubmitted, nil)
+}
+
+func (r *BulkExitRunner) checkExited(ctx context.Context, pubkey string) (bool, error) {
+	if err := r.wait(ctx); err != nil {
+		return false, err
+	}
+	v, err := r.Beacon.GetValidator(ctx, pubkey)
+	if err != nil {
+		return false, fmt.Errorf("check validator status: %w", err)
+	}
+	if !v.Exited() {
+		return false, nil
+	}
+	return true, r.transition(pubkey, ExitExited, nil)
+}
+
+func (r *BulkExitRunner) transition(pubkey string, state ExitState, fn func(e *ExitJournalEntry)) error {
+	return r.journal(pubkey, func(e *ExitJournalEntry) {
+		e.State = state
+		e.LastError = ""
+		if fn != nil {
+			fn(e)
+		}
+	})
+}
+
+// journalError marks a failure to persist progress, which aborts the run
+type journalError struct{ err error }
+
+func (e *journalError) Error() string { return "write exit journal: " + e.err.Error() }
+func (e *journalError) Unwrap() error { return e.err }
+
+func (r *BulkExitRunner) journal(pubkey string, fn func(e *ExitJournalEntry)) error {
+	if err := r.Journal.Update(pubkey, fn); err != nil {
+		return &journalError{err: err}
+	}
+	return nil
+}
+
+// wait blocks until Interval has passed since the previous API call
+func (r *BulkExitRunner) wait(ctx context.Context) error {
+	if r.Interval > 0 && !r.last.IsZero() {
+		if d := time.Until(r.last.Add(r.Interval)); d > 0 {
+			t := time.NewTimer(d)
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+	}
+	r.last = time.Now()
+	return ctx.Err()
+}
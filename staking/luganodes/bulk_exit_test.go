@@ -0,0 +1,224 @@
+package luganodes_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"consensus"
+	"luganodes"
+	"luganodes/luganodestest"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+type bulkFixture struct {
+	srv     *luganodestest.Server
+	beacon  *luganodestest.BeaconServer
+	client  *luganodes.Client
+	pubkeys []string
+	signer  luganodes.ExitSigner
+	journal string
+}
+
+func newBulkFixture(t *testing.T, count int) *bulkFixture {
+	t.Helper()
+
+	srv := luganodestest.NewServer()
+	t.Cleanup(srv.Close)
+	beacon := luganodestest.NewBeaconServer(srv)
+	t.Cleanup(beacon.Close)
+
+	client := newTestClient(t, srv)
+	client.Network = &consensus.Hoodi
+	keyHex := newWithdrawalKey(t)
+
+	return &bulkFixture{
+		srv:     srv,
+		beacon:  beacon,
+		client:  client,
+		pubkeys: provisionActive(t, srv, client, keyHex, count),
+		signer: luganodes.WithdrawalKeySigner(keyHex, func(pubkey string) string {
+			return "exit:" + pubkey
+		}),
+		journal: filepath.Join(t.TempDir(), "exits.json"),
+	}
+}
+
+func (f *bulkFixture) run(t *testing.T, validators []string) *luganodes.BulkExitReport {
+	t.Helper()
+
+	journal, err := luganodes.OpenExitJournal(f.journal)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	runner := &luganodes.BulkExitRunner{
+		Client:  f.client,
+		Beacon:  consensus.NewBeaconClient(f.beacon.URL),
+		Journal: journal,
+		Signer:  f.signer,
+	}
+	report, err := runner.Run(context.Background(), validators)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	return report
+}
+
+func TestBulkExitRunsToCompletion(t *testing.T) {
+	f := newBulkFixture(t, 3)
+
+	// Address the last validator by index rather than pubkey
+	v, err := consensus.NewBeaconClient(f.beacon.URL).GetValidator(context.Background(), f.pubkeys[2])
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	targets := []string{f.pubkeys[0], f.pubkeys[1], strconv.FormatUint(v.Index, 10)}
+
+	report := f.run(t, targets)
+	if len(report.Failures) != 0 || report.Counts[luganodes.ExitSubmitted] != 3 {
+		t.Fatalf("expected 3 submitted, got %s", report)
+	}
+	for _, pk := range f.pubkeys {
+		pub, _ := consensus.ParseBLSPubkey(pk)
+		bv, err := consensus.NewBeaconClient(f.beacon.URL).GetValidator(context.Background(), pub.String())
+		if err != nil {
+			t.Fatalf("lookup %s: %v", pk, err)
+		}
+		if _, ok := f.beacon.PoolExit(bv.Index); !ok {
+			t.Fatalf("exit for %s not in beacon pool", pk)
+		}
+	}
+
+	f.srv.CompleteExits()
+	report = f.run(t, targets)
+	if report.Counts[luganodes.ExitExited] != 3 {
+		t.Fatalf("expected 3 exited, got %s", report)
+	}
+	if n := f.srv.Requests("/api/exit"); n != 3 {
+		t.Fatalf("expected one exit request per validator, got %d", n)
+	}
+	if n := f.srv.Requests("/api/exit/message"); n != 3 {
+		t.Fatalf("expected one exit message fetch per validator, got %d", n)
+	}
+}
+
+func TestBulkExitResumesAfterFailure(t *testing.T) {
+	f := newBulkFixture(t, 2)
+
+	f.srv.FailNext("/api/exit/message", http.StatusInternalServerError, 1)
+	report := f.run(t, f.pubkeys)
+	if len(report.Failures) != 1 {
+		t.Fatalf("expected 1 failure, got %s", report)
+	}
+	if report.Counts[luganodes.ExitRequested] != 1 || report.Counts[luganodes.ExitSubmitted] != 1 {
+		t.Fatalf("expected one requested and one submitted, got %s", report)
+	}
+
+	journal, err := luganodes.OpenExitJournal(f.journal)
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	var failed luganodes.ExitJournalEntry
+	for _, e := range journal.Entries() {
+		if e.State == luganodes.ExitRequested {
+			failed = e
+		}
+	}
+	if failed.Attempts != 1 || failed.LastError == "" {
+		t.Fatalf("expected the failure to be journaled, got %+v", failed)
+	}
+
+	// A fresh runner over the same journal picks up where the last one stopped
+	report = f.run(t, f.pubkeys)
+	if len(report.Failures) != 0 || report.Counts[luganodes.ExitSubmitted] != 2 {
+		t.Fatalf("expected both submitted after resume, got %s", report)
+	}
+	if n := f.srv.Requests("/api/exit"); n != 2 {
+		t.Fatalf("expected exits not to be requested twice, got %d requests", n)
+	}
+}
+
+func TestBulkExitRateLimit(t *testing.T) {
+	f := newBulkFixture(t, 2)
+
+	journal, err := luganodes.OpenExitJournal(f.journal)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	runner := &luganodes.BulkExitRunner{
+		Client:   f.client,
+		Beacon:   consensus.NewBeaconClient(f.beacon.URL),
+		Journal:  journal,
+		Signer:   f.signer,
+		Interval: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	if _, err := runner.Run(context.Background(), f.pubkeys); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	// 2 validators x (request, message, submit, status) = 8 calls, 7 gaps
+	if elapsed := time.Since(start); elapsed < 7*20*time.Millisecond {
+		t.Fatalf("expected calls to be spaced out, finished in %s", elapsed)
+	}
+}
+
+func TestBulkExitRejectsBadInput(t *testing.T) {
+	f := newBulkFixture(t, 1)
+
+	report := f.run(t, []string{"not-a-validator", hexutil.Encode(make([]byte, 10))})
+	if report.Total != 2 || len(report.Failures) != 2 {
+		t.Fatalf("expected both inputs to fail, got %s", report)
+	}
+}
+
+func TestExitJournalRefusesToMoveBackwards(t *testing.T) {
+	journal, err := luganodes.OpenExitJournal(filepath.Join(t.TempDir(), "exits.json"))
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	if err := journal.Update("0xabc", func(e *luganodes.ExitJournalEntry) { e.State = luganodes.ExitSubmitted }); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := journal.Update("0xabc", func(e *luganodes.ExitJournalEntry) { e.State = luganodes.ExitRequested }); err == nil {
+		t.Fatalf("expected backwards transition to fail")
+	}
+}
+
+func TestBulkExitConflicts(t *testing.T) {
+	f := newBulkFixture(t, 2)
+
+	// The first validator exits completely, the second is left exiting
+	f.run(t, f.pubkeys[:1])
+	f.srv.CompleteExits()
+	f.run(t, f.pubkeys[1:])
+
+	// A run without the journal settles the 409s from the beacon state
+	f.journal = filepath.Join(t.TempDir(), "lost.json")
+	v, err := consensus.NewBeaconClient(f.beacon.URL).GetValidator(context.Background(), f.pubkeys[1])
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	report := f.run(t, []string{f.pubkeys[0], f.pubkeys[1], f.pubkeys[1], strconv.FormatUint(v.Index, 10)})
+	if report.Total != 2 {
+		t.Fatalf("expected duplicates to be dropped, got %s", report)
+	}
+	if len(report.Failures) != 0 || report.Counts[luganodes.ExitExited] != 1 || report.Counts[luganodes.ExitSubmitted] != 1 {
+		t.Fatalf("expected one validator exited and one submitted, got %s", report)
+	}
+	if n := f.srv.Requests("/api/exit"); n != 4 {
+		t.Fatalf("expected one exit request per validator per run, got %d", n)
+	}
+
+	// A 409 for a validator the chain still has active is a failure
+	g := newBulkFixture(t, 1)
+	g.srv.FailNext("/api/exit", http.StatusConflict, 1)
+	report = g.run(t, g.pubkeys)
+	if _, failed := report.Failures[g.pubkeys[0]]; !failed || report.Counts[luganodes.ExitPending] != 1 {
+		t.Fatalf("expected the active validator to fail in pending, got %s", report)
+	}
+}
@@ -1,20 +1,27 @@
 package luganodes
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"consensus"
 )
 
 type Client struct {
-	APIKey     string
+	APIKey     Secret
 	BaseURL    string
 	HTTPClient *http.Client
+	// Session, when set, supplies the API key and renews it on a 401
+	Session *Session
+	// Network selects the signing domain exit messages are verified against
+	Network *consensus.Network
 }
 
 func NewClient(apiKey string, baseURL string) *Client {
 	return &Client{
-		APIKey:  apiKey,
+		APIKey:  Secret(apiKey),
 		BaseURL: baseURL,
 		HTTPClient: &http.Client{
 			Timeout: 15 * time.Second,
@@ -22,16 +29,91 @@ func NewClient(apiKey string, baseURL string) *Client {
 	}
 }
 
+// NewSessionClient returns a client that authenticates through session
+func NewSessionClient(session *Session, baseURL string) *Client {
+	c := NewClient("", baseURL)
+	c.Session = session
+	return c
+}
+
+// APIError is returned when the Luganodes API answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("luganodes: API returned status %d: %s", e.StatusCode, e.Body)
+}
+
 func (c *Client) doRequest(req *http.Request) ([]byte, int, error) {
-	req.Header.Set("api-key", c.APIKey)
+	if c.Session == nil {
+		return c.send(req, c.APIKey)
+	}
+
+	apiKey, err := c.Session.APIKey(req.Context())
+	if err != nil {
+		return nil, 0, err
+	}
+	body, status, err := c.send(req, apiKey)
+	if status != http.StatusUnauthorized {
+		return body, status, err
+	}
+
+	// The key expired or was revoked: log in again and replay the request once
+	apiKey, err = c.Session.Renew(req.Context(), apiKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	retry, err := rewind(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.send(retry, apiKey)
+}
+
+func (c *Client) send(req *http.Request, apiKey Secret) ([]byte, int, error) {
+	req.Header.Set("api-key", apiKey.Reveal())
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.HTTPClient.Do(req)
+	return do(c.HTTPClient, req, apiKey)
+}
+
+// rewind returns a copy of req with a fresh body so it can be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("luganodes: cannot replay %s %s body", req.Method, req.URL.Path)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry.Body = body
+	return retry, nil
+}
+
+// do executes req and turns non-2xx responses into an *APIError, scrubbing
+// the given secrets from the error body
+func do(httpClient *http.Client, req *http.Request, secrets ...Secret) ([]byte, int, error) {
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
-	return body, resp.StatusCode, err
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, resp.StatusCode, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       redact(string(body), secrets...),
+		}
+	}
+	return body, resp.StatusCode, nil
 }
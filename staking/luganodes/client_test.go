@@ -0,0 +1,86 @@
+package luganodes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+// newTestClient signs up against srv and returns an authenticated client
+func newTestClient(t *testing.T, srv *luganodestest.Server) *luganodes.Client {
+	t.Helper()
+
+	resp, err := luganodes.NewAuthClient(srv.URL).Signup(
+		context.Background(), "ops@example.com", "hunter2", "Example",
+	)
+	if err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	return luganodes.NewClient(resp.Result.User.APIKey.Reveal(), srv.URL)
+}
+
+func TestClientInvalidAPIKey(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+
+	client := luganodes.NewClient("not-a-key", srv.URL)
+	_, err := client.CreateProvision(context.Background(), luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   1,
+	})
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 APIError, got %v", err)
+	}
+}
+
+func TestClientInjectedFailures(t *testing.T) {
+	for _, status := range []int{
+		http.StatusUnauthorized,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+	} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			srv := luganodestest.NewServer()
+			defer srv.Close()
+			client := newTestClient(t, srv)
+
+			srv.FailNext("/api/provision", status, 1)
+			req := luganodes.ProvisionRequest{
+				WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+				ValidatorsCount:   1,
+			}
+
+			_, err := client.CreateProvision(context.Background(), req)
+			var apiErr *luganodes.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != status {
+				t.Fatalf("expected %d APIError, got %v", status, err)
+			}
+
+			// The fault is consumed, so the retry reaches the handler
+			if _, err := client.CreateProvision(context.Background(), req); err != nil {
+				t.Fatalf("expected retry to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientSlowResponse(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	srv.SetLatency(500 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetValidatorObjects(ctx, "any", 1, 10)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"consensus"
+	"luganodes"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// commonFlags are shared by every subcommand
+type commonFlags struct {
+	fs        *flag.FlagSet
+	baseURL   string
+	verbose   bool
+	recordDir string
+	out       *output
+}
+
+func newCommonFlags(name string) *commonFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c := &commonFlags{fs: fs, out: newOutput(fs)}
+	fs.StringVar(&c.baseURL, "base-url", "", fmt.Sprintf("Luganodes API base URL (or $%s, default %s)", envBaseURL, defaultBaseURL))
+	fs.BoolVar(&c.verbose, "verbose", false, "log every API request to stderr")
+	fs.StringVar(&c.recordDir, "record", "", "write sanitized request/response pairs to this directory")
+	return c
+}
+
+// middleware returns the transport middlewares selected by -verbose and -record
+func (c *commonFlags) middleware() ([]luganodes.Middleware, error) {
+	mws := []luganodes.Middleware{luganodes.RequestID()}
+	if c.verbose {
+		mws = append(mws, luganodes.Logging(slog.New(slog.NewTextHandler(os.Stderr, nil))))
+	}
+	if c.recordDir != "" {
+		recorder, err := luganodes.Recorder(c.recordDir)
+		if err != nil {
+			return nil, err
+		}
+		mws = append(mws, recorder)
+	}
+	return mws, nil
+}
+
+func (c *commonFlags) authClient() (*luganodes.AuthClient, error) {
+	mws, err := c.middleware()
+	if err != nil {
+		return nil, err
+	}
+	auth := luganodes.NewAuthClient(baseURL(c.baseURL))
+	auth.Use(mws...)
+	return auth, nil
+}
+
+func (c *commonFlags) parse(args []string) error {
+	if err := c.fs.Parse(args); err != nil {
+		return err
+	}
+	if c.fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", c.fs.Args())
+	}
+	return c.out.validate()
+}
+
+// apiFlags add the credentials needed by authenticated subcommands: an API
+// key, or an email and password to open a self-renewing session with
+type apiFlags struct {
+	*commonFlags
+	apiKey   *credential
+	email    *credential
+	password *credential
+}
+
+func newAPIFlags(name string) *apiFlags {
+	c := newCommonFlags(name)
+	return &apiFlags{
+		commonFlags: c,
+		apiKey:      newCredential(c.fs, "api-key", envAPIKey, "Luganodes API key"),
+		email:       newCredential(c.fs, "email", envEmail, "account email, used when no API key is set"),
+		password:    newCredential(c.fs, "password", envPassword, "account password, used when no API key is set"),
+	}
+}
+
+func (a *apiFlags) client() (*luganodes.Client, error) {
+	url := baseURL(a.baseURL)
+	mws, err := a.middleware()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, keyErr := a.apiKey.resolve()
+	if keyErr == nil {
+		client := luganodes.NewClient(apiKey, url)
+		client.Use(mws...)
+		return client, nil
+	}
+
+	email, err := a.email.resolve()
+	if err != nil {
+		return nil, keyErr
+	}
+	password, err := a.password.resolve()
+	if err != nil {
+		return nil, keyErr
+	}
+	auth, err := a.authClient()
+	if err != nil {
+		return nil, err
+	}
+	client := luganodes.NewSessionClient(luganodes.NewSession(auth, email, password), url)
+	client.Use(mws...)
+	return client, nil
+}
+
+/*
+   ---------- AUTH ----------
+*/
+
+func runSignup(ctx context.Context, args []string) error {
+	f := newCommonFlags("signup")
+	email := newCredential(f.fs, "email", envEmail, "account email")
+	password := newCredential(f.fs, "password", envPassword, "account password")
+	orgName := f.fs.String("org", "", "organization name")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *orgName == "" {
+		return errors.New("-org is required")
+	}
+
+	emailValue, err := email.resolve()
+	if err != nil {
+		return err
+	}
+	passwordValue, err := password.resolve()
+	if err != nil {
+		return err
+	}
+
+	auth, err := f.authClient()
+	if err != nil {
+		return err
+	}
+	resp, err := auth.Signup(ctx, emailValue, passwordValue, *orgName)
+	if err != nil {
+		return fmt.Errorf("signup failed: %w", err)
+	}
+	return printAPIKey(f.out, resp.Result.User.APIKey)
+}
+
+func runLogin(ctx context.Context, args []string) error {
+	f := newCommonFlags("login")
+	email := newCredential(f.fs, "email", envEmail, "account email")
+	password := newCredential(f.fs, "password", envPassword, "account password")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+
+	emailValue, err := email.resolve()
+	if err != nil {
+		return err
+	}
+	passwordValue, err := password.resolve()
+	if err != nil {
+		return err
+	}
+
+	auth, err := f.authClient()
+	if err != nil {
+		return err
+	}
+	resp, err := auth.Login(ctx, emailValue, passwordValue)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	return printAPIKey(f.out, resp.Result.User.APIKey)
+}
+
+// printAPIKey is the one place the CLI deliberately reveals a credential
+func printAPIKey(out *output, apiKey luganodes.Secret) error {
+	return out.print(
+		map[string]string{"apiKey": apiKey.Reveal()},
+		[]string{"API KEY"},
+		[][]string{{apiKey.Reveal()}},
+	)
+}
+
+/*
+   ---------- PROVISIONING ----------
+*/
+
+func runProvisionCreate(ctx context.Context, args []string) error {
+	f := newAPIFlags("provision create")
+	var req luganodes.ProvisionRequest
+	f.fs.StringVar(&req.WithdrawalAddress, "withdrawal-address", "", "withdrawal address (required)")
+	f.fs.StringVar(&req.ControllerAddress, "controller-address", "", "controller address")
+	f.fs.StringVar(&req.FeeRecipient, "fee-recipient", "", "fee recipient address")
+	f.fs.IntVar(&req.ValidatorsCount, "count", 1, "number of validators")
+	f.fs.BoolVar(&req.Batch, "batch", false, "batch deposits")
+	f.fs.BoolVar(&req.Compounding, "compounding", false, "provision 0x02 compounding validators")
+	f.fs.Float64Var(&req.AmountPerValidator, "amount", 32, "ETH per validator")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if req.WithdrawalAddress == "" {
+		return errors.New("-withdrawal-address is required")
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.CreateProvision(ctx, req)
+	if err != nil {
+		return fmt.Errorf("create provision failed: %w", err)
+	}
+	return printProvision(f.out, resp)
+}
+
+func runProvisionStatus(ctx context.Context, args []string) error {
+	f := newAPIFlags("provision status")
+	provisionID := f.fs.String("id", "", "provision ID (required)")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *provisionID == "" {
+		return errors.New("-id is required")
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetProvision(ctx, *provisionID)
+	if err != nil {
+		return fmt.Errorf("get provision failed: %w", err)
+	}
+	return printProvision(f.out, resp)
+}
+
+func printProvision(out *output, p *luganodes.ProvisionResponse) error {
+	return out.print(
+		p,
+		[]string{"PROVISION ID", "STATUS", "VALIDATORS", "WITHDRAWAL ADDRESS", "CREATED"},
+		[][]string{{p.ProvisionId, p.Status, strconv.Itoa(p.ValidatorsCount), p.WithdrawalAddress, p.Created}},
+	)
+}
+
+func runValidatorsList(ctx context.Context, args []string) error {
+	f := newAPIFlags("validators list")
+	provisionID := f.fs.String("provision", "", "provision ID (required)")
+	page := f.fs.Int("page", 0, "fetch a single page instead of all pages")
+	perPage := f.fs.Int("per-page", 50, "validators per page")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *provisionID == "" {
+		return errors.New("-provision is required")
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	var all luganodes.ValidatorObjectsResponse
+	for p := max(*page, 1); ; p++ {
+		resp, err := client.GetValidatorObjects(ctx, *provisionID, p, *perPage)
+		if err != nil {
+			return fmt.Errorf("list validators failed: %w", err)
+		}
+		all.Result = append(all.Result, resp.Result...)
+		if *page > 0 || len(resp.Result) < *perPage {
+			break
+		}
+	}
+
+	rows := make([][]string, 0, len(all.Result))
+	for _, v := range all.Result {
+		rows = append(rows, []string{
+			v.ValidatorAddress,
+			strconv.Itoa(v.ValidatorIndex),
+			v.Status,
+			strconv.FormatFloat(v.Amount, 'f', -1, 64),
+		})
+	}
+	return f.out.print(all.Result, []string{"PUBKEY", "INDEX", "STATUS", "AMOUNT"}, rows)
+}
+
+/*
+   ---------- EXITS ----------
+*/
+
+// exitFlags carry the validator key and the withdrawal-address proof of
+// ownership that both exit endpoints require
+type exitFlags struct {
+	*apiFlags
+	key           string
+	challenge     string
+	signature     string
+	withdrawalKey *credential
+}
+
+func newExitFlags(name string) *exitFlags {
+	f := &exitFlags{apiFlags: newAPIFlags(name)}
+	f.fs.StringVar(&f.key, "key", "", "validator public key (required)")
+	f.fs.StringVar(&f.challenge, "challenge", "", "exit challenge (required)")
+	f.fs.StringVar(&f.signature, "signature", "", "challenge signature; signed locally with -withdrawal-key if empty")
+	f.withdrawalKey = newCredential(f.fs, "withdrawal-key", envWithdrawalKey, "hex private key of the withdrawal address")
+	return f
+}
+
+func (f *exitFlags) parse(args []string) error {
+	if err := f.apiFlags.parse(args); err != nil {
+		return err
+	}
+	if f.key == "" {
+		return errors.New("-key is required")
+	}
+	if f.challenge == "" {
+		return errors.New("-challenge is required")
+	}
+	if f.signature != "" {
+		return nil
+	}
+
+	keyHex, err := f.withdrawalKey.resolve()
+	if err != nil {
+		return fmt.Errorf("-signature or a withdrawal key is required: %w", err)
+	}
+	f.signature, err = luganodes.SignMessage([]byte(f.challenge), keyHex)
+	if err != nil {
+		return fmt.Errorf("failed to sign challenge: %w", err)
+	}
+	return nil
+}
+
+func runExitGenerate(ctx context.Context, args []string) error {
+	f := newExitFlags("exit generate")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.GenerateExitMessage(ctx, f.key, f.challenge, f.signature)
+	if err != nil {
+		return fmt.Errorf("generate exit message failed: %w", err)
+	}
+	return f.out.print(resp, []string{"PUBKEY", "MESSAGE"}, [][]string{{f.key, resp.Message}})
+}
+
+func runExitBroadcast(ctx context.Context, args []string) error {
+	f := newExitFlags("exit broadcast")
+	networkName := f.fs.String("network", "hoodi", "network whose exit domain the message is verified against")
+	beaconURL := f.fs.String("beacon-url", "", "beacon node REST API URL (required)")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *beaconURL == "" {
+		return errors.New("-beacon-url is required")
+	}
+	network, err := consensus.NetworkByName(*networkName)
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	client.Network = &network
+
+	exit, err := client.GenerateVerifiedExit(ctx, f.key, f.challenge, f.signature)
+	if err != nil {
+		return fmt.Errorf("generate exit message failed: %w", err)
+	}
+	if err := consensus.NewBeaconClient(*beaconURL).SubmitVoluntaryExit(ctx, exit); err != nil {
+		return fmt.Errorf("broadcast exit failed: %w", err)
+	}
+	return printSignedExit(f.out, f.key, exit)
+}
+
+func printSignedExit(out *output, pubkey string, exit *consensus.SignedVoluntaryExit) error {
+	return out.print(
+		exit,
+		[]string{"PUBKEY", "VALIDATOR INDEX", "EPOCH", "SIGNATURE"},
+		[][]string{{
+			pubkey,
+			strconv.FormatUint(exit.Message.ValidatorIndex, 10),
+			strconv.FormatUint(exit.Message.Epoch, 10),
+			exit.Signature.String(),
+		}},
+	)
+}
+
+func runExitSubmit(ctx context.Context, args []string) error {
+	f := newExitFlags("exit submit")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.SubmitExit(ctx, f.key, f.challenge, f.signature)
+	if err != nil {
+		return fmt.Errorf("submit exit failed: %w", err)
+	}
+	return f.out.print(resp, []string{"PUBKEY", "MESSAGE"}, [][]string{{f.key, resp.Message}})
+}
+
+func runExitBulk(ctx context.Context, args []string) error {
+	f := newAPIFlags("exit bulk")
+	validators := f.fs.String("validators", "", "comma-separated validator pubkeys or indices")
+	validatorsFile := f.fs.String("validators-file", "", "file with one validator pubkey or index per line")
+	journalPath := f.fs.String("journal", "exits.journal.json", "journal file used to resume interrupted runs")
+	challenge := f.fs.String("challenge", "%s", "exit challenge template; %s is replaced with the validator pubkey")
+	networkName := f.fs.String("network", "hoodi", "network whose exit domain messages are verified against")
+	beaconURL := f.fs.String("beacon-url", "", "beacon node REST API URL (required)")
+	rate := f.fs.Float64("rate", 2, "maximum API calls per second")
+	withdrawalKey := newCredential(f.fs, "withdrawal-key", envWithdrawalKey, "hex private key of the withdrawal address")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *beaconURL == "" {
+		return errors.New("-beacon-url is required")
+	}
+	if *rate <= 0 {
+		return errors.New("-rate must be positive")
+	}
+	targets, err := readValidators(*validators, *validatorsFile)
+	if err != nil {
+		return err
+	}
+	network, err := consensus.NetworkByName(*networkName)
+	if err != nil {
+		return err
+	}
+	keyHex, err := withdrawalKey.resolve()
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	client.Network = &network
+	journal, err := luganodes.OpenExitJournal(*journalPath)
+	if err != nil {
+		return err
+	}
+
+	runner := &luganodes.BulkExitRunner{
+		Client:  client,
+		Beacon:  consensus.NewBeaconClient(*beaconURL),
+		Journal: journal,
+		Signer: luganodes.WithdrawalKeySigner(keyHex, func(pubkey string) string {
+			return strings.ReplaceAll(*challenge, "%s", pubkey)
+		}),
+		Interval: time.Duration(float64(time.Second) / *rate),
+	}
+	report, runErr := runner.Run(ctx, targets)
+	if report == nil {
+		return runErr
+	}
+
+	rows := make([][]string, 0, len(journal.Entries()))
+	for _, e := range journal.Entries() {
+		rows = append(rows, []string{e.Pubkey, string(e.State), strconv.Itoa(e.Attempts), e.LastError})
+	}
+	if err := f.out.print(report, []string{"PUBKEY", "STATE", "ATTEMPTS", "LAST ERROR"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, report)
+	if runErr != nil {
+		return runErr
+	}
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("%d validators failed; rerun to resume", len(report.Failures))
+	}
+	return nil
+}
+
+// readValidators merges the -validators list and -validators-file lines
+func readValidators(list, path string) ([]string, error) {
+	var out []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				out = append(out, line)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("-validators or -validators-file is required")
+	}
+	return out, nil
+}
+
+/*
+   ---------- COMPOUNDING (EIP-7251) ----------
+*/
+
+func runCompoundingConsolidate(ctx context.Context, args []string) error {
+	f := newAPIFlags("compounding consolidate")
+	provisionID := f.fs.String("provision", "", "provision ID (required)")
+	source := f.fs.String("source", "", "source validator pubkey (required)")
+	target := f.fs.String("target", "", "target 0x02 validator pubkey; defaults to -source to switch it to compounding")
+	feeWei := f.fs.String("fee", "", "request fee in wei; read from the system contract via -rpc-url if empty")
+	rpcURL := f.fs.String("rpc-url", "", "execution-layer JSON-RPC URL used to read the current fee")
+	beaconURL := f.fs.String("beacon-url", "", "beacon node REST API URL both validators are checked against (required)")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *provisionID == "" || *source == "" {
+		return errors.New("-provision and -source are required")
+	}
+	if *beaconURL == "" {
+		return errors.New("-beacon-url is required")
+	}
+	if *target == "" {
+		*target = *source
+	}
+
+	fee, err := consolidationFee(ctx, *feeWei, *rpcURL)
+	if err != nil {
+		return err
+	}
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	tx, err := client.PlanConsolidation(ctx, consensus.NewBeaconClient(*beaconURL), *provisionID, *source, *target, fee)
+	if err != nil {
+		return err
+	}
+	return printUnsignedTx(f.out, tx)
+}
+
+func runCompoundingTopUp(ctx context.Context, args []string) error {
+	f := newAPIFlags("compounding topup")
+	provisionID := f.fs.String("provision", "", "provision ID (required)")
+	pubkey := f.fs.String("key", "", "0x02 validator pubkey (required)")
+	amount := f.fs.Float64("amount", 0, "ETH to deposit (required)")
+	networkName := f.fs.String("network", "hoodi", "network whose deposit contract receives the top-up")
+	beaconURL := f.fs.String("beacon-url", "", "beacon node REST API URL the validator is checked against (required)")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if *provisionID == "" || *pubkey == "" || *amount <= 0 {
+		return errors.New("-provision, -key and a positive -amount are required")
+	}
+	if *beaconURL == "" {
+		return errors.New("-beacon-url is required")
+	}
+	network, err := consensus.NetworkByName(*networkName)
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	client.Network = &network
+	tx, err := client.PlanTopUp(ctx, consensus.NewBeaconClient(*beaconURL), *provisionID, *pubkey, uint64(math.Round(*amount*1e9)))
+	if err != nil {
+		return err
+	}
+	return printUnsignedTx(f.out, tx)
+}
+
+func consolidationFee(ctx context.Context, feeWei, rpcURL string) (*big.Int, error) {
+	if feeWei != "" {
+		fee, ok := new(big.Int).SetString(feeWei, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid -fee %q", feeWei)
+		}
+		return fee, nil
+	}
+	if rpcURL == "" {
+		return nil, errors.New("-fee or -rpc-url is required")
+	}
+	eth, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer eth.Close()
+	return luganodes.ConsolidationFee(ctx, eth)
+}
+
+func printUnsignedTx(out *output, tx *luganodes.UnsignedTx) error {
+	return out.print(
+		tx,
+		[]string{"TO", "VALUE (WEI)", "DATA"},
+		[][]string{{tx.To.Hex(), tx.Value.ToInt().String(), tx.Data.String()}},
+	)
+}
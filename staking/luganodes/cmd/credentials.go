@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"secretmanager/keys"
+	"secretmanager/secrets"
+)
+
+const defaultBaseURL = "https://testnet.eth-staking.lgns.net"
+
+// Environment variables consulted when a flag is not set
+const (
+	envBaseURL       = "LUGANODES_BASE_URL"
+	envAPIKey        = "LUGANODES_API_KEY"
+	envEmail         = "LUGANODES_EMAIL"
+	envPassword      = "LUGANODES_PASSWORD"
+	envWithdrawalKey = "LUGANODES_WITHDRAWAL_KEY"
+)
+
+// credential is a value that may come from a flag, a Google Cloud Secret
+// Manager secret named by a flag or an environment variable, in that order
+// of precedence
+type credential struct {
+	name   string
+	env    string
+	value  string
+	secret string
+}
+
+func newCredential(fs *flag.FlagSet, name, env, help string) *credential {
+	c := &credential{name: name, env: env}
+	fs.StringVar(&c.value, name, "", fmt.Sprintf("%s (or $%s)", help, env))
+	fs.StringVar(&c.secret, name+"-secret", "",
+		fmt.Sprintf("Secret Manager resource holding the %s (projects/<p>/secrets/<s>[/versions/<v>])", name))
+	return c
+}
+
+// resolve returns the credential value or an error naming every source tried
+func (c *credential) resolve() (string, error) {
+	if c.value != "" {
+		return c.value, nil
+	}
+	if c.secret != "" {
+		project, secret, version, err := keys.ParseSecretName(c.secret)
+		if err != nil {
+			return "", err
+		}
+		v, err := secrets.GetSecret(project, secret, version)
+		if err != nil {
+			return "", fmt.Errorf("failed to load %s from secret manager: %w", c.name, err)
+		}
+		return strings.TrimSpace(v), nil
+	}
+	if v := os.Getenv(c.env); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s is required: set -%s, $%s or -%s-secret", c.name, c.name, c.env, c.name)
+}
+
+// baseURL resolves the API base URL from the flag, the environment or the
+// testnet default
+func baseURL(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if v := os.Getenv(envBaseURL); v != "" {
+		return v
+	}
+	return defaultBaseURL
+}
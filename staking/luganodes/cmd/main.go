@@ -2,56 +2,75 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"luganodes"
+	"os"
+	"os/signal"
 )
 
-func main() {
-	ctx := context.Background()
-	baseURL := "https://testnet.eth-staking.lgns.net"
+const usage = `usage: luganodes <command> [flags]
 
-	authClient := luganodes.NewAuthClient(baseURL)
+commands:
+  signup              register a new organization user
+  login               log in and print a fresh API key
+  provision create    provision new validators
+  provision status    show the status of a provision
+  validators list     list the validators of a provision
+  exit generate       fetch the signed exit message for a validator
+  exit submit         ask Luganodes to broadcast a validator exit
+  exit broadcast      verify the signed exit and post it to a beacon node
+  exit bulk           exit many validators, resumable through a journal file
+  compounding consolidate
+                      build an EIP-7251 consolidation request transaction
+  compounding topup   build a top-up deposit for a 0x02 validator
 
-	email := "jose.sousa@anchorlabs.com"
-	password := "SuperSecret123!"
-	orgName := "Anchorage"
-	signupResp, err := authClient.Signup(ctx, email, password, orgName)
-	if err != nil {
-		panic(err)
-	}
-	apiKey := signupResp.Result.User.APIKey
-	fmt.Println("New API key:", apiKey)
-
-	// OR Login to existing account
-	loginResp, err := authClient.Login(ctx, email, password)
-	apiKey = loginResp.Result.User.APIKey
-
-	// 3) Create Luganodes REST client with API key
-	client := luganodes.NewClient(apiKey, baseURL)
-
-	// 1) Provision
-	provReq := luganodes.ProvisionRequest{
-		WithdrawalAddress:  "0xyourWithdrawAddr",
-		ValidatorsCount:    2,
-		Batch:              false,
-		Compounding:        false,
-		AmountPerValidator: 32,
-	}
+Run "luganodes <command> -h" for the flags of a command.
+`
 
-	provResp, _ := client.CreateProvision(ctx, provReq)
-	fmt.Println("Provision ID:", provResp.ProvisionId)
+type command func(ctx context.Context, args []string) error
 
-	// 2) Fetch validator objects
-	valObjs, _ := client.GetValidatorObjects(ctx, provResp.ProvisionId, 1, 20)
-	fmt.Println("Validator Objects:", valObjs.Result)
+var commands = map[string]command{
+	"signup":           runSignup,
+	"login":            runLogin,
+	"provision create": runProvisionCreate,
+	"provision status": runProvisionStatus,
+	"validators list":  runValidatorsList,
+	"exit generate":    runExitGenerate,
+	"exit submit":      runExitSubmit,
+	"exit broadcast":   runExitBroadcast,
+	"exit bulk":        runExitBulk,
 
-	// 3) EXIT – sign the challenge locally and call
-	challenge := "<packed challenge>" // derived off-chain
-	sig, err := luganodes.SignMessage([]byte(challenge), "<private key hex>")
-	if err != nil {
-		panic(err)
+	"compounding consolidate": runCompoundingConsolidate,
+	"compounding topup":       runCompoundingTopUp,
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
 	}
+}
 
-	exitResp, _ := client.GenerateExitMessage(ctx, provReq.WithdrawalAddress, challenge, sig)
-	fmt.Println("Exit Message:", exitResp.Message)
+// run dispatches args to a one- or two-word subcommand
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd(ctx, args[1:])
+	}
+	if len(args) > 1 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd(ctx, args[2:])
+		}
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// runJSON runs a command with -output json and decodes what it prints
+func runJSON(t *testing.T, v any, args ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	if err := run(context.Background(), append(args, "-output", "json")); err != nil {
+		t.Fatalf("%s failed: %v", strings.Join(args[:2], " "), err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+		t.Fatalf("%s output %q: %v", strings.Join(args[:2], " "), buf.String(), err)
+	}
+}
+
+func TestRunProvisionFlow(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	t.Setenv(envBaseURL, srv.URL)
+	t.Setenv(envEmail, "ops@example.com")
+	t.Setenv(envPassword, "hunter2")
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withdrawal := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	t.Setenv(envWithdrawalKey, hex.EncodeToString(crypto.FromECDSA(key)))
+
+	var signup struct{ APIKey string }
+	runJSON(t, &signup, "signup", "-org", "Example")
+	if signup.APIKey == "" {
+		t.Fatal("signup printed no API key")
+	}
+	t.Setenv(envAPIKey, signup.APIKey)
+
+	var created luganodes.ProvisionResponse
+	runJSON(t, &created, "provision", "create", "-withdrawal-address", withdrawal, "-count", "2")
+	if created.ProvisionId == "" || created.ValidatorsCount != 2 || created.Status != luganodestest.ProvisionPending {
+		t.Fatalf("unexpected provision %+v", created)
+	}
+
+	if err := srv.Activate(created.ProvisionId); err != nil {
+		t.Fatal(err)
+	}
+	var status luganodes.ProvisionResponse
+	runJSON(t, &status, "provision", "status", "-id", created.ProvisionId)
+	if status.Status != luganodestest.ProvisionCompleted {
+		t.Fatalf("expected the provision to be completed, got %+v", status)
+	}
+
+	var validators []luganodes.ValidatorObject
+	runJSON(t, &validators, "validators", "list", "-provision", created.ProvisionId)
+	if len(validators) != 2 {
+		t.Fatalf("expected 2 validators, got %+v", validators)
+	}
+	pubkey := validators[0].ValidatorAddress
+
+	// The challenge is signed locally with $LUGANODES_WITHDRAWAL_KEY
+	var exit luganodes.ExitResponse
+	runJSON(t, &exit, "exit", "submit", "-key", pubkey, "-challenge", "exit "+pubkey)
+	if got, _ := srv.ValidatorStatus(pubkey); got != luganodestest.ValidatorExiting {
+		t.Fatalf("expected %s to be exiting after %+v, got %s", pubkey, exit, got)
+	}
+	var message luganodes.ExitResponse
+	runJSON(t, &message, "exit", "generate", "-key", pubkey, "-challenge", "exit "+pubkey)
+	if message.Message == "" {
+		t.Fatal("exit generate printed no message")
+	}
+}
+
+func TestRunRequiresCredentials(t *testing.T) {
+	t.Setenv(envBaseURL, "http://127.0.0.1:0")
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envEmail, "")
+	t.Setenv(envPassword, "")
+	err := run(context.Background(), []string{"provision", "status", "-id", "x"})
+	if err == nil || !strings.Contains(err.Error(), "api-key is required") {
+		t.Fatalf("expected missing api-key error, got %v", err)
+	}
+}
+
+func TestSecretFlagWinsOverEnvironment(t *testing.T) {
+	t.Setenv(envAPIKey, "from-env")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c := newCredential(fs, "api-key", envAPIKey, "API key")
+	if err := fs.Parse([]string{"-api-key-secret", "not-a-secret-name"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.resolve(); err == nil || !strings.Contains(err.Error(), "invalid secret name") {
+		t.Fatalf("expected the -api-key-secret flag to be used over $%s, got %q, %v", envAPIKey, v, err)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	if err := run(context.Background(), []string{"provision", "delete"}); err == nil {
+		t.Fatalf("expected unknown command error")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+// stdout is where command results go; tests capture it
+var stdout io.Writer = os.Stdout
+
+// output renders a command result either as indented JSON or as a table
+type output struct {
+	format string
+	w      io.Writer
+}
+
+func newOutput(fs *flag.FlagSet) *output {
+	o := &output{w: stdout}
+	fs.StringVar(&o.format, "output", formatTable, "output format: json or table")
+	return o
+}
+
+func (o *output) validate() error {
+	if o.format != formatJSON && o.format != formatTable {
+		return fmt.Errorf("unknown output format %q", o.format)
+	}
+	return nil
+}
+
+// print writes v as JSON, or headers and rows as an aligned table
+func (o *output) print(v any, headers []string, rows [][]string) error {
+	if o.format == formatJSON {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,278 @@
+package luganodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"consensus"
+	"consensus/eth"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// MaxEffectiveBalanceGwei is MAX_EFFECTIVE_BALANCE_ELECTRA (2048 ETH)
+	MaxEffectiveBalanceGwei uint64 = 2048_000_000_000
+	// MinDepositGwei is the smallest amount the deposit contract accepts
+	MinDepositGwei uint64 = 1_000_000_000
+
+	gweiToWei = 1_000_000_000
+)
+
+// ConsolidationRequestContract is the EIP-7251 system contract that queues
+// consolidation requests, deployed at the same address on every network
+var ConsolidationRequestContract = common.HexToAddress("0x0000BBdDc7CE488642fb579F8B00f3a590007251")
+
+// Withdrawal credential prefixes
+const (
+	ExecutionCredentialsPrefix   = 0x01
+	CompoundingCredentialsPrefix = 0x02
+)
+
+// UnsignedTx is a transaction for the withdrawal address to sign and send.
+// Nonce, gas and fees are left to the sender.
+type UnsignedTx struct {
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Data  hexutil.Bytes  `json:"data"`
+}
+
+// ConsolidationFee reads the current request fee from the consolidation
+// system contract; an empty call returns it as a uint256
+func ConsolidationFee(ctx context.Context, caller ethereum.ContractCaller) (*big.Int, error) {
+	out, err := caller.CallContract(ctx, ethereum.CallMsg{To: &ConsolidationRequestContract}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read consolidation fee: %w", err)
+	}
+	if len(out) != 32 {
+		return nil, fmt.Errorf("read consolidation fee: want 32 bytes, got %d", len(out))
+	}
+	return new(big.Int).SetBytes(out), nil
+}
+
+// BuildConsolidation returns the EIP-7251 request that moves the balance of
+// source into target. Passing the same validator as source and target
+// requests a switch from 0x01 to 0x02 credentials instead. fee must be at
+// least the current ConsolidationFee; any excess is not refunded. The chain
+// drops requests it cannot apply without refunding the fee, so the status
+// and credentials of both validators should come from the beacon state, as
+// PlanConsolidation does.
+func BuildConsolidation(source, target ValidatorObject, fee *big.Int) (*UnsignedTx, error) {
+	if fee == nil || fee.Sign() <= 0 {
+		return nil, errors.New("luganodes: consolidation fee must be positive")
+	}
+	sourceKey, err := consensus.ParseBLSPubkey(source.ValidatorAddress)
+	if err != nil {
+		return nil, err
+	}
+	targetKey, err := consensus.ParseBLSPubkey(target.ValidatorAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireActive(source); err != nil {
+		return nil, err
+	}
+	sourceCreds, err := parseCredentials(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if sourceKey == targetKey {
+		if sourceCreds[0] != ExecutionCredentialsPrefix {
+			return nil, fmt.Errorf("luganodes: %s must have 0x01 credentials to switch to compounding", sourceKey)
+		}
+	} else {
+		// EIP-7251 ignores a source without execution credentials
+		if sourceCreds[0] != ExecutionCredentialsPrefix && sourceCreds[0] != CompoundingCredentialsPrefix {
+			return nil, fmt.Errorf("luganodes: consolidation source %s must have 0x01 or 0x02 credentials, has 0x%02x", sourceKey, sourceCreds[0])
+		}
+		if err := requireActive(target); err != nil {
+			return nil, err
+		}
+		targetCreds, err := parseCredentials(target)
+		if err != nil {
+			return nil, err
+		}
+		if targetCreds[0] != CompoundingCredentialsPrefix {
+			return nil, fmt.Errorf("luganodes: consolidation target %s must have 0x02 credentials", targetKey)
+		}
+		if [20]byte(sourceCreds[12:]) != [20]byte(targetCreds[12:]) {
+			return nil, errors.New("luganodes: source and target must share a withdrawal address")
+		}
+		total := balanceGwei(source) + balanceGwei(target)
+		if total > MaxEffectiveBalanceGwei {
+			return nil, fmt.Errorf("luganodes: consolidated balance %d gwei exceeds the %d gwei max effective balance",
+				total, MaxEffectiveBalanceGwei)
+		}
+	}
+
+	data := make([]byte, 0, 96)
+	data = append(data, sourceKey[:]...)
+	data = append(data, targetKey[:]...)
+	return &UnsignedTx{
+		To:    ConsolidationRequestContract,
+		Value: (*hexutil.Big)(new(big.Int).Set(fee)),
+		Data:  data,
+	}, nil
+}
+
+// BuildTopUp returns a deposit contract call adding amountGwei to an existing
+// compounding validator. Top-ups to known validators are not signature
+// checked, so the deposit carries an empty signature. As for consolidations,
+// v's status and credentials should come from the beacon state.
+func BuildTopUp(network consensus.Network, v ValidatorObject, amountGwei uint64) (*UnsignedTx, error) {
+	pubkey, err := consensus.ParseBLSPubkey(v.ValidatorAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireActive(v); err != nil {
+		return nil, err
+	}
+	creds, err := parseCredentials(v)
+	if err != nil {
+		return nil, err
+	}
+	if creds[0] != CompoundingCredentialsPrefix {
+		return nil, fmt.Errorf("luganodes: %s has 0x%02x credentials; only 0x02 validators can be topped up past 32 ETH",
+			pubkey, creds[0])
+	}
+	if amountGwei < MinDepositGwei {
+		return nil, fmt.Errorf("luganodes: top-up of %d gwei is below the 1 ETH minimum deposit", amountGwei)
+	}
+	if total := balanceGwei(v) + amountGwei; total > MaxEffectiveBalanceGwei {
+		return nil, fmt.Errorf("luganodes: topped-up balance %d gwei exceeds the %d gwei max effective balance",
+			total, MaxEffectiveBalanceGwei)
+	}
+
+	data, err := eth.DepositCalldata(consensus.DepositData{DepositMessage: consensus.DepositMessage{
+		Pubkey:                pubkey,
+		WithdrawalCredentials: creds,
+		AmountGwei:            amountGwei,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	value := new(big.Int).Mul(new(big.Int).SetUint64(amountGwei), big.NewInt(gweiToWei))
+	return &UnsignedTx{
+		To:    network.DepositContract,
+		Value: (*hexutil.Big)(value),
+		Data:  data,
+	}, nil
+}
+
+// PlanConsolidation builds a consolidation between two validators of a
+// provision, checking both against their status and credentials in the
+// beacon state rather than the ones the API reports
+func (c *Client) PlanConsolidation(
+	ctx context.Context,
+	beacon *consensus.BeaconClient,
+	provisionId, sourcePubkey, targetPubkey string,
+	fee *big.Int,
+) (*UnsignedTx, error) {
+	if beacon == nil {
+		return nil, errors.New("luganodes: consolidation needs a beacon client")
+	}
+	vals, err := c.ListProvisionValidators(ctx, provisionId)
+	if err != nil {
+		return nil, err
+	}
+	source, err := findOnChain(ctx, beacon, vals, sourcePubkey)
+	if err != nil {
+		return nil, fmt.Errorf("consolidation source: %w", err)
+	}
+	target := source
+	if !strings.EqualFold(sourcePubkey, targetPubkey) {
+		if target, err = findOnChain(ctx, beacon, vals, targetPubkey); err != nil {
+			return nil, fmt.Errorf("consolidation target: %w", err)
+		}
+	}
+	return BuildConsolidation(source, target, fee)
+}
+
+// PlanTopUp builds a top-up deposit on c.Network for a validator of a
+// provision, checked against its beacon state
+func (c *Client) PlanTopUp(
+	ctx context.Context,
+	beacon *consensus.BeaconClient,
+	provisionId, pubkey string,
+	amountGwei uint64,
+) (*UnsignedTx, error) {
+	if c.Network == nil {
+		return nil, errors.New("luganodes: client has no network configured")
+	}
+	if beacon == nil {
+		return nil, errors.New("luganodes: top-up needs a beacon client")
+	}
+	vals, err := c.ListProvisionValidators(ctx, provisionId)
+	if err != nil {
+		return nil, err
+	}
+	v, err := findOnChain(ctx, beacon, vals, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTopUp(*c.Network, v, amountGwei)
+}
+
+// findOnChain finds a provision validator and replaces the status and
+// credentials the API reports with those of the beacon state, which are
+// what the chain checks
+func findOnChain(ctx context.Context, beacon *consensus.BeaconClient, vals []ValidatorObject, pubkey string) (ValidatorObject, error) {
+	v, err := findValidator(vals, pubkey)
+	if err != nil {
+		return v, err
+	}
+	onChain, err := beacon.GetValidator(ctx, v.ValidatorAddress)
+	if err != nil {
+		return v, fmt.Errorf("look up %s on the beacon node: %w", v.ValidatorAddress, err)
+	}
+	v.Status = onChain.Status
+	v.WithdrawalCredentials = onChain.WithdrawalCredentials
+	return v, nil
+}
+
+func findValidator(vals []ValidatorObject, pubkey string) (ValidatorObject, error) {
+	for _, v := range vals {
+		if strings.EqualFold(v.ValidatorAddress, pubkey) {
+			return v, nil
+		}
+	}
+	return ValidatorObject{}, fmt.Errorf("luganodes: validator %s is not part of the provision", pubkey)
+}
+
+// beaconActive is the beacon status of a validator that is neither pending
+// nor on its way out
+const beaconActive = "active_ongoing"
+
+func requireActive(v ValidatorObject) error {
+	if v.Status != beaconActive {
+		return fmt.Errorf("luganodes: validator %s is %s, not %s", v.ValidatorAddress, v.Status, beaconActive)
+	}
+	return nil
+}
+
+func parseCredentials(v ValidatorObject) ([32]byte, error) {
+	var creds [32]byte
+	if v.WithdrawalCredentials == "" {
+		return creds, fmt.Errorf("luganodes: validator %s has no withdrawal credentials", v.ValidatorAddress)
+	}
+	b, err := hexutil.Decode(v.WithdrawalCredentials)
+	if err != nil || len(b) != len(creds) {
+		return creds, fmt.Errorf("luganodes: validator %s has invalid withdrawal credentials %q",
+			v.ValidatorAddress, v.WithdrawalCredentials)
+	}
+	copy(creds[:], b)
+	return creds, nil
+}
+
+// balanceGwei converts the ETH amount the API reports into gwei
+func balanceGwei(v ValidatorObject) uint64 {
+	return uint64(math.Round(v.Amount * gweiToWei))
+}
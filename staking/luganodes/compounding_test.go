@@ -0,0 +1,262 @@
+package luganodes_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"consensus"
+	"luganodes"
+	"luganodes/luganodestest"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// provisionValidators creates and activates a provision and returns its
+// validators as the API reports them
+func provisionValidators(t *testing.T, srv *luganodestest.Server, client *luganodes.Client, req luganodes.ProvisionRequest) (string, []luganodes.ValidatorObject) {
+	t.Helper()
+	ctx := context.Background()
+
+	prov, err := client.CreateProvision(ctx, req)
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	if err := srv.Activate(prov.ProvisionId); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	vals, err := client.ListProvisionValidators(ctx, prov.ProvisionId)
+	if err != nil {
+		t.Fatalf("list validators failed: %v", err)
+	}
+	return prov.ProvisionId, vals
+}
+
+// onChain gives API validators the beacon status the Plan functions would
+// find for them
+func onChain(vals []luganodes.ValidatorObject) []luganodes.ValidatorObject {
+	for i := range vals {
+		vals[i].Status = "active_ongoing"
+	}
+	return vals
+}
+
+func compoundingProvision(count int, amount float64) luganodes.ProvisionRequest {
+	return luganodes.ProvisionRequest{
+		WithdrawalAddress:  "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:    count,
+		Compounding:        true,
+		AmountPerValidator: amount,
+	}
+}
+
+func TestPlanConsolidation(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	beacon := luganodestest.NewBeaconServer(srv)
+	defer beacon.Close()
+
+	id, vals := provisionValidators(t, srv, client, compoundingProvision(2, 32))
+	fee := big.NewInt(1)
+
+	tx, err := client.PlanConsolidation(context.Background(), consensus.NewBeaconClient(beacon.URL), id, vals[0].ValidatorAddress, vals[1].ValidatorAddress, fee)
+	if err != nil {
+		t.Fatalf("plan consolidation failed: %v", err)
+	}
+	if tx.To != luganodes.ConsolidationRequestContract {
+		t.Fatalf("unexpected recipient %s", tx.To)
+	}
+	if tx.Value.ToInt().Cmp(fee) != 0 {
+		t.Fatalf("expected value %s, got %s", fee, tx.Value.ToInt())
+	}
+	source, _ := consensus.ParseBLSPubkey(vals[0].ValidatorAddress)
+	target, _ := consensus.ParseBLSPubkey(vals[1].ValidatorAddress)
+	if !bytes.Equal(tx.Data, append(source[:], target[:]...)) {
+		t.Fatalf("calldata is not source||target: %x", tx.Data)
+	}
+
+	// The beacon state wins over the API: a source still on 0x00 BLS
+	// credentials would be dropped on chain with the fee kept
+	if err := srv.SetBeaconCredentials(vals[0].ValidatorAddress, "0x00"+strings.Repeat("11", 31)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.PlanConsolidation(context.Background(), consensus.NewBeaconClient(beacon.URL), id, vals[0].ValidatorAddress, vals[1].ValidatorAddress, fee)
+	if err == nil || !strings.Contains(err.Error(), "0x01 or 0x02") {
+		t.Fatalf("expected a BLS-credential source to be refused, got %v", err)
+	}
+
+	// And for the target: the API has no say in its status or credentials
+	id, vals = provisionValidators(t, srv, client, compoundingProvision(2, 32))
+	if err := srv.SetBeaconStatus(vals[1].ValidatorAddress, "active_exiting"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.PlanConsolidation(context.Background(), consensus.NewBeaconClient(beacon.URL), id, vals[0].ValidatorAddress, vals[1].ValidatorAddress, fee)
+	if err == nil || !strings.Contains(err.Error(), "active_exiting") {
+		t.Fatalf("expected an exiting target to be refused, got %v", err)
+	}
+	if err := srv.SetBeaconStatus(vals[1].ValidatorAddress, "active_ongoing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SetBeaconCredentials(vals[1].ValidatorAddress, "0x01"+strings.Repeat("00", 11)+"39d02c253da1d9f85ddbeb3b6dc30bc1ecbbfa17"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.PlanConsolidation(context.Background(), consensus.NewBeaconClient(beacon.URL), id, vals[0].ValidatorAddress, vals[1].ValidatorAddress, fee)
+	if err == nil || !strings.Contains(err.Error(), "must have 0x02 credentials") {
+		t.Fatalf("expected a target still on 0x01 credentials to be refused, got %v", err)
+	}
+}
+
+func TestBuildConsolidationValidation(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	fee := big.NewInt(1)
+
+	_, large := provisionValidators(t, srv, client, compoundingProvision(2, 1500))
+	large = onChain(large)
+	if _, err := luganodes.BuildConsolidation(large[0], large[1], fee); err == nil || !strings.Contains(err.Error(), "max effective balance") {
+		t.Fatalf("expected max effective balance error, got %v", err)
+	}
+
+	_, regular := provisionValidators(t, srv, client, luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   2,
+	})
+	regular = onChain(regular)
+	if _, err := luganodes.BuildConsolidation(regular[0], regular[1], fee); err == nil || !strings.Contains(err.Error(), "0x02") {
+		t.Fatalf("expected 0x02 target error, got %v", err)
+	}
+
+	// A 0x01 validator consolidating into itself switches to compounding
+	if _, err := luganodes.BuildConsolidation(regular[0], regular[0], fee); err != nil {
+		t.Fatalf("switch to compounding failed: %v", err)
+	}
+	if _, err := luganodes.BuildConsolidation(large[0], large[0], fee); err == nil || !strings.Contains(err.Error(), "must have 0x01") {
+		t.Fatalf("expected switching an 0x02 validator to fail, got %v", err)
+	}
+	if _, err := luganodes.BuildConsolidation(regular[0], regular[0], nil); err == nil {
+		t.Fatalf("expected missing fee to fail")
+	}
+
+	bls := large[0]
+	bls.WithdrawalCredentials = "0x00" + strings.Repeat("11", 31)
+	if _, err := luganodes.BuildConsolidation(bls, large[1], fee); err == nil || !strings.Contains(err.Error(), "0x01 or 0x02") {
+		t.Fatalf("expected a 0x00 source to fail, got %v", err)
+	}
+
+	exiting := large[1]
+	exiting.Status = "active_exiting"
+	if _, err := luganodes.BuildConsolidation(large[0], exiting, fee); err == nil || !strings.Contains(err.Error(), "not active_ongoing") {
+		t.Fatalf("expected exiting target to fail, got %v", err)
+	}
+}
+
+func TestPlanTopUp(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	client.Network = &consensus.Mainnet
+	beacon := luganodestest.NewBeaconServer(srv)
+	defer beacon.Close()
+
+	id, vals := provisionValidators(t, srv, client, compoundingProvision(1, 32))
+	const amount = 100_000_000_000 // 100 ETH
+
+	tx, err := client.PlanTopUp(context.Background(), consensus.NewBeaconClient(beacon.URL), id, vals[0].ValidatorAddress, amount)
+	if err != nil {
+		t.Fatalf("plan top-up failed: %v", err)
+	}
+	if tx.To != consensus.Mainnet.DepositContract {
+		t.Fatalf("unexpected recipient %s", tx.To)
+	}
+	wantValue := new(big.Int).Mul(big.NewInt(amount), big.NewInt(1_000_000_000))
+	if tx.Value.ToInt().Cmp(wantValue) != 0 {
+		t.Fatalf("expected value %s, got %s", wantValue, tx.Value.ToInt())
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(`[{"name":"deposit","type":"function","inputs":[` +
+		`{"name":"pubkey","type":"bytes"},{"name":"withdrawal_credentials","type":"bytes"},` +
+		`{"name":"signature","type":"bytes"},{"name":"deposit_data_root","type":"bytes32"}]}]`))
+	if err != nil {
+		t.Fatalf("parse abi: %v", err)
+	}
+	args, err := parsed.Methods["deposit"].Inputs.Unpack(tx.Data[4:])
+	if err != nil {
+		t.Fatalf("unpack deposit: %v", err)
+	}
+	pubkey, _ := consensus.ParseBLSPubkey(vals[0].ValidatorAddress)
+	if !bytes.Equal(args[0].([]byte), pubkey[:]) {
+		t.Fatalf("deposit pubkey mismatch")
+	}
+	var creds [32]byte
+	copy(creds[:], args[1].([]byte))
+	if creds[0] != luganodes.CompoundingCredentialsPrefix {
+		t.Fatalf("expected 0x02 credentials, got %x", creds)
+	}
+	var sig consensus.BLSSignature
+	copy(sig[:], args[2].([]byte))
+	data := consensus.DepositData{
+		DepositMessage: consensus.DepositMessage{Pubkey: pubkey, WithdrawalCredentials: creds, AmountGwei: amount},
+		Signature:      sig,
+	}
+	if args[3].([32]byte) != data.HashTreeRoot() {
+		t.Fatalf("deposit data root does not match its inputs")
+	}
+}
+
+func TestBuildTopUpValidation(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	_, vals := provisionValidators(t, srv, client, compoundingProvision(1, 2000))
+	vals = onChain(vals)
+	if _, err := luganodes.BuildTopUp(consensus.Hoodi, vals[0], 100_000_000_000); err == nil || !strings.Contains(err.Error(), "max effective balance") {
+		t.Fatalf("expected top-up past 2048 ETH to fail, got %v", err)
+	}
+	if _, err := luganodes.BuildTopUp(consensus.Hoodi, vals[0], 1); err == nil || !strings.Contains(err.Error(), "minimum deposit") {
+		t.Fatalf("expected sub-1 ETH top-up to fail, got %v", err)
+	}
+	pending := vals[0]
+	pending.Status = "pending_queued"
+	if _, err := luganodes.BuildTopUp(consensus.Hoodi, pending, luganodes.MinDepositGwei); err == nil || !strings.Contains(err.Error(), "not active_ongoing") {
+		t.Fatalf("expected top-up of a pending validator to fail, got %v", err)
+	}
+
+	_, regular := provisionValidators(t, srv, client, luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   1,
+	})
+	if _, err := luganodes.BuildTopUp(consensus.Hoodi, onChain(regular)[0], luganodes.MinDepositGwei); err == nil || !strings.Contains(err.Error(), "only 0x02") {
+		t.Fatalf("expected top-up of a 0x01 validator to fail, got %v", err)
+	}
+}
+
+type feeCaller []byte
+
+func (f feeCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if msg.To == nil || *msg.To != luganodes.ConsolidationRequestContract || len(msg.Data) != 0 {
+		return nil, ethereum.NotFound
+	}
+	return f, nil
+}
+
+func TestConsolidationFee(t *testing.T) {
+	out := make([]byte, 32)
+	out[31] = 7
+	fee, err := luganodes.ConsolidationFee(context.Background(), feeCaller(out))
+	if err != nil {
+		t.Fatalf("read fee: %v", err)
+	}
+	if fee.Int64() != 7 {
+		t.Fatalf("expected fee 7, got %s", fee)
+	}
+	if _, err := luganodes.ConsolidationFee(context.Background(), feeCaller(out[:4])); err == nil {
+		t.Fatalf("expected short return data to fail")
+	}
+}
@@ -0,0 +1,158 @@
+package luganodes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"consensus"
+)
+
+// ExitState is how far a validator has progressed through a bulk exit
+type ExitState string
+
+const (
+	ExitPending         ExitState = "pending"
+	ExitRequested       ExitState = "requested"
+	ExitMessageReceived ExitState = "message_received"
+	ExitSubmitted       ExitState = "submitted"
+	ExitExited          ExitState = "exited"
+)
+
+// exitStateOrder ranks states so progress can only move forward
+var exitStateOrder = map[ExitState]int{
+	ExitPending:         0,
+	ExitRequested:       1,
+	ExitMessageReceived: 2,
+	ExitSubmitted:       3,
+	ExitExited:          4,
+}
+
+// ExitJournalEntry records one validator's bulk exit progress
+type ExitJournalEntry struct {
+	Pubkey    string                         `json:"pubkey"`
+	Index     *uint64                        `json:"index,omitempty"`
+	State     ExitState                      `json:"state"`
+	Exit      *consensus.SignedVoluntaryExit `json:"exit,omitempty"`
+	LastError string                         `json:"lastError,omitempty"`
+	Attempts  int                            `json:"attempts"`
+	UpdatedAt time.Time                      `json:"updatedAt"`
+}
+
+// ExitJournal persists bulk exit progress to a JSON file so an interrupted
+// run can resume where it stopped. Every update is written through to disk.
+type ExitJournal struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]*ExitJournalEntry
+}
+
+// OpenExitJournal loads the journal at path, or starts an empty one if the
+// file does not exist yet
+func OpenExitJournal(path string) (*ExitJournal, error) {
+	j := &ExitJournal{path: path, entries: make(map[string]*ExitJournalEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ExitJournalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("luganodes: corrupt exit journal %s: %w", path, err)
+	}
+	for _, e := range entries {
+		if _, ok := exitStateOrder[e.State]; !ok {
+			return nil, fmt.Errorf("luganodes: exit journal %s: unknown state %q for %s", path, e.State, e.Pubkey)
+		}
+		j.entries[e.Pubkey] = e
+	}
+	return j, nil
+}
+
+// Entry returns a copy of the entry for pubkey
+func (j *ExitJournal) Entry(pubkey string) (ExitJournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e, ok := j.entries[pubkey]
+	if !ok {
+		return ExitJournalEntry{}, false
+	}
+	return *e, true
+}
+
+// Entries returns copies of every entry ordered by pubkey
+func (j *ExitJournal) Entries() []ExitJournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	out := make([]ExitJournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Pubkey < out[b].Pubkey })
+	return out
+}
+
+// Update applies fn to the entry for pubkey, creating it if needed, and
+// persists the journal. A state may never move backwards.
+func (j *ExitJournal) Update(pubkey string, fn func(e *ExitJournalEntry)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	next := ExitJournalEntry{Pubkey: pubkey, State: ExitPending}
+	if e, ok := j.entries[pubkey]; ok {
+		next = *e
+	}
+	prev := next.State
+	fn(&next)
+	if rank, ok := exitStateOrder[next.State]; !ok || rank < exitStateOrder[prev] {
+		return fmt.Errorf("luganodes: %s cannot move from %s to %s", pubkey, prev, next.State)
+	}
+	next.UpdatedAt = time.Now().UTC()
+	j.entries[pubkey] = &next
+	return j.save()
+}
+
+// save writes the journal atomically. It must be called with j.mu held.
+func (j *ExitJournal) save() error {
+	entries := make([]*ExitJournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Pubkey < entries[b].Pubkey })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
@@ -3,9 +3,13 @@ package luganodes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+
+	"consensus"
 )
 
 type ExitChallengeRequest struct {
@@ -22,12 +26,18 @@ func (c *Client) SubmitExit(
 	keyAddr string,
 	challenge, signature string,
 ) (*ExitResponse, error) {
-	url := fmt.Sprintf("%s/api/exit?key=%s", c.BaseURL, keyAddr)
+	reqURL := fmt.Sprintf("%s/api/exit?key=%s", c.BaseURL, url.QueryEscape(keyAddr))
 
 	bodyReq := ExitChallengeRequest{Challenge: challenge, Signature: signature}
-	b, _ := json.Marshal(bodyReq)
+	b, err := json.Marshal(bodyReq)
+	if err != nil {
+		return nil, err
+	}
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(b)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, strings.NewReader(string(b)))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	body, _, err := c.doRequest(req)
@@ -35,7 +45,9 @@ func (c *Client) SubmitExit(
 		return nil, err
 	}
 	var resp ExitResponse
-	json.Unmarshal(body, &resp)
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
 	return &resp, nil
 }
 
@@ -43,12 +55,18 @@ func (c *Client) GenerateExitMessage(
 	ctx context.Context,
 	keyAddr, challenge, signature string,
 ) (*ExitResponse, error) {
-	url := fmt.Sprintf("%s/api/exit/message?key=%s", c.BaseURL, keyAddr)
+	reqURL := fmt.Sprintf("%s/api/exit/message?key=%s", c.BaseURL, url.QueryEscape(keyAddr))
 
 	bodyReq := ExitChallengeRequest{Challenge: challenge, Signature: signature}
-	b, _ := json.Marshal(bodyReq)
+	b, err := json.Marshal(bodyReq)
+	if err != nil {
+		return nil, err
+	}
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(b)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, strings.NewReader(string(b)))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	body, _, err := c.doRequest(req)
@@ -56,6 +74,36 @@ func (c *Client) GenerateExitMessage(
 		return nil, err
 	}
 	var resp ExitResponse
-	json.Unmarshal(body, &resp)
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
 	return &resp, nil
 }
+
+// GenerateVerifiedExit fetches the exit message for the validator keyAddr,
+// parses it and verifies its signature against keyAddr on c.Network
+func (c *Client) GenerateVerifiedExit(
+	ctx context.Context,
+	keyAddr, challenge, signature string,
+) (*consensus.SignedVoluntaryExit, error) {
+	if c.Network == nil {
+		return nil, errors.New("luganodes: client has no network configured")
+	}
+	pubkey, err := consensus.ParseBLSPubkey(keyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.GenerateExitMessage(ctx, keyAddr, challenge, signature)
+	if err != nil {
+		return nil, err
+	}
+	exit, err := resp.SignedVoluntaryExit()
+	if err != nil {
+		return nil, err
+	}
+	if err := exit.Verify(pubkey, *c.Network); err != nil {
+		return nil, err
+	}
+	return exit, nil
+}
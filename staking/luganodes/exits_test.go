@@ -0,0 +1,160 @@
+package luganodes_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// provisionActive creates and activates a provision withdrawing to the
+// address of withdrawalKeyHex and returns its validator pubkeys
+func provisionActive(t *testing.T, srv *luganodestest.Server, client *luganodes.Client, withdrawalKeyHex string, count int) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	key, err := crypto.HexToECDSA(withdrawalKeyHex)
+	if err != nil {
+		t.Fatalf("bad key: %v", err)
+	}
+	prov, err := client.CreateProvision(ctx, luganodes.ProvisionRequest{
+		WithdrawalAddress: crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		ValidatorsCount:   count,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	if err := srv.Activate(prov.ProvisionId); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	vals, err := client.GetValidatorObjects(ctx, prov.ProvisionId, 1, 100)
+	if err != nil {
+		t.Fatalf("list validators failed: %v", err)
+	}
+	var pubkeys []string
+	for _, v := range vals.Result {
+		pubkeys = append(pubkeys, v.ValidatorAddress)
+	}
+	return pubkeys
+}
+
+func newWithdrawalKey(t *testing.T) string {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return hex.EncodeToString(crypto.FromECDSA(key))
+}
+
+func TestExitLifecycle(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	ctx := context.Background()
+
+	keyHex := newWithdrawalKey(t)
+	pubkey := provisionActive(t, srv, client, keyHex, 1)[0]
+
+	challenge := "exit:" + pubkey
+	sig, err := luganodes.SignMessage([]byte(challenge), keyHex)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	msg, err := client.GenerateExitMessage(ctx, pubkey, challenge, sig)
+	if err != nil {
+		t.Fatalf("generate exit message failed: %v", err)
+	}
+	var parsed struct {
+		Message struct {
+			Epoch          string `json:"epoch"`
+			ValidatorIndex string `json:"validator_index"`
+		} `json:"message"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal([]byte(msg.Message), &parsed); err != nil {
+		t.Fatalf("exit message is not JSON: %v", err)
+	}
+	if parsed.Message.Epoch == "" || parsed.Message.ValidatorIndex == "" || parsed.Signature == "" {
+		t.Fatalf("incomplete exit message: %s", msg.Message)
+	}
+
+	if _, err := client.SubmitExit(ctx, pubkey, challenge, sig); err != nil {
+		t.Fatalf("submit exit failed: %v", err)
+	}
+	if status, _ := srv.ValidatorStatus(pubkey); status != luganodestest.ValidatorExiting {
+		t.Fatalf("expected exiting, got %s", status)
+	}
+
+	// A second submission is rejected while the exit is in flight
+	_, err = client.SubmitExit(ctx, pubkey, challenge, sig)
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 APIError, got %v", err)
+	}
+
+	srv.CompleteExits()
+	if status, _ := srv.ValidatorStatus(pubkey); status != luganodestest.ValidatorExited {
+		t.Fatalf("expected exited, got %s", status)
+	}
+	if _, err := client.GenerateExitMessage(ctx, pubkey, challenge, sig); err == nil {
+		t.Fatalf("expected exit message for exited validator to fail")
+	}
+}
+
+func TestExitRejectsForeignSigner(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	pubkey := provisionActive(t, srv, client, newWithdrawalKey(t), 1)[0]
+
+	challenge := "exit:" + pubkey
+	sig, err := luganodes.SignMessage([]byte(challenge), newWithdrawalKey(t))
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	_, err = client.SubmitExit(context.Background(), pubkey, challenge, sig)
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 APIError, got %v", err)
+	}
+}
+
+func TestExitPendingValidator(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	ctx := context.Background()
+
+	keyHex := newWithdrawalKey(t)
+	key, _ := crypto.HexToECDSA(keyHex)
+	prov, err := client.CreateProvision(ctx, luganodes.ProvisionRequest{
+		WithdrawalAddress: crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		ValidatorsCount:   1,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	vals, err := client.GetValidatorObjects(ctx, prov.ProvisionId, 1, 10)
+	if err != nil {
+		t.Fatalf("list validators failed: %v", err)
+	}
+	pubkey := vals.Result[0].ValidatorAddress
+
+	sig, _ := luganodes.SignMessage([]byte("c"), keyHex)
+	_, err = client.SubmitExit(ctx, pubkey, "c", sig)
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 APIError, got %v", err)
+	}
+}
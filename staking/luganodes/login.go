@@ -1,11 +1,11 @@
 package luganodes
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -35,7 +35,7 @@ type SignupRequest struct {
 type SignupResponse struct {
 	Result struct {
 		User struct {
-			APIKey string `json:"apiKey"`
+			APIKey Secret `json:"apiKey"`
 		} `json:"user"`
 	} `json:"result"`
 }
@@ -47,25 +47,9 @@ func (a *AuthClient) Signup(
 ) (*SignupResponse, error) {
 	url := fmt.Sprintf("%s/api/signup", a.BaseURL)
 
-	body := fmt.Sprintf(
-		`{"email":"%s","password":"%s","orgName":"%s"}`,
-		email, password, orgName,
-	)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := a.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
 	var result SignupResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	reqBody := SignupRequest{Email: email, Password: password, OrgName: orgName}
+	if err := a.post(ctx, url, reqBody, &result, Secret(password)); err != nil {
 		return nil, err
 	}
 	return &result, nil
@@ -81,7 +65,7 @@ type LoginRequest struct {
 type LoginResponse struct {
 	Result struct {
 		User struct {
-			APIKey string `json:"apiKey"`
+			APIKey Secret `json:"apiKey"`
 		} `json:"user"`
 	} `json:"result"`
 }
@@ -93,26 +77,31 @@ func (a *AuthClient) Login(
 ) (*LoginResponse, error) {
 	url := fmt.Sprintf("%s/api/login", a.BaseURL)
 
-	body := fmt.Sprintf(
-		`{"email":"%s","password":"%s"}`,
-		email, password,
-	)
+	var result LoginResponse
+	reqBody := LoginRequest{Email: email, Password: password}
+	if err := a.post(ctx, url, reqBody, &result, Secret(password)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+// post sends reqBody as JSON and decodes the response into result. The
+// password is scrubbed from any error body the API echoes back.
+func (a *AuthClient) post(ctx context.Context, url string, reqBody, result any, password Secret) error {
+	b, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := a.HTTPClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
 
-	var result LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	respBody, _, err := do(a.HTTPClient, req, password)
+	if err != nil {
+		return err
 	}
-	return &result, nil
+	return json.Unmarshal(respBody, result)
 }
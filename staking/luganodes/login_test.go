@@ -0,0 +1,72 @@
+package luganodes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	auth := luganodes.NewAuthClient(srv.URL)
+
+	signup, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example")
+	if err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	if signup.Result.User.APIKey == "" {
+		t.Fatalf("expected an API key from signup")
+	}
+
+	login, err := auth.Login(ctx, "ops@example.com", "hunter2")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if login.Result.User.APIKey == "" {
+		t.Fatalf("expected an API key from login")
+	}
+	if login.Result.User.APIKey == signup.Result.User.APIKey {
+		t.Fatalf("expected login to issue a fresh API key")
+	}
+}
+
+func TestSignupDuplicateEmail(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	auth := luganodes.NewAuthClient(srv.URL)
+
+	if _, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	_, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example")
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 APIError, got %v", err)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	auth := luganodes.NewAuthClient(srv.URL)
+
+	if _, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	_, err := auth.Login(ctx, "ops@example.com", "wrong")
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 APIError, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package luganodestest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"consensus"
+)
+
+// BeaconServer is a fake beacon node whose validator registry is the state
+// of a fake Luganodes server, so exits it accepts show up there too
+type BeaconServer struct {
+	*httptest.Server
+
+	lugano *Server
+	mu     sync.Mutex
+	exits  map[uint64]consensus.SignedVoluntaryExit
+}
+
+// NewBeaconServer starts a fake beacon node backed by lugano. Callers must
+// Close it.
+func NewBeaconServer(lugano *Server) *BeaconServer {
+	b := &BeaconServer{
+		lugano: lugano,
+		exits:  make(map[uint64]consensus.SignedVoluntaryExit),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /eth/v1/beacon/pool/voluntary_exits", b.handleSubmitExit)
+	mux.HandleFunc("GET /eth/v1/beacon/states/head/validators/{id}", b.handleGetValidator)
+
+	b.Server = httptest.NewServer(mux)
+	return b
+}
+
+// PoolExit returns the exit accepted into the pool for a validator index
+func (b *BeaconServer) PoolExit(index uint64) (consensus.SignedVoluntaryExit, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	exit, ok := b.exits[index]
+	return exit, ok
+}
+
+func (b *BeaconServer) handleSubmitExit(w http.ResponseWriter, r *http.Request) {
+	var exit consensus.SignedVoluntaryExit
+	if err := json.NewDecoder(r.Body).Decode(&exit); err != nil {
+		writeBeaconError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	b.lugano.mu.Lock()
+	defer b.lugano.mu.Unlock()
+
+	v := b.lugano.validatorByIndex(exit.Message.ValidatorIndex)
+	if v == nil {
+		writeBeaconError(w, http.StatusBadRequest, "validator not found")
+		return
+	}
+	if v.status != ValidatorActive && v.status != ValidatorExiting {
+		writeBeaconError(w, http.StatusBadRequest, fmt.Sprintf("validator is %s", v.status))
+		return
+	}
+	if exit.Message.Epoch > b.lugano.epoch {
+		writeBeaconError(w, http.StatusBadRequest, "exit epoch is in the future")
+		return
+	}
+	if err := exit.Verify(v.key.Pubkey, b.lugano.network); err != nil {
+		writeBeaconError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if v.status == ValidatorActive {
+		v.status = ValidatorExiting
+		v.exitEpoch = exit.Message.Epoch
+	}
+
+	b.mu.Lock()
+	b.exits[exit.Message.ValidatorIndex] = exit
+	b.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// beaconStatus maps the Luganodes lifecycle onto beacon API statuses
+var beaconStatus = map[string]string{
+	ValidatorPending: "pending_queued",
+	ValidatorActive:  "active_ongoing",
+	ValidatorExiting: "active_exiting",
+	ValidatorExited:  "exited_unslashed",
+}
+
+func (b *BeaconServer) handleGetValidator(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	b.lugano.mu.Lock()
+	defer b.lugano.mu.Unlock()
+
+	var v *validator
+	if strings.HasPrefix(id, "0x") {
+		v = b.lugano.validators[strings.ToLower(id)]
+	} else if index, err := strconv.ParseUint(id, 10, 64); err == nil {
+		v = b.lugano.validatorByIndex(index)
+	}
+	if v == nil || v.status == ValidatorPending {
+		writeBeaconError(w, http.StatusNotFound, "validator not found")
+		return
+	}
+
+	creds := v.beaconCreds
+	if creds == "" {
+		creds = withdrawalCredentials(v, b.lugano.provisions[v.provisionID].WithdrawalAddress)
+	}
+	status := v.beaconState
+	if status == "" {
+		status = beaconStatus[v.status]
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": map[string]any{
+			"index":  strconv.Itoa(v.index),
+			"status": status,
+			"validator": map[string]string{
+				"pubkey":                 v.pubkey,
+				"withdrawal_credentials": creds,
+			},
+		},
+	})
+}
+
+// validatorByIndex must be called with s.mu held
+func (s *Server) validatorByIndex(index uint64) *validator {
+	for _, v := range s.validators {
+		if v.status != ValidatorPending && uint64(v.index) == index {
+			return v
+		}
+	}
+	return nil
+}
+
+func writeBeaconError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{"code": status, "message": msg})
+}
@@ -0,0 +1,615 @@
+// Package luganodestest provides an in-process stand-in for the Luganodes
+// staking API so the client can be exercised without testnet credentials.
+package luganodestest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"consensus"
+	"consensus/blstest"
+	"luganodes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Provision statuses reported by the fake
+const (
+	ProvisionPending   = "pending"
+	ProvisionCompleted = "completed"
+)
+
+// Validator statuses reported by the fake
+const (
+	ValidatorPending = "pending"
+	ValidatorActive  = "active"
+	ValidatorExiting = "exiting"
+	ValidatorExited  = "exited"
+)
+
+type user struct {
+	email    string
+	password string
+	orgName  string
+	apiKey   string
+}
+
+type provision struct {
+	luganodes.ProvisionResponse
+	owner      string
+	validators []*validator
+}
+
+type validator struct {
+	key         blstest.Key
+	pubkey      string
+	index       int
+	amount      float64
+	status      string
+	provisionID string
+	exitEpoch   uint64
+	compounding bool
+	// beaconCreds and beaconState override the credentials and status the
+	// beacon node reports
+	beaconCreds string
+	beaconState string
+}
+
+type fault struct {
+	status int
+	times  int
+}
+
+// Server is a fake Luganodes API backed by in-memory state
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	users      map[string]*user
+	apiKeys    map[string]*user
+	provisions map[string]*provision
+	validators map[string]*validator
+	faults     map[string]*fault
+	latency    time.Duration
+	nextIndex  int
+	epoch      uint64
+	network    consensus.Network
+	requests   map[string]int
+	requestIDs map[string][]string
+}
+
+// NewServer starts a fake Luganodes API. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		users:      make(map[string]*user),
+		apiKeys:    make(map[string]*user),
+		provisions: make(map[string]*provision),
+		validators: make(map[string]*validator),
+		faults:     make(map[string]*fault),
+		requests:   make(map[string]int),
+		requestIDs: make(map[string][]string),
+		nextIndex:  100000,
+		epoch:      1000,
+		network:    consensus.Hoodi,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/signup", s.handleSignup)
+	mux.HandleFunc("POST /api/login", s.handleLogin)
+	mux.HandleFunc("POST /api/provision", s.authenticated(s.handleCreateProvision))
+	mux.HandleFunc("GET /api/provision", s.authenticated(s.handleGetProvision))
+	mux.HandleFunc("GET /api/validators", s.authenticated(s.handleListValidators))
+	mux.HandleFunc("POST /api/exit", s.authenticated(s.handleExit))
+	mux.HandleFunc("POST /api/exit/message", s.authenticated(s.handleExitMessage))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+/*
+   ---------- FAILURE INJECTION ----------
+*/
+
+// FailNext makes the next n requests to path answer with status instead of
+// reaching the handler. A 429 also carries a Retry-After header.
+func (s *Server) FailNext(path string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[path] = &fault{status: status, times: n}
+}
+
+// SetLatency delays every response by d, or until the request is cancelled
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// RevokeAPIKey invalidates an issued API key, as an expired session would
+func (s *Server) RevokeAPIKey(apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.apiKeys, apiKey)
+}
+
+// Requests returns how many requests reached path, including injected failures
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// RequestIDs returns the X-Request-Id of every request that reached path, in
+// order; requests without one appear as ""
+func (s *Server) RequestIDs(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requestIDs[path]...)
+}
+
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.requestIDs[r.URL.Path] = append(s.requestIDs[r.URL.Path], r.Header.Get(luganodes.RequestIDHeader))
+		latency := s.latency
+		var status int
+		if f, ok := s.faults[r.URL.Path]; ok && f.times > 0 {
+			f.times--
+			status = f.status
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if status != 0 {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+   ---------- STATE TRANSITIONS ----------
+*/
+
+// Activate moves every pending validator of a provision to active, assigning
+// validator indices, and marks the provision completed
+func (s *Server) Activate(provisionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.provisions[provisionID]
+	if !ok {
+		return fmt.Errorf("unknown provision %s", provisionID)
+	}
+	for _, v := range p.validators {
+		if v.status == ValidatorPending {
+			v.status = ValidatorActive
+			v.index = s.nextIndex
+			s.nextIndex++
+		}
+	}
+	p.Status = ProvisionCompleted
+	return nil
+}
+
+// CompleteExits moves every exiting validator to exited
+func (s *Server) CompleteExits() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.validators {
+		if v.status == ValidatorExiting {
+			v.status = ValidatorExited
+		}
+	}
+}
+
+// SetEpoch sets the epoch stamped on generated exit messages
+func (s *Server) SetEpoch(epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch = epoch
+}
+
+// SetNetwork sets the network whose exit domain validators sign with
+func (s *Server) SetNetwork(network consensus.Network) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.network = network
+}
+
+// SetBeaconCredentials makes the beacon node report creds for a validator,
+// e.g. 0x00 BLS credentials the API does not know about
+func (s *Server) SetBeaconCredentials(pubkey, creds string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.validators[strings.ToLower(pubkey)]
+	if !ok {
+		return fmt.Errorf("unknown validator %s", pubkey)
+	}
+	v.beaconCreds = creds
+	return nil
+}
+
+// SetBeaconStatus makes the fake beacon node report status for a validator
+// in place of the one its Luganodes status maps to
+func (s *Server) SetBeaconStatus(pubkey, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.validators[strings.ToLower(pubkey)]
+	if !ok {
+		return fmt.Errorf("unknown validator %s", pubkey)
+	}
+	v.beaconState = status
+	return nil
+}
+
+// ValidatorStatus reports the status of a validator by pubkey
+func (s *Server) ValidatorStatus(pubkey string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.validators[strings.ToLower(pubkey)]
+	if !ok {
+		return "", false
+	}
+	return v.status, true
+}
+
+/*
+   ---------- HANDLERS ----------
+*/
+
+type authResponse struct {
+	Result struct {
+		User struct {
+			APIKey string `json:"apiKey"`
+		} `json:"user"`
+	} `json:"result"`
+}
+
+func (s *Server) handleSignup(w http.ResponseWriter, r *http.Request) {
+	var req luganodes.SignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Email == "" || req.Password == "" || req.OrgName == "" {
+		writeError(w, http.StatusBadRequest, "email, password and orgName are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[req.Email]; exists {
+		writeError(w, http.StatusConflict, "user already exists")
+		return
+	}
+	u := &user{
+		email:    req.Email,
+		password: req.Password,
+		orgName:  req.OrgName,
+		apiKey:   randomHex(16),
+	}
+	s.users[u.email] = u
+	s.apiKeys[u.apiKey] = u
+
+	var resp authResponse
+	resp.Result.User.APIKey = u.apiKey
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req luganodes.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[req.Email]
+	if !ok || u.password != req.Password {
+		writeError(w, http.StatusUnauthorized, "invalid email or password")
+		return
+	}
+
+	// Every login issues a fresh key and invalidates the previous one
+	delete(s.apiKeys, u.apiKey)
+	u.apiKey = randomHex(16)
+	s.apiKeys[u.apiKey] = u
+
+	var resp authResponse
+	resp.Result.User.APIKey = u.apiKey
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type authedHandler func(w http.ResponseWriter, r *http.Request, u *user)
+
+func (s *Server) authenticated(h authedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		u, ok := s.apiKeys[r.Header.Get("api-key")]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		h(w, r, u)
+	}
+}
+
+func (s *Server) handleCreateProvision(w http.ResponseWriter, r *http.Request, u *user) {
+	var req luganodes.ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !common.IsHexAddress(req.WithdrawalAddress) {
+		writeError(w, http.StatusBadRequest, "withdrawalAddress must be a hex address")
+		return
+	}
+	if req.ValidatorsCount <= 0 {
+		writeError(w, http.StatusBadRequest, "validatorsCount must be positive")
+		return
+	}
+	amount := req.AmountPerValidator
+	if amount == 0 {
+		amount = 32
+	}
+	if !req.Compounding && amount != 32 {
+		writeError(w, http.StatusBadRequest, "amountPerValidator must be 32 for non-compounding validators")
+		return
+	}
+	if req.Compounding && (amount < 32 || amount > 2048) {
+		writeError(w, http.StatusBadRequest, "amountPerValidator must be between 32 and 2048")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &provision{owner: u.email}
+	p.ProvisionId = randomUUID()
+	p.WithdrawalAddress = req.WithdrawalAddress
+	p.Status = ProvisionPending
+	p.Created = time.Now().UTC().Format(time.RFC3339)
+	p.ValidatorsCount = req.ValidatorsCount
+	p.ControllerAddress = req.ControllerAddress
+	p.FeeRecipient = req.FeeRecipient
+
+	for range req.ValidatorsCount {
+		key := blstest.NewKey()
+		v := &validator{
+			key:         key,
+			pubkey:      key.Pubkey.String(),
+			amount:      amount,
+			status:      ValidatorPending,
+			provisionID: p.ProvisionId,
+			compounding: req.Compounding,
+		}
+		p.validators = append(p.validators, v)
+		s.validators[v.pubkey] = v
+	}
+	s.provisions[p.ProvisionId] = p
+
+	writeJSON(w, http.StatusCreated, p.ProvisionResponse)
+}
+
+func (s *Server) handleGetProvision(w http.ResponseWriter, r *http.Request, u *user) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.provisions[r.URL.Query().Get("provisionId")]
+	if !ok || p.owner != u.email {
+		writeError(w, http.StatusNotFound, "provision not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.ProvisionResponse)
+}
+
+func (s *Server) handleListValidators(w http.ResponseWriter, r *http.Request, u *user) {
+	q := r.URL.Query()
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, "page must be a positive integer")
+		return
+	}
+	perPage, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || perPage < 1 || perPage > 100 {
+		writeError(w, http.StatusBadRequest, "per_page must be between 1 and 100")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.provisions[q.Get("provisionId")]
+	if !ok || p.owner != u.email {
+		writeError(w, http.StatusNotFound, "provision not found")
+		return
+	}
+
+	result := []luganodes.ValidatorObject{}
+	start := (page - 1) * perPage
+	for i := start; i < len(p.validators) && i < start+perPage; i++ {
+		v := p.validators[i]
+		result = append(result, luganodes.ValidatorObject{
+			Amount:                v.amount,
+			ValidatorIndex:        v.index,
+			Status:                v.status,
+			ValidatorAddress:      v.pubkey,
+			DepositInput:          depositInput(v),
+			WithdrawalCredentials: withdrawalCredentials(v, p.WithdrawalAddress),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"result": result})
+}
+
+func (s *Server) handleExit(w http.ResponseWriter, r *http.Request, u *user) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.checkExitChallenge(w, r, u)
+	if !ok {
+		return
+	}
+	switch v.status {
+	case ValidatorActive:
+	case ValidatorExiting:
+		writeError(w, http.StatusConflict, "exit already requested")
+		return
+	default:
+		writeError(w, http.StatusConflict, fmt.Sprintf("validator is %s", v.status))
+		return
+	}
+	v.status = ValidatorExiting
+	v.exitEpoch = s.epoch
+
+	writeJSON(w, http.StatusOK, luganodes.ExitResponse{Message: "exit submitted"})
+}
+
+func (s *Server) handleExitMessage(w http.ResponseWriter, r *http.Request, u *user) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.checkExitChallenge(w, r, u)
+	if !ok {
+		return
+	}
+	if v.status != ValidatorActive && v.status != ValidatorExiting {
+		writeError(w, http.StatusConflict, fmt.Sprintf("validator is %s", v.status))
+		return
+	}
+
+	epoch := s.epoch
+	if v.status == ValidatorExiting {
+		epoch = v.exitEpoch
+	}
+	msg, err := s.signedExit(v, epoch)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, luganodes.ExitResponse{Message: msg})
+}
+
+// checkExitChallenge resolves the validator named by the key query parameter
+// and checks the challenge was signed by its withdrawal address. It must be
+// called with s.mu held.
+func (s *Server) checkExitChallenge(w http.ResponseWriter, r *http.Request, u *user) (*validator, bool) {
+	var req luganodes.ExitChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return nil, false
+	}
+
+	v, ok := s.validators[strings.ToLower(r.URL.Query().Get("key"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "validator not found")
+		return nil, false
+	}
+	p := s.provisions[v.provisionID]
+	if p.owner != u.email {
+		writeError(w, http.StatusNotFound, "validator not found")
+		return nil, false
+	}
+
+	sig, err := hexutil.Decode(req.Signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		writeError(w, http.StatusBadRequest, "signature must be 65 hex-encoded bytes")
+		return nil, false
+	}
+	pub, err := crypto.SigToPub(crypto.Keccak256([]byte(req.Challenge)), sig)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid signature")
+		return nil, false
+	}
+	if crypto.PubkeyToAddress(*pub) != common.HexToAddress(p.WithdrawalAddress) {
+		writeError(w, http.StatusForbidden, "challenge not signed by withdrawal address")
+		return nil, false
+	}
+	return v, true
+}
+
+/*
+   ---------- HELPERS ----------
+*/
+
+// signedExit renders the exit message the API hands back for v, signed with
+// the validator key for the configured network. It must be called with s.mu
+// held.
+func (s *Server) signedExit(v *validator, epoch uint64) (string, error) {
+	b, err := json.Marshal(v.key.Exit(uint64(v.index), epoch, s.network))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// depositInput stands in for the deposit contract calldata: the deposit()
+// selector followed by the validator pubkey
+func depositInput(v *validator) string {
+	return "0x22895118" + strings.TrimPrefix(v.pubkey, "0x")
+}
+
+// withdrawalCredentials is the 0x01 or 0x02 credential for the provision's
+// withdrawal address
+func withdrawalCredentials(v *validator, withdrawalAddress string) string {
+	prefix := "0x01"
+	if v.compounding {
+		prefix = "0x02"
+	}
+	addr := common.HexToAddress(withdrawalAddress)
+	return prefix + strings.Repeat("00", 11) + hex.EncodeToString(addr[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randomUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,428 @@
+package luganodes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader carries the ID RequestID assigns to each outbound request
+const RequestIDHeader = "X-Request-Id"
+
+// Middleware wraps a RoundTripper with extra behaviour
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base with mws. The first middleware sees the request first and
+// the response last. A nil base means http.DefaultTransport.
+func Chain(base http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		base = mws[i](base)
+	}
+	return base
+}
+
+// Use installs mws around the client's current transport. Middlewares see
+// requests after the api-key header is set, so anything that logs or stores
+// them must sanitize first, as the ones in this package do.
+func (c *Client) Use(mws ...Middleware) {
+	c.HTTPClient = use(c.HTTPClient, mws)
+}
+
+// Use installs mws around the auth client's current transport
+func (a *AuthClient) Use(mws ...Middleware) {
+	a.HTTPClient = use(a.HTTPClient, mws)
+}
+
+// use returns a copy of hc so a client shared with other code is not changed
+func use(hc *http.Client, mws []Middleware) *http.Client {
+	wrapped := &http.Client{}
+	if hc != nil {
+		*wrapped = *hc
+	}
+	wrapped.Transport = Chain(wrapped.Transport, mws...)
+	return wrapped
+}
+
+/*
+   ---------- REQUEST IDS ----------
+*/
+
+// RequestID tags every request with a random X-Request-Id unless the caller
+// already set one. Install it before Logging and Recorder so they can report
+// the ID.
+func RequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(RequestIDHeader, newRequestID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+/*
+   ---------- LOGGING ----------
+*/
+
+// Logging writes one structured record per request with the method, the
+// sanitized URL, the status and the latency. Credential headers and query
+// parameters are redacted; request and response headers are logged at debug
+// level.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("url", sanitizeURL(req.URL)),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if id := req.Header.Get(RequestIDHeader); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+				logger.LogAttrs(ctx, slog.LevelError, "luganodes request failed", attrs...)
+				return nil, err
+			}
+
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				attrs = append(attrs,
+					slog.Any("request_headers", sanitizeHeader(req.Header)),
+					slog.Any("response_headers", sanitizeHeader(resp.Header)),
+				)
+			}
+			level := slog.LevelInfo
+			if resp.StatusCode >= 400 {
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(ctx, level, "luganodes request", attrs...)
+			return resp, nil
+		})
+	}
+}
+
+/*
+   ---------- METRICS ----------
+*/
+
+// EndpointStats aggregates the calls made to one method and path
+type EndpointStats struct {
+	Count int
+	// Errors counts transport failures and non-2xx responses
+	Errors int
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Mean is the average latency
+func (s EndpointStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Metrics collects request counts and latencies per endpoint. The zero value
+// is ready to use.
+type Metrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+// Middleware records every request passing through it
+func (m *Metrics) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			failed := err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300
+			m.observe(req.Method+" "+req.URL.Path, time.Since(start), failed)
+			return resp, err
+		})
+	}
+}
+
+func (m *Metrics) observe(endpoint string, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.endpoints == nil {
+		m.endpoints = make(map[string]*EndpointStats)
+	}
+	s, ok := m.endpoints[endpoint]
+	if !ok {
+		s = &EndpointStats{}
+		m.endpoints[endpoint] = s
+	}
+	s.Count++
+	s.Total += d
+	s.Max = max(s.Max, d)
+	if failed {
+		s.Errors++
+	}
+}
+
+// Snapshot returns a copy of the stats keyed by "METHOD /path"
+func (m *Metrics) Snapshot() map[string]EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]EndpointStats, len(m.endpoints))
+	for k, s := range m.endpoints {
+		out[k] = *s
+	}
+	return out
+}
+
+func (m *Metrics) String() string {
+	snap := m.Snapshot()
+	endpoints := make([]string, 0, len(snap))
+	for k := range snap {
+		endpoints = append(endpoints, k)
+	}
+	sort.Strings(endpoints)
+
+	var b strings.Builder
+	for _, k := range endpoints {
+		s := snap[k]
+		fmt.Fprintf(&b, "%s count=%d errors=%d mean=%s max=%s\n", k, s.Count, s.Errors, s.Mean(), s.Max)
+	}
+	return b.String()
+}
+
+/*
+   ---------- RECORDER ----------
+*/
+
+// RecordedExchange is one sanitized request/response pair as written by
+// Recorder
+type RecordedExchange struct {
+	RequestID string    `json:"requestId,omitempty"`
+	Time      time.Time `json:"time"`
+	Duration  string    `json:"duration"`
+	Request   struct {
+		Method string          `json:"method"`
+		URL    string          `json:"url"`
+		Header http.Header     `json:"header"`
+		Body   json.RawMessage `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status,omitempty"`
+		Header http.Header     `json:"header,omitempty"`
+		Body   json.RawMessage `json:"body,omitempty"`
+	} `json:"response"`
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder writes every request/response pair to its own JSON file in dir so
+// the exact traffic can be attached to a support ticket. Credential headers,
+// query parameters and JSON fields are redacted, as is the api-key value
+// wherever it appears in a body.
+func Recorder(dir string) (Middleware, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	var seq atomic.Uint64
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// A RoundTripper must not modify the caller's request
+			req = req.Clone(req.Context())
+
+			var rec RecordedExchange
+			rec.RequestID = req.Header.Get(RequestIDHeader)
+			rec.Time = time.Now().UTC()
+			secret := Secret(req.Header.Get("api-key"))
+
+			reqBody, err := peekRequestBody(req)
+			if err != nil {
+				return nil, err
+			}
+			rec.Request.Method = req.Method
+			rec.Request.URL = sanitizeURL(req.URL)
+			rec.Request.Header = sanitizeHeader(req.Header)
+			rec.Request.Body = sanitizeBody(reqBody, secret)
+
+			resp, err := next.RoundTrip(req)
+			rec.Duration = time.Since(rec.Time).String()
+			if err != nil {
+				rec.Error = err.Error()
+			} else {
+				respBody, readErr := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				resp.Body = io.NopCloser(bytes.NewReader(respBody))
+				if readErr != nil {
+					return nil, readErr
+				}
+				rec.Response.Status = resp.StatusCode
+				rec.Response.Header = sanitizeHeader(resp.Header)
+				rec.Response.Body = sanitizeBody(respBody, secret)
+			}
+
+			name := fmt.Sprintf("%s-%04d", rec.Time.Format("20060102T150405.000"), seq.Add(1))
+			if rec.RequestID != "" {
+				name += "-" + rec.RequestID
+			}
+			if werr := writeRecord(filepath.Join(dir, name+".json"), &rec); werr != nil {
+				slog.WarnContext(req.Context(), "luganodes: could not record exchange", "error", werr)
+			}
+			return resp, err
+		})
+	}, nil
+}
+
+func writeRecord(path string, rec *RecordedExchange) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// peekRequestBody returns the body of req, a clone the caller does not
+// hold. With GetBody the body is read from a fresh copy and req.Body is sent
+// untouched; otherwise it is read into memory and req gets a replayable
+// copy.
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, nil
+}
+
+/*
+   ---------- SANITIZING ----------
+*/
+
+// sensitiveNames are header, query and JSON field names whose values are
+// credentials, compared case-insensitively with '-' and '_' ignored
+var sensitiveNames = map[string]bool{
+	"apikey":        true,
+	"authorization": true,
+	"cookie":        true,
+	"setcookie":     true,
+	"password":      true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"secret":        true,
+	"privatekey":    true,
+}
+
+func isSensitive(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	return sensitiveNames[name]
+}
+
+func sanitizeHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for name := range out {
+		if isSensitive(name) {
+			out[name] = []string{redacted}
+		}
+	}
+	return out
+}
+
+func sanitizeURL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for name := range q {
+		if isSensitive(name) {
+			q[name] = []string{redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	clean := *u
+	clean.RawQuery = q.Encode()
+	return clean.String()
+}
+
+// sanitizeBody redacts sensitive fields of a JSON body and any occurrence of
+// secrets. Bodies that are not JSON are stored as a JSON string.
+func sanitizeBody(body []byte, secrets ...Secret) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if clean, err := json.Marshal(redactJSON(v)); err == nil {
+			body = clean
+		}
+	} else {
+		body, _ = json.Marshal(string(body))
+	}
+	return json.RawMessage(redact(string(body), secrets...))
+}
+
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if isSensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,149 @@
+package luganodes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestMiddlewareLogsWithoutSecrets(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var metrics luganodes.Metrics
+
+	auth := luganodes.NewAuthClient(srv.URL)
+	auth.Use(luganodes.RequestID(), luganodes.Logging(logger), metrics.Middleware())
+	client := luganodes.NewSessionClient(luganodes.NewSession(auth, "ops@example.com", "hunter2"), srv.URL)
+	client.Use(luganodes.RequestID(), luganodes.Logging(logger), metrics.Middleware())
+
+	if _, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	if _, err := client.GetProvision(ctx, "missing"); err == nil {
+		t.Fatalf("expected an error for an unknown provision")
+	}
+	apiKey, err := client.Session.APIKey(ctx)
+	if err != nil {
+		t.Fatalf("api key: %v", err)
+	}
+
+	out := logs.String()
+	if strings.Contains(out, apiKey.Reveal()) || strings.Contains(out, "hunter2") {
+		t.Fatalf("secret leaked into logs: %s", out)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(strings.Split(out, "\n")[0]), &record); err != nil {
+		t.Fatalf("bad log record: %v", err)
+	}
+	if record["status"] != float64(201) {
+		t.Fatalf("expected status in %v", record)
+	}
+	id, ok := record["request_id"].(string)
+	if sent := srv.RequestIDs("/api/signup"); !ok || id == "" || len(sent) != 1 || sent[0] != id {
+		t.Fatalf("expected request_id %q to be the X-Request-Id the server got, %v", id, sent)
+	}
+
+	snap := metrics.Snapshot()
+	if s := snap["GET /api/provision"]; s.Count != 1 || s.Errors != 1 {
+		t.Fatalf("expected one failed provision lookup, got %+v", s)
+	}
+	if s := snap["POST /api/login"]; s.Count != 1 || s.Errors != 0 {
+		t.Fatalf("expected one login, got %+v", s)
+	}
+}
+
+func TestRecorderSanitizesExchanges(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	recorder, err := luganodes.Recorder(dir)
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	auth := luganodes.NewAuthClient(srv.URL)
+	auth.Use(luganodes.RequestID(), recorder)
+	resp, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example")
+	if err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	apiKey := resp.Result.User.APIKey.Reveal()
+
+	client := luganodes.NewClient(apiKey, srv.URL)
+	client.Use(luganodes.RequestID(), recorder)
+	provision, err := client.CreateProvision(ctx, luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   1,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	if provision.ValidatorsCount != 1 {
+		t.Fatalf("recorder changed the response: %+v", provision)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("expected 2 recorded exchanges, got %d", len(files))
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), apiKey) || strings.Contains(string(data), "hunter2") {
+			t.Fatalf("secret leaked into %s: %s", f, data)
+		}
+		var rec luganodes.RecordedExchange
+		if err := json.Unmarshal(data, &rec); err != nil {
+			t.Fatalf("bad record %s: %v", f, err)
+		}
+		if rec.RequestID == "" || rec.Response.Status/100 != 2 || len(rec.Request.Body) == 0 {
+			t.Fatalf("incomplete record %s: %s", f, data)
+		}
+	}
+}
+
+func TestRecorderLeavesCallerRequestAlone(t *testing.T) {
+	recorder, err := luganodes.Recorder(t.TempDir())
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	var sent []string
+	rt := recorder(luganodes.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := io.ReadAll(req.Body)
+		sent = append(sent, string(b))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}}, nil
+	}))
+
+	// With GetBody, and with a plain reader the request cannot replay
+	withGetBody, _ := http.NewRequest(http.MethodPost, "http://example.invalid", strings.NewReader(`{"a":1}`))
+	plain, _ := http.NewRequest(http.MethodPost, "http://example.invalid", io.NopCloser(strings.NewReader(`{"a":2}`)))
+	for _, req := range []*http.Request{withGetBody, plain} {
+		body, getBody := req.Body, req.GetBody
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != body || (req.GetBody == nil) != (getBody == nil) {
+			t.Fatalf("recorder replaced the caller's request body")
+		}
+	}
+	if len(sent) != 2 || sent[0] != `{"a":1}` || sent[1] != `{"a":2}` {
+		t.Fatalf("unexpected bodies sent %q", sent)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -57,14 +59,42 @@ func (c *Client) CreateProvision(
 	return &result, nil
 }
 
+// GetProvision fetches the current state of a provision
+func (c *Client) GetProvision(
+	ctx context.Context,
+	provisionId string,
+) (*ProvisionResponse, error) {
+	query := url.Values{}
+	query.Set("provisionId", provisionId)
+	reqURL := fmt.Sprintf("%s/api/provision?%s", c.BaseURL, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ProvisionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type ValidatorObject struct {
+	Amount                float64 `json:"amount"`
+	ValidatorIndex        int     `json:"validatorIndex"`
+	Status                string  `json:"status"`
+	ValidatorAddress      string  `json:"validatorAddress"`
+	DepositInput          string  `json:"depositInput"`
+	WithdrawalCredentials string  `json:"withdrawalCredentials,omitempty"`
+}
+
 type ValidatorObjectsResponse struct {
-	Result []struct {
-		Amount           float64 `json:"amount"`
-		ValidatorIndex   int     `json:"validatorIndex"`
-		Status           string  `json:"status"`
-		ValidatorAddress string  `json:"validatorAddress"`
-		DepositInput     string  `json:"depositInput"`
-	} `json:"result"`
+	Result []ValidatorObject `json:"result"`
 }
 
 func (c *Client) GetValidatorObjects(
@@ -72,10 +102,16 @@ func (c *Client) GetValidatorObjects(
 	provisionId string,
 	page, perPage int,
 ) (*ValidatorObjectsResponse, error) {
-	url := fmt.Sprintf("%s/api/validators?provisionId=%s&page=%d&per_page=%d",
-		c.BaseURL, provisionId, page, perPage)
+	query := url.Values{}
+	query.Set("provisionId", provisionId)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+	reqURL := fmt.Sprintf("%s/api/validators?%s", c.BaseURL, query.Encode())
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
 	body, _, err := c.doRequest(req)
 	if err != nil {
 		return nil, err
@@ -87,3 +123,23 @@ func (c *Client) GetValidatorObjects(
 	}
 	return &result, nil
 }
+
+// ListProvisionValidators walks every page of a provision's validators
+func (c *Client) ListProvisionValidators(
+	ctx context.Context,
+	provisionId string,
+) ([]ValidatorObject, error) {
+	const perPage = 100
+
+	var all []ValidatorObject
+	for page := 1; ; page++ {
+		resp, err := c.GetValidatorObjects(ctx, provisionId, page, perPage)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Result...)
+		if len(resp.Result) < perPage {
+			return all, nil
+		}
+	}
+}
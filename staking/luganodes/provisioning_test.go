@@ -0,0 +1,142 @@
+package luganodes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestCreateProvision(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	resp, err := client.CreateProvision(context.Background(), luganodes.ProvisionRequest{
+		WithdrawalAddress:  "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:    3,
+		AmountPerValidator: 32,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	if resp.ProvisionId == "" {
+		t.Fatalf("expected a provision ID")
+	}
+	if resp.Status != luganodestest.ProvisionPending {
+		t.Fatalf("expected status %s, got %s", luganodestest.ProvisionPending, resp.Status)
+	}
+	if resp.ValidatorsCount != 3 {
+		t.Fatalf("expected 3 validators, got %d", resp.ValidatorsCount)
+	}
+}
+
+func TestGetProvisionStatus(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	ctx := context.Background()
+
+	created, err := client.CreateProvision(ctx, luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   1,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+	if err := srv.Activate(created.ProvisionId); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+
+	got, err := client.GetProvision(ctx, created.ProvisionId)
+	if err != nil {
+		t.Fatalf("get provision failed: %v", err)
+	}
+	if got.Status != luganodestest.ProvisionCompleted {
+		t.Fatalf("expected status %s, got %s", luganodestest.ProvisionCompleted, got.Status)
+	}
+}
+
+func TestCreateProvisionRejectsBadAmount(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	_, err := client.CreateProvision(context.Background(), luganodes.ProvisionRequest{
+		WithdrawalAddress:  "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:    1,
+		AmountPerValidator: 64,
+	})
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 APIError, got %v", err)
+	}
+}
+
+func TestGetValidatorObjectsPagination(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	ctx := context.Background()
+
+	prov, err := client.CreateProvision(ctx, luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   5,
+	})
+	if err != nil {
+		t.Fatalf("create provision failed: %v", err)
+	}
+
+	seen := map[string]bool{}
+	var pages []int
+	for page := 1; ; page++ {
+		resp, err := client.GetValidatorObjects(ctx, prov.ProvisionId, page, 2)
+		if err != nil {
+			t.Fatalf("page %d failed: %v", page, err)
+		}
+		if len(resp.Result) == 0 {
+			break
+		}
+		pages = append(pages, len(resp.Result))
+		for _, v := range resp.Result {
+			if v.Status != luganodestest.ValidatorPending {
+				t.Fatalf("expected pending validator, got %s", v.Status)
+			}
+			seen[v.ValidatorAddress] = true
+		}
+	}
+	if len(pages) != 3 || pages[0] != 2 || pages[1] != 2 || pages[2] != 1 {
+		t.Fatalf("expected pages of 2,2,1 got %v", pages)
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 distinct validators, got %d", len(seen))
+	}
+
+	if err := srv.Activate(prov.ProvisionId); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	resp, err := client.GetValidatorObjects(ctx, prov.ProvisionId, 1, 10)
+	if err != nil {
+		t.Fatalf("list after activation failed: %v", err)
+	}
+	for _, v := range resp.Result {
+		if v.Status != luganodestest.ValidatorActive || v.ValidatorIndex == 0 {
+			t.Fatalf("expected active validator with an index, got %+v", v)
+		}
+	}
+}
+
+func TestGetValidatorObjectsUnknownProvision(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	_, err := client.GetValidatorObjects(context.Background(), "missing", 1, 10)
+	var apiErr *luganodes.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 APIError, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package luganodes
+
+import (
+	"log/slog"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a credential such as a password or API key. It formats, logs and
+// marshals as [REDACTED]; Reveal returns the raw value.
+type Secret string
+
+// Reveal returns the raw secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// LogValue implements slog.LogValuer
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// UnmarshalText keeps the decoded value so API responses can populate a Secret
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
+}
+
+// redact replaces every occurrence of the given secrets in s
+func redact(s string, secrets ...Secret) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret.Reveal(), redacted)
+		}
+	}
+	return s
+}
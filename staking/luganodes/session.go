@@ -0,0 +1,63 @@
+package luganodes
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Session logs into Luganodes on demand, caches the issued API key and
+// renews it when the API starts rejecting it
+type Session struct {
+	auth     *AuthClient
+	email    string
+	password Secret
+
+	mu     sync.Mutex
+	apiKey Secret
+}
+
+// NewSession returns a session that logs in as email on first use
+func NewSession(auth *AuthClient, email, password string) *Session {
+	return &Session{
+		auth:     auth,
+		email:    email,
+		password: Secret(password),
+	}
+}
+
+// APIKey returns the cached API key, logging in if there is none yet
+func (s *Session) APIKey(ctx context.Context) (Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.apiKey != "" {
+		return s.apiKey, nil
+	}
+	return s.login(ctx)
+}
+
+// Renew logs in again unless the cached key already differs from stale,
+// which means a concurrent caller renewed it first
+func (s *Session) Renew(ctx context.Context, stale Secret) (Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.apiKey != "" && s.apiKey != stale {
+		return s.apiKey, nil
+	}
+	return s.login(ctx)
+}
+
+// login must be called with s.mu held
+func (s *Session) login(ctx context.Context) (Secret, error) {
+	resp, err := s.auth.Login(ctx, s.email, s.password.Reveal())
+	if err != nil {
+		return "", err
+	}
+	if resp.Result.User.APIKey == "" {
+		return "", errors.New("luganodes: login returned no API key")
+	}
+	s.apiKey = resp.Result.User.APIKey
+	return s.apiKey, nil
+}
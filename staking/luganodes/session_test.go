@@ -0,0 +1,119 @@
+package luganodes_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestSignupPasswordWithQuotes(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	auth := luganodes.NewAuthClient(srv.URL)
+	password := `p"ass","orgName":"Injected`
+
+	if _, err := auth.Signup(ctx, "ops@example.com", password, "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	if _, err := auth.Login(ctx, "ops@example.com", password); err != nil {
+		t.Fatalf("login with the same password failed: %v", err)
+	}
+}
+
+func TestSessionRenewsOnUnauthorized(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	auth := luganodes.NewAuthClient(srv.URL)
+	if _, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+
+	session := luganodes.NewSession(auth, "ops@example.com", "hunter2")
+	client := luganodes.NewSessionClient(session, srv.URL)
+	req := luganodes.ProvisionRequest{
+		WithdrawalAddress: "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ValidatorsCount:   1,
+	}
+
+	if _, err := client.CreateProvision(ctx, req); err != nil {
+		t.Fatalf("first provision failed: %v", err)
+	}
+	first, err := session.APIKey(ctx)
+	if err != nil {
+		t.Fatalf("api key: %v", err)
+	}
+
+	srv.RevokeAPIKey(first.Reveal())
+	if _, err := client.CreateProvision(ctx, req); err != nil {
+		t.Fatalf("provision after revocation failed: %v", err)
+	}
+	second, _ := session.APIKey(ctx)
+	if second == first {
+		t.Fatalf("expected the session to hold a renewed key")
+	}
+	if n := srv.Requests("/api/login"); n != 2 {
+		t.Fatalf("expected 2 logins, got %d", n)
+	}
+}
+
+func TestSessionGivesUpAfterOneRenewal(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	auth := luganodes.NewAuthClient(srv.URL)
+	if _, err := auth.Signup(ctx, "ops@example.com", "hunter2", "Example"); err != nil {
+		t.Fatalf("signup failed: %v", err)
+	}
+	client := luganodes.NewSessionClient(luganodes.NewSession(auth, "ops@example.com", "hunter2"), srv.URL)
+
+	srv.FailNext("/api/validators", http.StatusUnauthorized, 2)
+	if _, err := client.GetValidatorObjects(ctx, "any", 1, 10); err == nil {
+		t.Fatalf("expected persistent 401 to surface")
+	}
+	if n := srv.Requests("/api/validators"); n != 2 {
+		t.Fatalf("expected exactly one replay, got %d requests", n)
+	}
+}
+
+func TestSecretsRedactedFromErrorsAndLogs(t *testing.T) {
+	// A misbehaving API that echoes the request back in its error body
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "bad request %s key=%s", body, r.Header.Get("api-key"))
+	}))
+	defer echo.Close()
+	ctx := context.Background()
+
+	_, err := luganodes.NewAuthClient(echo.URL).Login(ctx, "ops@example.com", "hunter2")
+	if err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("expected an error without the password, got %v", err)
+	}
+
+	client := luganodes.NewClient("sk-live-123", echo.URL)
+	_, err = client.GetProvision(ctx, "any")
+	if err == nil || strings.Contains(err.Error(), "sk-live-123") {
+		t.Fatalf("expected an error without the API key, got %v", err)
+	}
+
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("client", "apiKey", client.APIKey)
+	formatted := fmt.Sprintf("%v %+v %#v", client.APIKey, *client, client.APIKey)
+	if strings.Contains(logs.String()+formatted, "sk-live-123") {
+		t.Fatalf("API key leaked: %s %s", logs.String(), formatted)
+	}
+}
@@ -0,0 +1,22 @@
+package luganodes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"consensus"
+)
+
+// ParseSignedVoluntaryExit decodes the JSON exit message Luganodes returns
+func ParseSignedVoluntaryExit(message string) (*consensus.SignedVoluntaryExit, error) {
+	var exit consensus.SignedVoluntaryExit
+	if err := json.Unmarshal([]byte(message), &exit); err != nil {
+		return nil, fmt.Errorf("luganodes: malformed signed voluntary exit: %w", err)
+	}
+	return &exit, nil
+}
+
+// SignedVoluntaryExit parses the exit message carried by the response
+func (r *ExitResponse) SignedVoluntaryExit() (*consensus.SignedVoluntaryExit, error) {
+	return ParseSignedVoluntaryExit(r.Message)
+}
@@ -0,0 +1,115 @@
+package luganodes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"consensus"
+	"luganodes"
+	"luganodes/luganodestest"
+)
+
+func TestParseSignedVoluntaryExit(t *testing.T) {
+	sig := "0x" + repeatHex("ab", 96)
+	for _, msg := range []string{
+		`{"message":{"epoch":"1234","validator_index":"56"},"signature":"` + sig + `"}`,
+		`{"message":{"epoch":1234,"validator_index":56},"signature":"` + sig + `"}`,
+	} {
+		exit, err := luganodes.ParseSignedVoluntaryExit(msg)
+		if err != nil {
+			t.Fatalf("parse %s: %v", msg, err)
+		}
+		if exit.Message.Epoch != 1234 || exit.Message.ValidatorIndex != 56 {
+			t.Fatalf("unexpected message %+v", exit.Message)
+		}
+		if exit.Signature.String() != sig {
+			t.Fatalf("unexpected signature %s", exit.Signature)
+		}
+	}
+
+	for _, msg := range []string{
+		`not json`,
+		`{"message":{"epoch":"-1","validator_index":"56"},"signature":"` + sig + `"}`,
+		`{"message":{"epoch":"1","validator_index":"56"},"signature":"0xabcd"}`,
+	} {
+		if _, err := luganodes.ParseSignedVoluntaryExit(msg); err == nil {
+			t.Fatalf("expected error parsing %s", msg)
+		}
+	}
+}
+
+func TestGenerateVerifiedExit(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	ctx := context.Background()
+
+	keyHex := newWithdrawalKey(t)
+	pubkey := provisionActive(t, srv, client, keyHex, 1)[0]
+	sig, _ := luganodes.SignMessage([]byte("c"), keyHex)
+
+	if _, err := client.GenerateVerifiedExit(ctx, pubkey, "c", sig); err == nil {
+		t.Fatalf("expected an error without a configured network")
+	}
+
+	client.Network = &consensus.Hoodi
+	exit, err := client.GenerateVerifiedExit(ctx, pubkey, "c", sig)
+	if err != nil {
+		t.Fatalf("verified exit failed: %v", err)
+	}
+	if exit.Message.Epoch != 1000 {
+		t.Fatalf("expected epoch 1000, got %d", exit.Message.Epoch)
+	}
+
+	// The same signature must not verify under another network's domain
+	client.Network = &consensus.Mainnet
+	if _, err := client.GenerateVerifiedExit(ctx, pubkey, "c", sig); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature on mainnet, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedExit(t *testing.T) {
+	srv := luganodestest.NewServer()
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	keyHex := newWithdrawalKey(t)
+	pubkeys := provisionActive(t, srv, client, keyHex, 2)
+	sig, _ := luganodes.SignMessage([]byte("c"), keyHex)
+
+	resp, err := client.GenerateExitMessage(context.Background(), pubkeys[0], "c", sig)
+	if err != nil {
+		t.Fatalf("generate exit message failed: %v", err)
+	}
+	exit, err := resp.SignedVoluntaryExit()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	pk, err := consensus.ParseBLSPubkey(pubkeys[0])
+	if err != nil {
+		t.Fatalf("parse pubkey: %v", err)
+	}
+	if err := exit.Verify(pk, consensus.Hoodi); err != nil {
+		t.Fatalf("untampered exit failed to verify: %v", err)
+	}
+
+	tampered := *exit
+	tampered.Message.Epoch++
+	if err := tampered.Verify(pk, consensus.Hoodi); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for tampered epoch, got %v", err)
+	}
+
+	other, _ := consensus.ParseBLSPubkey(pubkeys[1])
+	if err := exit.Verify(other, consensus.Hoodi); !errors.Is(err, consensus.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for another pubkey, got %v", err)
+	}
+}
+
+func repeatHex(b string, n int) string {
+	out := ""
+	for range n {
+		out += b
+	}
+	return out
+}
@@ -4,20 +4,73 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	baseURL = "https://api-test.p2p.org"
+	// TestnetBaseURL is the P2P staking API sandbox
+	TestnetBaseURL = "https://api-test.p2p.org"
+	// MainnetBaseURL is the production P2P staking API
+	MainnetBaseURL = "https://api.p2p.org"
+
+	DefaultUserAgent = "p2p-go-client/1.0"
+
+	nodesRequestPath = "/api/v1/eth/staking/direct/nodes-request"
+	vemPath          = "/api/v1/eth/staking/direct/vem"
 )
 
 /*
-   ---------- HTTP INFRA ----------
+   ---------- CLIENT ----------
 */
 
+// TokenSource supplies the bearer token for each request, so tokens can be
+// rotated or fetched lazily from a secret store
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	if t == "" {
+		return "", errors.New("p2pclient: empty bearer token")
+	}
+	return string(t), nil
+}
+
+// Client talks to the P2P staking API
+type Client struct {
+	BaseURL    string
+	Tokens     TokenSource
+	HTTPClient *http.Client
+	UserAgent  string
+	// NodesOptions, when set, is used to check node options instead of
+	// asking the API
+	NodesOptions *NodesOptions
+
+	mu sync.Mutex
+	// loadedNodesOptions caches what LoadNodesOptions got from the API
+	loadedNodesOptions *NodesOptions
+}
+
+// NewClient returns a client for baseURL authenticating with tokens
+func NewClient(baseURL string, tokens TokenSource) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Tokens:     tokens,
+		HTTPClient: NewHTTPClient(),
+		UserAgent:  DefaultUserAgent,
+	}
+}
+
 // NewHTTPClient returns a configured HTTP client
 func NewHTTPClient() *http.Client {
 	return &http.Client{
@@ -25,24 +78,106 @@ func NewHTTPClient() *http.Client {
 	}
 }
 
-// DoRequest executes an HTTP request and returns raw body + status
-func DoRequest(client *http.Client, req *http.Request) ([]byte, int, error) {
-	resp, err := client.Do(req)
+/*
+   ---------- ERRORS ----------
+*/
+
+// APIError is returned when the P2P API answers with a non-2xx status or an
+// error envelope
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Name       string `json:"name"`
+	Message    string `json:"message"`
+	// Body is the raw response when it did not carry a structured error
+	Body string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Message != "" && e.Name != "":
+		return fmt.Sprintf("p2p: API returned status %d: %s: %s", e.StatusCode, e.Name, e.Message)
+	case e.Message != "":
+		return fmt.Sprintf("p2p: API returned status %d: %s", e.StatusCode, e.Message)
+	default:
+		return fmt.Sprintf("p2p: API returned status %d: %s", e.StatusCode, e.Body)
+	}
+}
+
+// envelope is the shape of every P2P API response
+type envelope[T any] struct {
+	Error  *APIError `json:"error"`
+	Result *T        `json:"result"`
+}
+
+/*
+   ---------- REQUESTS ----------
+*/
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.Tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("p2pclient: bearer token: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
+}
+
+// do executes req and decodes the result of the response envelope into T
+func do[T any](c *Client, req *http.Request) (*T, error) {
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, resp.StatusCode, err
+		return nil, err
 	}
 
-	return body, resp.StatusCode, nil
+	var env envelope[T]
+	decodeErr := json.Unmarshal(body, &env)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || env.Error != nil {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+		if decodeErr == nil && env.Error != nil {
+			*apiErr = *env.Error
+			apiErr.StatusCode = resp.StatusCode
+		}
+		return nil, apiErr
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("p2pclient: decode %s response: %w", req.URL.Path, decodeErr)
+	}
+	if env.Result == nil {
+		return nil, fmt.Errorf("p2pclient: %s response has no result", req.URL.Path)
+	}
+	return env.Result, nil
 }
 
 /*
-   ---------- CREATE NODE REQUEST (POST) ----------
+   ---------- NODE REQUESTS ----------
 */
 
 // CreateNodeRequestPayload mirrors the API payload
@@ -59,81 +194,104 @@ type CreateNodeRequestPayload struct {
 	NodesOptions              NodesOptionsInput `json:"nodesOptions"`
 }
 
-type NodesOptionsInput struct {
-	Location  string `json:"location"`
-	RelaysSet string `json:"relaysSet"`
+// Node request types. Restaking requests set EigenPodOwnerAddress and
+// withdraw to the owner's EigenPod.
+const (
+	NodeRequestTypeRegular   = "REGULAR"
+	NodeRequestTypeRestaking = "RESTAKING"
+)
+
+// Node request statuses
+const (
+	NodeRequestInit       = "init"
+	NodeRequestProcessing = "processing"
+	NodeRequestReady      = "ready"
+	NodeRequestCancelled  = "cancelled"
+)
+
+// NodeRequest is a node request as returned by create and status
+type NodeRequest struct {
+	ID                        string            `json:"id"`
+	Type                      string            `json:"type"`
+	Status                    string            `json:"status"`
+	ValidatorsCount           int               `json:"validatorsCount"`
+	AmountPerValidator        string            `json:"amountPerValidator"`
+	WithdrawalCredentialsType string            `json:"withdrawalCredentialsType"`
+	WithdrawalAddress         string            `json:"withdrawalAddress"`
+	EigenPodOwnerAddress      string            `json:"eigenPodOwnerAddress,omitempty"`
+	ControllerAddress         string            `json:"controllerAddress"`
+	FeeRecipientAddress       string            `json:"feeRecipientAddress"`
+	NodesOptions              NodesOptionsInput `json:"nodesOptions"`
+	CreatedAt                 string            `json:"createdAt,omitempty"`
+	// ErrorMessage explains a cancelled request
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// NodeRequestStatus is a node request with the validators P2P generated.
+// DepositData is filled in once Status is ready.
+type NodeRequestStatus struct {
+	NodeRequest
+	DepositData []NodeDepositData `json:"depositData,omitempty"`
+}
+
+// NodeDepositData is one validator's signed deposit as P2P returns it. Hex
+// fields may come with or without a 0x prefix.
+type NodeDepositData struct {
+	Pubkey                string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawalCredentials"`
+	// Amount is in gwei
+	Amount             string `json:"amount"`
+	Signature          string `json:"signature"`
+	DepositMessageRoot string `json:"depositMessageRoot,omitempty"`
+	DepositDataRoot    string `json:"depositDataRoot"`
 }
 
 // NewCreateNodeRequest builds the POST request
-func NewCreateNodeRequest(
+func (c *Client) NewCreateNodeRequest(
 	ctx context.Context,
 	payload CreateNodeRequestPayload,
-	bearerToken string,
 ) (*http.Request, error) {
-	url := baseURL + "/api/v1/eth/staking/direct/nodes-request/create"
-
-	bodyBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		url,
-		bytes.NewBuffer(bodyBytes),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	return req, nil
+	return c.newRequest(ctx, http.MethodPost, nodesRequestPath+"/create", payload)
 }
 
-/*
-   ---------- GET NODE REQUEST STATUS (GET) ----------
-*/
-
 // NewGetNodeRequestStatusRequest builds the GET request
-func NewGetNodeRequestStatusRequest(
+func (c *Client) NewGetNodeRequestStatusRequest(
 	ctx context.Context,
 	nodeRequestID string,
-	bearerToken string,
 ) (*http.Request, error) {
-	url := fmt.Sprintf(
-		"%s/api/v1/eth/staking/direct/nodes-request/status/%s",
-		baseURL,
-		nodeRequestID,
-	)
+	return c.newRequest(ctx, http.MethodGet, nodesRequestPath+"/status/"+url.PathEscape(nodeRequestID), nil)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// CreateNodeRequest asks P2P to provision validators. Node options are
+// checked against LoadNodesOptions first.
+func (c *Client) CreateNodeRequest(ctx context.Context, payload CreateNodeRequestPayload) (*NodeRequest, error) {
+	opts, err := c.LoadNodesOptions(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	return req, nil
+	if err := opts.Validate(payload.NodesOptions); err != nil {
+		return nil, err
+	}
+	req, err := c.NewCreateNodeRequest(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return do[NodeRequest](c, req)
 }
 
-// doRequest executes and reads the HTTP response
-func doRequest(client *http.Client, req *http.Request) ([]byte, int, error) {
-	resp, err := client.Do(req)
+// GetNodeRequestStatus returns the current state of a node request and,
+// once ready, its deposit data
+func (c *Client) GetNodeRequestStatus(ctx context.Context, nodeRequestID string) (*NodeRequestStatus, error) {
+	req, err := c.NewGetNodeRequestStatusRequest(ctx, nodeRequestID)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	return body, resp.StatusCode, err
+	return do[NodeRequestStatus](c, req)
 }
 
-const vemBaseURL = baseURL + "/api/v1/eth/staking/direct/vem"
+/*
+   ---------- VEM ----------
+*/
 
 type VemCreatePayload struct {
 	ID                  string `json:"id"`
@@ -145,44 +303,57 @@ type VemCreatePayload struct {
 	VemRequestProof     string `json:"vemRequestProof"`
 }
 
-func NewVemCreateRequest(
+// VEM statuses
+const (
+	VemStatusPending = "pending"
+	VemStatusSuccess = "success"
+	VemStatusError   = "error"
+	VemStatusFault   = "fault"
+)
+
+// VemStatus is a VEM request as returned by create and status. VemResult is
+// set once Status is success.
+type VemStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	VemResult string `json:"vemResult,omitempty"`
+	// ErrorMessage explains an error or fault status
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+func (c *Client) NewVemCreateRequest(
 	ctx context.Context,
 	payload VemCreatePayload,
-	token string,
 ) (*http.Request, error) {
-	b, _ := json.Marshal(payload)
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		vemBaseURL+"/create",
-		bytes.NewBuffer(b),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	return req, nil
+	return c.newRequest(ctx, http.MethodPost, vemPath+"/create", payload)
 }
 
-func NewVemStatusRequest(
+func (c *Client) NewVemStatusRequest(
 	ctx context.Context,
-	id, token string,
+	id string,
 ) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		fmt.Sprintf("%s/status/%s", vemBaseURL, id),
-		nil,
-	)
+	return c.newRequest(ctx, http.MethodGet, vemPath+"/status/"+url.PathEscape(id), nil)
+}
+
+// CreateVem submits a validator exit message request. The payload is
+// verified first so a request signed by the wrong key is never sent.
+func (c *Client) CreateVem(ctx context.Context, payload VemCreatePayload) (*VemStatus, error) {
+	if err := payload.Verify(); err != nil {
+		return nil, err
+	}
+	req, err := c.NewVemCreateRequest(ctx, payload)
 	if err != nil {
 		return nil, err
 	}
+	return do[VemStatus](c, req)
+}
 
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/json")
-	return req, nil
+// GetVemStatus returns the state of a VEM request and, once done, its
+// encrypted result
+func (c *Client) GetVemStatus(ctx context.Context, id string) (*VemStatus, error) {
+	req, err := c.NewVemStatusRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return do[VemStatus](c, req)
 }
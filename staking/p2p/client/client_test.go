@@ -0,0 +1,62 @@
+package p2pclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	p2pclient "p2p/client"
+)
+
+func TestClientSendsConfiguredHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/eth/staking/direct/nodes-request/status/req-1" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("unexpected Authorization %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "ops/2" {
+			t.Errorf("unexpected User-Agent %q", got)
+		}
+		w.Write([]byte(`{"error":null,"result":{"id":"req-1","status":"ready","validatorsCount":2}}`))
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL+"/", p2pclient.StaticToken("tok"))
+	client.UserAgent = "ops/2"
+	status, err := client.GetNodeRequestStatus(context.Background(), "req-1")
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if status.Status != p2pclient.NodeRequestReady || status.ValidatorsCount != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"error":{"code":4001,"name":"ValidationError","message":"validatorsCount must be positive"},"result":null}`))
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+	_, err := client.CreateNodeRequest(context.Background(), p2pclient.CreateNodeRequestPayload{ID: "x"})
+	var apiErr *p2pclient.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Code != 4001 || apiErr.Name != "ValidationError" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestClientRequiresToken(t *testing.T) {
+	client := p2pclient.NewClient("http://127.0.0.1:1", p2pclient.StaticToken(""))
+	if _, err := client.GetVemStatus(context.Background(), "vem-1"); err == nil {
+		t.Fatalf("expected an error without a token")
+	}
+}
@@ -0,0 +1,200 @@
+package p2pclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+const (
+	nodesOptionsPath = "/api/v1/eth/staking/direct/nodes-options"
+	nodesPath        = "/api/v1/eth/staking/direct/nodes"
+)
+
+// ErrInvalidNodesOptions is returned before sending a request whose node
+// options P2P does not offer
+var ErrInvalidNodesOptions = errors.New("p2pclient: invalid nodes options")
+
+// Location is where P2P runs the nodes of a request
+type Location string
+
+const (
+	LocationAny  Location = "any"
+	LocationEU   Location = "eu"
+	LocationUS   Location = "us"
+	LocationAsia Location = "asia"
+)
+
+// RelaysSet names the MEV relays the nodes' MEV-boost uses. The empty set
+// leaves the choice to P2P.
+type RelaysSet string
+
+const (
+	RelaysSetDefault   RelaysSet = ""
+	RelaysSetMaxProfit RelaysSet = "max-profit"
+	RelaysSetEthical   RelaysSet = "ethical"
+	RelaysSetRegulated RelaysSet = "regulated"
+)
+
+// NodesOptionsInput is the nodesOptions of a node request. An empty
+// Location means any.
+type NodesOptionsInput struct {
+	Location  Location  `json:"location"`
+	RelaysSet RelaysSet `json:"relaysSet"`
+}
+
+// RelaysSetInfo describes one relay set P2P offers
+type RelaysSetInfo struct {
+	Name   RelaysSet `json:"name"`
+	Relays []string  `json:"relays"`
+	// Locations limits the set to nodes in these locations; empty means all
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// NodesOptions are the locations and relay sets a node request may use
+type NodesOptions struct {
+	Locations  []Location      `json:"locations"`
+	RelaysSets []RelaysSetInfo `json:"relaysSets"`
+	// Fallback is true when the options are the built-in list rather than
+	// the API's; relay sets are then not checked
+	Fallback bool `json:"-"`
+}
+
+// FallbackNodesOptions returns the location enum of the node request API,
+// used when the API cannot list its options. P2P publishes no fixed relay
+// sets, so the fallback leaves any relay set for the API to check.
+func FallbackNodesOptions() *NodesOptions {
+	return &NodesOptions{
+		Locations: []Location{LocationAny, LocationEU, LocationUS, LocationAsia},
+		Fallback:  true,
+	}
+}
+
+// Relays returns the set named name
+func (o *NodesOptions) Relays(name RelaysSet) (RelaysSetInfo, bool) {
+	for _, set := range o.RelaysSets {
+		if set.Name == name {
+			return set, true
+		}
+	}
+	return RelaysSetInfo{}, false
+}
+
+// Validate checks in is a combination P2P offers
+func (o *NodesOptions) Validate(in NodesOptionsInput) error {
+	location := in.Location
+	if location == "" {
+		location = LocationAny
+	}
+	if !slices.Contains(o.Locations, location) {
+		return fmt.Errorf("%w: location %q is not one of %v", ErrInvalidNodesOptions, location, o.Locations)
+	}
+	return o.validateRelaysSet(in.RelaysSet, location)
+}
+
+// validateRelaysSet checks name is offered, and offered in location unless
+// location is empty
+func (o *NodesOptions) validateRelaysSet(name RelaysSet, location Location) error {
+	if name == RelaysSetDefault || o.Fallback {
+		return nil
+	}
+	set, ok := o.Relays(name)
+	if !ok {
+		names := make([]RelaysSet, len(o.RelaysSets))
+		for i, s := range o.RelaysSets {
+			names[i] = s.Name
+		}
+		return fmt.Errorf("%w: relays set %q is not one of %v", ErrInvalidNodesOptions, name, names)
+	}
+	if location != "" && len(set.Locations) > 0 && !slices.Contains(set.Locations, location) {
+		return fmt.Errorf("%w: relays set %q is only offered in %v, not %q", ErrInvalidNodesOptions, name, set.Locations, location)
+	}
+	return nil
+}
+
+// NewGetNodesOptionsRequest builds the GET request
+func (c *Client) NewGetNodesOptionsRequest(ctx context.Context) (*http.Request, error) {
+	return c.newRequest(ctx, http.MethodGet, nodesOptionsPath, nil)
+}
+
+// GetNodesOptions lists the locations and relay sets the API offers
+func (c *Client) GetNodesOptions(ctx context.Context) (*NodesOptions, error) {
+	req, err := c.NewGetNodesOptionsRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return do[NodesOptions](c, req)
+}
+
+// LoadNodesOptions returns c.NodesOptions if set, otherwise the API's list,
+// falling back to FallbackNodesOptions when the API has no such endpoint.
+// The list is fetched once per client; any other error is returned.
+func (c *Client) LoadNodesOptions(ctx context.Context) (*NodesOptions, error) {
+	if c.NodesOptions != nil {
+		return c.NodesOptions, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loadedNodesOptions != nil {
+		return c.loadedNodesOptions, nil
+	}
+	opts, err := c.GetNodesOptions(ctx)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) &&
+		(apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed) {
+		opts, err = FallbackNodesOptions(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.loadedNodesOptions = opts
+	return opts, nil
+}
+
+/*
+   ---------- RELAYS ----------
+*/
+
+// UpdateRelaysPayload changes the relay set of running validators
+type UpdateRelaysPayload struct {
+	Pubkeys   []string  `json:"pubkeys"`
+	RelaysSet RelaysSet `json:"relaysSet"`
+}
+
+// UpdateRelaysResult lists the validators whose nodes were reconfigured
+type UpdateRelaysResult struct {
+	Pubkeys   []string  `json:"pubkeys"`
+	RelaysSet RelaysSet `json:"relaysSet"`
+}
+
+func (c *Client) NewUpdateRelaysRequest(
+	ctx context.Context,
+	payload UpdateRelaysPayload,
+) (*http.Request, error) {
+	return c.newRequest(ctx, http.MethodPost, nodesPath+"/relays-set", payload)
+}
+
+// UpdateRelays moves the nodes of existing validators to another relay set.
+// The set is checked against LoadNodesOptions first. A node's location is
+// not known here, so a set limited to some locations is left for the API to
+// check.
+func (c *Client) UpdateRelays(ctx context.Context, payload UpdateRelaysPayload) (*UpdateRelaysResult, error) {
+	if len(payload.Pubkeys) == 0 {
+		return nil, fmt.Errorf("%w: no validators to update", ErrInvalidNodesOptions)
+	}
+	opts, err := c.LoadNodesOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.validateRelaysSet(payload.RelaysSet, ""); err != nil {
+		return nil, err
+	}
+	req, err := c.NewUpdateRelaysRequest(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return do[UpdateRelaysResult](c, req)
+}
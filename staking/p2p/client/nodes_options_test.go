@@ -0,0 +1,152 @@
+package p2pclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	p2pclient "p2p/client"
+)
+
+type options = p2pclient.NodesOptionsInput
+
+func TestNodesOptionsValidate(t *testing.T) {
+	opts := &p2pclient.NodesOptions{
+		Locations: []p2pclient.Location{p2pclient.LocationAny, p2pclient.LocationEU, p2pclient.LocationUS},
+		RelaysSets: []p2pclient.RelaysSetInfo{
+			{Name: p2pclient.RelaysSetEthical, Relays: []string{"ultrasound"}},
+			{Name: p2pclient.RelaysSetRegulated, Relays: []string{"flashbots"}, Locations: []p2pclient.Location{p2pclient.LocationUS}},
+		},
+	}
+	for _, tc := range []struct {
+		in options
+		ok bool
+	}{
+		{options{}, true},
+		{options{Location: p2pclient.LocationEU, RelaysSet: p2pclient.RelaysSetEthical}, true},
+		{options{Location: p2pclient.LocationUS, RelaysSet: p2pclient.RelaysSetRegulated}, true},
+		{options{Location: p2pclient.LocationEU, RelaysSet: p2pclient.RelaysSetRegulated}, false},
+		{options{Location: p2pclient.LocationAsia}, false},
+		{options{RelaysSet: "everything"}, false},
+	} {
+		err := opts.Validate(tc.in)
+		if (err == nil) != tc.ok || (err != nil && !errors.Is(err, p2pclient.ErrInvalidNodesOptions)) {
+			t.Errorf("Validate(%+v) = %v, want ok=%t", tc.in, err, tc.ok)
+		}
+	}
+}
+
+func TestCreateNodeRequestChecksOptionsFirst(t *testing.T) {
+	var creates atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/eth/staking/direct/nodes-options":
+			w.Write([]byte(`{"result":{"locations":["any","eu"],"relaysSets":[{"name":"ethical","relays":["ultrasound"]}]}}`))
+		default:
+			creates.Add(1)
+			w.Write([]byte(`{"result":{"id":"req-1","status":"init"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+	payload := p2pclient.CreateNodeRequestPayload{ID: "req-1", NodesOptions: options{RelaysSet: p2pclient.RelaysSetMaxProfit}}
+	if _, err := client.CreateNodeRequest(context.Background(), payload); !errors.Is(err, p2pclient.ErrInvalidNodesOptions) {
+		t.Fatalf("expected a relays set the API does not list to be refused, got %v", err)
+	}
+	if creates.Load() != 0 {
+		t.Fatalf("the invalid request was sent")
+	}
+
+	payload.NodesOptions = options{Location: p2pclient.LocationEU, RelaysSet: p2pclient.RelaysSetEthical}
+	if _, err := client.CreateNodeRequest(context.Background(), payload); err != nil || creates.Load() != 1 {
+		t.Fatalf("create: %v", err)
+	}
+}
+
+func TestUpdateRelaysChecksSetFirst(t *testing.T) {
+	var updates atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/eth/staking/direct/nodes-options":
+			w.Write([]byte(`{"result":{"locations":["any","us"],"relaysSets":[{"name":"regulated","relays":["flashbots"],"locations":["us"]}]}}`))
+		default:
+			updates.Add(1)
+			w.Write([]byte(`{"result":{"pubkeys":["0xaa"],"relaysSet":"regulated"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+	payload := p2pclient.UpdateRelaysPayload{Pubkeys: []string{"0xaa"}, RelaysSet: p2pclient.RelaysSetEthical}
+	if _, err := client.UpdateRelays(context.Background(), payload); !errors.Is(err, p2pclient.ErrInvalidNodesOptions) || updates.Load() != 0 {
+		t.Fatalf("expected a relays set the API does not list to be refused, got %v", err)
+	}
+
+	// The nodes' location is unknown, so a set limited to some is sent
+	payload.RelaysSet = p2pclient.RelaysSetRegulated
+	if _, err := client.UpdateRelays(context.Background(), payload); err != nil || updates.Load() != 1 {
+		t.Fatalf("update: %v", err)
+	}
+}
+
+func TestLoadNodesOptionsFallsBack(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+	opts, err := client.LoadNodesOptions(context.Background())
+	if err != nil || !opts.Fallback {
+		t.Fatalf("expected the fallback list, got %+v: %v", opts, err)
+	}
+	if err := opts.Validate(options{Location: p2pclient.LocationEU, RelaysSet: "any-set"}); err != nil {
+		t.Fatalf("the fallback should leave relay sets to the API: %v", err)
+	}
+	if err := opts.Validate(options{Location: "moon"}); !errors.Is(err, p2pclient.ErrInvalidNodesOptions) {
+		t.Fatalf("the fallback should still check the location, got %v", err)
+	}
+	if again, _ := client.LoadNodesOptions(context.Background()); again != opts || calls.Load() != 1 {
+		t.Fatalf("expected the list to be fetched once, got %d calls", calls.Load())
+	}
+
+	// A pinned list is used without asking the API
+	client.NodesOptions = &p2pclient.NodesOptions{Locations: []p2pclient.Location{p2pclient.LocationUS}}
+	if opts, _ := client.LoadNodesOptions(context.Background()); opts != client.NodesOptions {
+		t.Fatalf("expected the pinned options")
+	}
+}
+
+func TestLoadNodesOptionsReturnsErrors(t *testing.T) {
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(`{"result":{"locations":["any"],"relaysSets":[{"name":"ethical","relays":["ultrasound"]}]}}`))
+	}))
+	defer srv.Close()
+
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+	var apiErr *p2pclient.APIError
+	for _, code := range []int{http.StatusUnauthorized, http.StatusInternalServerError} {
+		status.Store(int32(code))
+		if _, err := client.LoadNodesOptions(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != code {
+			t.Fatalf("expected a %d API error, got %v", code, err)
+		}
+	}
+
+	// A failure is not cached
+	status.Store(http.StatusOK)
+	opts, err := client.LoadNodesOptions(context.Background())
+	if err != nil || opts.Fallback || len(opts.RelaysSets) != 1 {
+		t.Fatalf("expected the API's list, got %+v: %v", opts, err)
+	}
+}
@@ -0,0 +1,271 @@
+package p2pclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"p2p/vemcrypto"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// VEM request types
+const (
+	VemTypeOffChain = "off_chain"
+	VemTypeOnChain  = "on_chain"
+)
+
+const vemRequestAction = "vem_request"
+
+// ErrSignerMismatch is returned when a VEM request signature recovers to a
+// different address than VemRequestSignedBy
+var ErrSignerMismatch = errors.New("p2pclient: vem request signature does not match signer")
+
+// VemRequest is the inner request P2P asks the withdrawal address to sign.
+// Field order is fixed so Canonical always produces the same bytes.
+type VemRequest struct {
+	Action           string   `json:"action"`
+	Pubkeys          []string `json:"pubkeys"`
+	ECDHClientPubkey string   `json:"ecdh_client_pubkey"`
+}
+
+// NewVemRequest validates the validator pubkeys and the base64 PKIX P-256
+// key the result will be encrypted to. Pubkeys are normalised to lowercase
+// 0x hex.
+func NewVemRequest(pubkeys []string, ecdhPubKeyBase64 string) (*VemRequest, error) {
+	r := &VemRequest{
+		Action:           vemRequestAction,
+		Pubkeys:          make([]string, len(pubkeys)),
+		ECDHClientPubkey: ecdhPubKeyBase64,
+	}
+	for i, pk := range pubkeys {
+		r.Pubkeys[i] = strings.ToLower(pk)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Validate checks the action, every pubkey and the ECDH key
+func (r *VemRequest) Validate() error {
+	if r.Action != vemRequestAction {
+		return fmt.Errorf("p2pclient: vem request action must be %q, got %q", vemRequestAction, r.Action)
+	}
+	if len(r.Pubkeys) == 0 {
+		return errors.New("p2pclient: vem request needs at least one pubkey")
+	}
+	seen := make(map[string]bool, len(r.Pubkeys))
+	for _, pk := range r.Pubkeys {
+		if err := validateBLSPubkey(pk); err != nil {
+			return err
+		}
+		if seen[pk] {
+			return fmt.Errorf("p2pclient: duplicate pubkey %s", pk)
+		}
+		seen[pk] = true
+	}
+	return validateECDHPubkey(r.ECDHClientPubkey)
+}
+
+// Canonical returns the exact string that is signed and submitted as
+// VemCreatePayload.VemRequest
+func (r *VemRequest) Canonical() (string, error) {
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// ParseVemRequest decodes a signed vem_request string and rejects anything
+// that is not in canonical form, so a verified signature always covers the
+// request as the API will read it
+func ParseVemRequest(s string) (*VemRequest, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	var r VemRequest
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("p2pclient: invalid vem request: %w", err)
+	}
+	canonical, err := r.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	if canonical != s {
+		return nil, errors.New("p2pclient: vem request is not in canonical form")
+	}
+	return &r, nil
+}
+
+// SignVemRequest signs the canonical request with EIP-191 personal_sign and
+// returns the 0x signature with a 27/28 recovery byte
+func SignVemRequest(request string, key *ecdsa.PrivateKey) (string, error) {
+	sig, err := crypto.Sign(accounts.TextHash([]byte(request)), key)
+	if err != nil {
+		return "", err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return hexutil.Encode(sig), nil
+}
+
+// RecoverVemSigner returns the address that produced an EIP-191 signature
+// over request
+func RecoverVemSigner(request, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("p2pclient: invalid signature hex: %w", err)
+	}
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("p2pclient: signature must be %d bytes, got %d", crypto.SignatureLength, len(sig))
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(request)), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("p2pclient: recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// NewOffChainVemPayload builds a create payload for a request signed off
+// chain, verifying the signature first
+func NewOffChainVemPayload(id string, r *VemRequest, signature, signedBy string) (VemCreatePayload, error) {
+	request, err := r.Canonical()
+	if err != nil {
+		return VemCreatePayload{}, err
+	}
+	p := VemCreatePayload{
+		ID:                  id,
+		Type:                VemTypeOffChain,
+		VemRequest:          request,
+		VemRequestSignature: signature,
+		VemRequestSignedBy:  signedBy,
+	}
+	return p, p.Verify()
+}
+
+// NewOnChainVemPayload builds a create payload for a request that was sent
+// as the calldata of signedTx from the withdrawal address. The proof is the
+// signed transaction itself, so P2P can check sender and calldata without
+// trusting the hash alone.
+func NewOnChainVemPayload(id string, r *VemRequest, signedTx *types.Transaction) (VemCreatePayload, error) {
+	request, err := r.Canonical()
+	if err != nil {
+		return VemCreatePayload{}, err
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(signedTx.ChainId()), signedTx)
+	if err != nil {
+		return VemCreatePayload{}, fmt.Errorf("p2pclient: vem transaction sender: %w", err)
+	}
+	proof, err := signedTx.MarshalBinary()
+	if err != nil {
+		return VemCreatePayload{}, err
+	}
+	p := VemCreatePayload{
+		ID:                 id,
+		Type:               VemTypeOnChain,
+		VemRequest:         request,
+		VemRequestSignedBy: sender.Hex(),
+		VemRequestTxId:     signedTx.Hash().Hex(),
+		VemRequestProof:    hexutil.Encode(proof),
+	}
+	return p, p.Verify()
+}
+
+// Verify checks that the payload carries a canonical request and that it was
+// authorised by VemRequestSignedBy: through an EIP-191 signature off chain, or
+// through a transaction from that address carrying the request on chain
+func (p VemCreatePayload) Verify() error {
+	if _, err := ParseVemRequest(p.VemRequest); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(p.VemRequestSignedBy) {
+		return fmt.Errorf("p2pclient: invalid signer address %q", p.VemRequestSignedBy)
+	}
+	signedBy := common.HexToAddress(p.VemRequestSignedBy)
+
+	switch p.Type {
+	case VemTypeOffChain:
+		signer, err := RecoverVemSigner(p.VemRequest, p.VemRequestSignature)
+		if err != nil {
+			return err
+		}
+		if signer != signedBy {
+			return fmt.Errorf("%w: recovered %s, expected %s", ErrSignerMismatch, signer, p.VemRequestSignedBy)
+		}
+		return nil
+	case VemTypeOnChain:
+		tx, err := ParseVemProof(p.VemRequestProof)
+		if err != nil {
+			return err
+		}
+		if tx.Hash() != common.HexToHash(p.VemRequestTxId) {
+			return fmt.Errorf("p2pclient: proof is transaction %s, not %s", tx.Hash().Hex(), p.VemRequestTxId)
+		}
+		if string(tx.Data()) != p.VemRequest {
+			return errors.New("p2pclient: vem transaction calldata does not match the request")
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return fmt.Errorf("p2pclient: vem transaction sender: %w", err)
+		}
+		if sender != signedBy {
+			return fmt.Errorf("%w: transaction sent by %s, expected %s", ErrSignerMismatch, sender, p.VemRequestSignedBy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("p2pclient: unknown vem type %q", p.Type)
+	}
+}
+
+// ParseVemProof decodes the signed transaction carried in VemRequestProof
+func ParseVemProof(proof string) (*types.Transaction, error) {
+	raw, err := hexutil.Decode(proof)
+	if err != nil {
+		return nil, fmt.Errorf("p2pclient: invalid vem proof hex: %w", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("p2pclient: invalid vem proof transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func validateBLSPubkey(pk string) error {
+	if !strings.HasPrefix(pk, "0x") {
+		return fmt.Errorf("p2pclient: pubkey %q must be 0x-prefixed hex", pk)
+	}
+	if strings.ToLower(pk) != pk {
+		return fmt.Errorf("p2pclient: pubkey %q must be lowercase", pk)
+	}
+	b, err := hex.DecodeString(pk[2:])
+	if err != nil {
+		return fmt.Errorf("p2pclient: pubkey %q is not hex: %w", pk, err)
+	}
+	if len(b) != 48 {
+		return fmt.Errorf("p2pclient: pubkey %q must be 48 bytes, got %d", pk, len(b))
+	}
+	return nil
+}
+
+func validateECDHPubkey(pubBase64 string) error {
+	if _, err := vemcrypto.ParseECDHPublicKey(pubBase64); err != nil {
+		return fmt.Errorf("p2pclient: invalid ecdh_client_pubkey: %w", err)
+	}
+	return nil
+}
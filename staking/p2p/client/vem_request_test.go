@@ -0,0 +1,98 @@
+package p2pclient_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	p2pclient "p2p/client"
+	"p2p/vemcrypto"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var testPubkey = "0x" + strings.Repeat("a1", 48)
+
+func newTestVemRequest(t *testing.T) *p2pclient.VemRequest {
+	t.Helper()
+	_, ecdhPub, err := vemcrypto.GenerateECDHKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p2pclient.NewVemRequest([]string{"0x" + strings.ToUpper(testPubkey[2:])}, ecdhPub)
+	if err != nil {
+		t.Fatalf("new vem request: %v", err)
+	}
+	return r
+}
+
+func TestVemRequestCanonical(t *testing.T) {
+	r := newTestVemRequest(t)
+	canonical, err := r.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"action":"vem_request","pubkeys":["` + testPubkey + `"],"ecdh_client_pubkey":"` + r.ECDHClientPubkey + `"}`
+	if canonical != want {
+		t.Fatalf("unexpected canonical form:\n%s\n%s", canonical, want)
+	}
+	if _, err := p2pclient.ParseVemRequest(canonical); err != nil {
+		t.Fatalf("canonical request should parse: %v", err)
+	}
+	spaced := strings.Replace(canonical, `,"pubkeys"`, `, "pubkeys"`, 1)
+	if _, err := p2pclient.ParseVemRequest(spaced); err == nil {
+		t.Fatalf("expected non-canonical request to be rejected")
+	}
+}
+
+func TestVemRequestValidation(t *testing.T) {
+	_, ecdhPub, _ := vemcrypto.GenerateECDHKeypair()
+	for _, pubkeys := range [][]string{
+		nil,
+		{"0xVALIDATOR_BLS_PUBKEY"},
+		{"0x" + strings.Repeat("a1", 47)},
+		{testPubkey, testPubkey},
+	} {
+		if _, err := p2pclient.NewVemRequest(pubkeys, ecdhPub); err == nil {
+			t.Fatalf("expected %v to be rejected", pubkeys)
+		}
+	}
+	if _, err := p2pclient.NewVemRequest([]string{testPubkey}, "bm90IGEga2V5"); err == nil {
+		t.Fatalf("expected invalid ECDH key to be rejected")
+	}
+}
+
+func TestVemPayloadSignerVerification(t *testing.T) {
+	r := newTestVemRequest(t)
+	canonical, _ := r.Canonical()
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	sig, err := p2pclient.SignVemRequest(canonical, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	if _, err := p2pclient.NewOffChainVemPayload("vem-1", r, sig, signer); err != nil {
+		t.Fatalf("expected valid payload: %v", err)
+	}
+
+	_, err = p2pclient.NewOffChainVemPayload("vem-1", r, sig, crypto.PubkeyToAddress(other.PublicKey).Hex())
+	if !errors.Is(err, p2pclient.ErrSignerMismatch) {
+		t.Fatalf("expected signer mismatch, got %v", err)
+	}
+
+	// CreateVem refuses to send a mismatched payload
+	client := p2pclient.NewClient("http://127.0.0.1:1", p2pclient.StaticToken("tok"))
+	_, err = client.CreateVem(context.Background(), p2pclient.VemCreatePayload{
+		ID:                  "vem-1",
+		Type:                p2pclient.VemTypeOffChain,
+		VemRequest:          canonical,
+		VemRequestSignature: sig,
+		VemRequestSignedBy:  crypto.PubkeyToAddress(other.PublicKey).Hex(),
+	})
+	if !errors.Is(err, p2pclient.ErrSignerMismatch) {
+		t.Fatalf("expected CreateVem to reject the payload, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package depositdata
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"consensus"
+	"consensus/eth"
+	p2pclient "p2p/client"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// depositCLIVersion is reported in deposit_data.json; the launchpad only
+// accepts files from deposit-cli 1.x or newer
+const depositCLIVersion = "2.7.0"
+
+// Deposit is a verified deposit ready to be sent to the deposit contract
+type Deposit struct {
+	consensus.DepositData
+	Network consensus.Network
+}
+
+// ErrUnrequestedDeposit is returned when P2P's deposits are validly signed
+// but not what the node request asked for
+var ErrUnrequestedDeposit = errors.New("depositdata: deposit does not match the node request")
+
+// FromNodeRequest checks every deposit P2P returned for a ready node
+// request: the signature must verify for network, the deposit data root
+// must match the one P2P computed, and the count, amount and withdrawal
+// credentials must be the ones requested, each for a different validator
+func FromNodeRequest(status *p2pclient.NodeRequestStatus, network consensus.Network, requested p2pclient.CreateNodeRequestPayload) ([]Deposit, error) {
+	if status.Status != p2pclient.NodeRequestReady {
+		return nil, fmt.Errorf("depositdata: node request %s is %s, not ready", status.ID, status.Status)
+	}
+	if len(status.DepositData) == 0 {
+		return nil, fmt.Errorf("depositdata: node request %s has no deposit data", status.ID)
+	}
+	if len(status.DepositData) != requested.ValidatorsCount {
+		return nil, fmt.Errorf("%w: %d deposits for %d validators", ErrUnrequestedDeposit, len(status.DepositData), requested.ValidatorsCount)
+	}
+	creds, err := requestedCredentials(requested)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := strconv.ParseUint(requested.AmountPerValidator, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("depositdata: invalid requested amount %q: %w", requested.AmountPerValidator, err)
+	}
+
+	deposits := make([]Deposit, 0, len(status.DepositData))
+	seen := make(map[consensus.BLSPubkey]bool, len(status.DepositData))
+	for i, raw := range status.DepositData {
+		d, err := parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("depositdata: deposit %d: %w", i, err)
+		}
+		if err := d.Verify(network); err != nil {
+			return nil, fmt.Errorf("depositdata: %w", err)
+		}
+		switch {
+		case seen[d.Pubkey]:
+			return nil, fmt.Errorf("%w: %s is deposited twice", ErrUnrequestedDeposit, d.Pubkey)
+		case d.WithdrawalCredentials != creds:
+			return nil, fmt.Errorf("%w: %s withdraws to 0x%x, want 0x%x", ErrUnrequestedDeposit, d.Pubkey, d.WithdrawalCredentials, creds)
+		case d.AmountGwei != amount:
+			return nil, fmt.Errorf("%w: %s deposits %d gwei, want %d", ErrUnrequestedDeposit, d.Pubkey, d.AmountGwei, amount)
+		}
+		seen[d.Pubkey] = true
+		deposits = append(deposits, Deposit{DepositData: d, Network: network})
+	}
+	return deposits, nil
+}
+
+// requestedCredentials builds the withdrawal credentials a node request
+// asked for: the type prefix, eleven zero bytes and the withdrawal address
+func requestedCredentials(requested p2pclient.CreateNodeRequestPayload) ([32]byte, error) {
+	var creds [32]byte
+	switch requested.WithdrawalCredentialsType {
+	case "0x01":
+		creds[0] = 0x01
+	case "0x02":
+		creds[0] = 0x02
+	default:
+		return creds, fmt.Errorf("depositdata: cannot check %q withdrawal credentials", requested.WithdrawalCredentialsType)
+	}
+	if !common.IsHexAddress(requested.WithdrawalAddress) {
+		return creds, fmt.Errorf("depositdata: invalid requested withdrawal address %q", requested.WithdrawalAddress)
+	}
+	copy(creds[12:], common.HexToAddress(requested.WithdrawalAddress).Bytes())
+	return creds, nil
+}
+
+func parse(raw p2pclient.NodeDepositData) (consensus.DepositData, error) {
+	var d consensus.DepositData
+	var err error
+	if d.Pubkey, err = consensus.ParseBLSPubkey(raw.Pubkey); err != nil {
+		return d, err
+	}
+	if d.Signature, err = consensus.ParseBLSSignature(raw.Signature); err != nil {
+		return d, err
+	}
+	creds, err := decodeRoot(raw.WithdrawalCredentials, "withdrawal credentials")
+	if err != nil {
+		return d, err
+	}
+	d.WithdrawalCredentials = creds
+	if d.AmountGwei, err = strconv.ParseUint(raw.Amount, 10, 64); err != nil {
+		return d, fmt.Errorf("invalid amount %q: %w", raw.Amount, err)
+	}
+
+	root, err := decodeRoot(raw.DepositDataRoot, "deposit data root")
+	if err != nil {
+		return d, err
+	}
+	if got := d.HashTreeRoot(); got != root {
+		return d, fmt.Errorf("deposit data root for %s is 0x%x, P2P sent 0x%x", d.Pubkey, got, root)
+	}
+	if raw.DepositMessageRoot != "" {
+		msgRoot, err := decodeRoot(raw.DepositMessageRoot, "deposit message root")
+		if err != nil {
+			return d, err
+		}
+		if got := d.DepositMessage.HashTreeRoot(); got != msgRoot {
+			return d, fmt.Errorf("deposit message root for %s is 0x%x, P2P sent 0x%x", d.Pubkey, got, msgRoot)
+		}
+	}
+	return d, nil
+}
+
+/*
+   ---------- STAKING LAUNCHPAD ----------
+*/
+
+// LaunchpadEntry is one element of the deposit_data.json file produced by
+// staking-deposit-cli and accepted by the staking launchpad. Hex fields have
+// no 0x prefix.
+type LaunchpadEntry struct {
+	Pubkey                string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	Amount                uint64 `json:"amount"`
+	Signature             string `json:"signature"`
+	DepositMessageRoot    string `json:"deposit_message_root"`
+	DepositDataRoot       string `json:"deposit_data_root"`
+	ForkVersion           string `json:"fork_version"`
+	NetworkName           string `json:"network_name"`
+	DepositCLIVersion     string `json:"deposit_cli_version"`
+}
+
+// Launchpad converts deposits to deposit_data.json entries
+func Launchpad(deposits []Deposit) []LaunchpadEntry {
+	entries := make([]LaunchpadEntry, len(deposits))
+	for i, d := range deposits {
+		msgRoot := d.DepositMessage.HashTreeRoot()
+		dataRoot := d.HashTreeRoot()
+		entries[i] = LaunchpadEntry{
+			Pubkey:                hex.EncodeToString(d.Pubkey[:]),
+			WithdrawalCredentials: hex.EncodeToString(d.WithdrawalCredentials[:]),
+			Amount:                d.AmountGwei,
+			Signature:             hex.EncodeToString(d.Signature[:]),
+			DepositMessageRoot:    hex.EncodeToString(msgRoot[:]),
+			DepositDataRoot:       hex.EncodeToString(dataRoot[:]),
+			ForkVersion:           hex.EncodeToString(d.Network.GenesisForkVersion[:]),
+			NetworkName:           d.Network.Name,
+			DepositCLIVersion:     depositCLIVersion,
+		}
+	}
+	return entries
+}
+
+// WriteLaunchpadFile writes deposits to path in deposit_data.json format
+func WriteLaunchpadFile(path string, deposits []Deposit) error {
+	data, err := json.MarshalIndent(Launchpad(deposits), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+/*
+   ---------- DEPOSIT CONTRACT ----------
+*/
+
+// UnsignedTx is a deposit contract call for the depositor to sign and send.
+// Nonce, gas and fees are left to the sender.
+type UnsignedTx struct {
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Data  hexutil.Bytes  `json:"data"`
+}
+
+// DepositCalls returns one deposit contract call per deposit
+func DepositCalls(deposits []Deposit) ([]UnsignedTx, error) {
+	txs := make([]UnsignedTx, 0, len(deposits))
+	for _, d := range deposits {
+		if d.Network.DepositContract == (common.Address{}) {
+			return nil, errors.New("depositdata: network has no deposit contract")
+		}
+		data, err := eth.DepositCalldata(d.DepositData)
+		if err != nil {
+			return nil, err
+		}
+		value := new(big.Int).Mul(new(big.Int).SetUint64(d.AmountGwei), big.NewInt(1_000_000_000))
+		txs = append(txs, UnsignedTx{
+			To:    d.Network.DepositContract,
+			Value: (*hexutil.Big)(value),
+			Data:  data,
+		})
+	}
+	return txs, nil
+}
+
+func decodeRoot(s, what string) ([32]byte, error) {
+	var root [32]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return root, fmt.Errorf("invalid %s %q: %w", what, s, err)
+	}
+	if len(b) != 32 {
+		return root, fmt.Errorf("invalid %s: want 32 bytes, got %d", what, len(b))
+	}
+	copy(root[:], b)
+	return root, nil
+}
@@ -0,0 +1,146 @@
+package depositdata_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/depositdata"
+	"p2p/p2ptest"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func withdrawalCreds(addr string) [32]byte {
+	var creds [32]byte
+	creds[0] = 0x01
+	copy(creds[12:], common.HexToAddress(addr).Bytes())
+	return creds
+}
+
+// requested is the node request payload the deposits in these tests answer
+func requested(n int) p2pclient.CreateNodeRequestPayload {
+	return p2pclient.CreateNodeRequestPayload{
+		ValidatorsCount:           n,
+		AmountPerValidator:        "32000000000",
+		WithdrawalCredentialsType: "0x01",
+		WithdrawalAddress:         "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+	}
+}
+
+func readyStatus(deposits ...p2pclient.NodeDepositData) *p2pclient.NodeRequestStatus {
+	return &p2pclient.NodeRequestStatus{
+		NodeRequest: p2pclient.NodeRequest{ID: "req-1", Status: p2pclient.NodeRequestReady},
+		DepositData: deposits,
+	}
+}
+
+func TestDepositDomain(t *testing.T) {
+	domain := consensus.DepositDomain(consensus.Mainnet)
+	want := "03000000f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a9"
+	if got := hex.EncodeToString(domain[:]); got != want {
+		t.Fatalf("mainnet deposit domain %s, want %s", got, want)
+	}
+}
+
+func TestFromNodeRequestWritesLaunchpadFile(t *testing.T) {
+	creds := withdrawalCreds("0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17")
+	status := readyStatus(
+		p2ptest.NewBLSKey().Deposit(creds, 32_000_000_000, consensus.Hoodi),
+		p2ptest.NewBLSKey().Deposit(creds, 32_000_000_000, consensus.Hoodi),
+	)
+
+	deposits, err := depositdata.FromNodeRequest(status, consensus.Hoodi, requested(2))
+	if err != nil {
+		t.Fatalf("from node request: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "deposit_data.json")
+	if err := depositdata.WriteLaunchpadFile(path, deposits); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var entries []map[string]any
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("bad deposit_data.json: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e["fork_version"] != "10000910" || e["network_name"] != "hoodi" || e["amount"] != float64(32_000_000_000) {
+		t.Fatalf("unexpected entry %v", e)
+	}
+	if strings.HasPrefix(e["pubkey"].(string), "0x") || e["deposit_data_root"] != strings.TrimPrefix(status.DepositData[0].DepositDataRoot, "0x") {
+		t.Fatalf("unexpected hex encoding in %v", e)
+	}
+
+	txs, err := depositdata.DepositCalls(deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txs[0].To != consensus.Hoodi.DepositContract || txs[0].Value.ToInt().String() != "32000000000000000000" {
+		t.Fatalf("unexpected deposit call %+v", txs[0])
+	}
+	if hex.EncodeToString(txs[0].Data[:4]) != "22895118" {
+		t.Fatalf("unexpected selector %x", txs[0].Data[:4])
+	}
+}
+
+func TestFromNodeRequestRejectsBadDeposits(t *testing.T) {
+	creds := withdrawalCreds("0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17")
+	key := p2ptest.NewBLSKey()
+
+	// Signed for another network
+	if _, err := depositdata.FromNodeRequest(readyStatus(key.Deposit(creds, 32_000_000_000, consensus.Mainnet)), consensus.Hoodi, requested(1)); err == nil {
+		t.Fatalf("expected a mainnet deposit to fail on hoodi")
+	}
+
+	// Root does not match the fields
+	d := key.Deposit(creds, 32_000_000_000, consensus.Hoodi)
+	d.Amount = "1000000000"
+	if _, err := depositdata.FromNodeRequest(readyStatus(d), consensus.Hoodi, requested(1)); err == nil || !strings.Contains(err.Error(), "deposit data root") {
+		t.Fatalf("expected a root mismatch, got %v", err)
+	}
+
+	pending := readyStatus(key.Deposit(creds, 32_000_000_000, consensus.Hoodi))
+	pending.Status = p2pclient.NodeRequestProcessing
+	if _, err := depositdata.FromNodeRequest(pending, consensus.Hoodi, requested(1)); err == nil {
+		t.Fatalf("expected a processing request to be rejected")
+	}
+}
+
+func TestFromNodeRequestRejectsUnrequestedDeposits(t *testing.T) {
+	creds := withdrawalCreds("0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17")
+	key := p2ptest.NewBLSKey()
+	good := key.Deposit(creds, 32_000_000_000, consensus.Hoodi)
+
+	compounding := creds
+	compounding[0] = 0x02
+	for _, tc := range []struct {
+		name   string
+		status *p2pclient.NodeRequestStatus
+		want   int
+	}{
+		// Correctly signed, but withdrawing to someone else
+		{"address", readyStatus(key.Deposit(withdrawalCreds("0x53da3c92fCCEb0CFE1764f65DDfF1564A2b15585"), 32_000_000_000, consensus.Hoodi)), 1},
+		{"type", readyStatus(key.Deposit(compounding, 32_000_000_000, consensus.Hoodi)), 1},
+		{"amount", readyStatus(key.Deposit(creds, 1_000_000_000, consensus.Hoodi)), 1},
+		{"count", readyStatus(good), 2},
+		{"duplicate", readyStatus(good, good), 2},
+	} {
+		if _, err := depositdata.FromNodeRequest(tc.status, consensus.Hoodi, requested(tc.want)); !errors.Is(err, depositdata.ErrUnrequestedDeposit) {
+			t.Fatalf("%s: expected ErrUnrequestedDeposit, got %v", tc.name, err)
+		}
+	}
+
+	if _, err := depositdata.FromNodeRequest(readyStatus(good), consensus.Hoodi, requested(1)); err != nil {
+		t.Fatalf("requested deposit rejected: %v", err)
+	}
+}
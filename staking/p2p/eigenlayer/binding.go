@@ -0,0 +1,91 @@
+package eigenlayer
+
+import (
+	"context"
+
+	"consensus/eth"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	bind "github.com/ethereum/go-ethereum/accounts/abi/bind/v2"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The subset of the EigenLayer ABIs the restaking flow reads
+const (
+	eigenPodManagerABI = `[
+	{"name":"getPod","type":"function","stateMutability":"view","inputs":[{"name":"podOwner","type":"address"}],"outputs":[{"name":"","type":"address"}]},
+	{"name":"hasPod","type":"function","stateMutability":"view","inputs":[{"name":"podOwner","type":"address"}],"outputs":[{"name":"","type":"bool"}]},
+	{"name":"ownerToPod","type":"function","stateMutability":"view","inputs":[{"name":"podOwner","type":"address"}],"outputs":[{"name":"","type":"address"}]}
+]`
+	eigenPodABI = `[
+	{"name":"podOwner","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]}
+]`
+)
+
+var (
+	managerABI = eth.MustParseABI(eigenPodManagerABI)
+	podABI     = eth.MustParseABI(eigenPodABI)
+)
+
+// EigenPodManager is a read-only binding to EigenLayer's EigenPodManager
+type EigenPodManager struct {
+	Address  common.Address
+	caller   bind.ContractCaller
+	contract *bind.BoundContract
+}
+
+// NewEigenPodManager binds the EigenPodManager deployed at address
+func NewEigenPodManager(address common.Address, caller bind.ContractCaller) *EigenPodManager {
+	return &EigenPodManager{
+		Address:  address,
+		caller:   caller,
+		contract: bind.NewBoundContract(address, managerABI, caller, nil, nil),
+	}
+}
+
+// GetPod returns owner's pod, or the CREATE2 address it will be deployed
+// at if owner has none yet
+func (m *EigenPodManager) GetPod(ctx context.Context, owner common.Address) (common.Address, error) {
+	return callAddress(ctx, m.contract, "getPod", owner)
+}
+
+// OwnerToPod returns owner's deployed pod, or the zero address
+func (m *EigenPodManager) OwnerToPod(ctx context.Context, owner common.Address) (common.Address, error) {
+	return callAddress(ctx, m.contract, "ownerToPod", owner)
+}
+
+// HasPod reports whether owner has deployed a pod
+func (m *EigenPodManager) HasPod(ctx context.Context, owner common.Address) (bool, error) {
+	var out []any
+	if err := m.contract.Call(&bind.CallOpts{Context: ctx}, &out, "hasPod", owner); err != nil {
+		return false, err
+	}
+	return *abi.ConvertType(out[0], new(bool)).(*bool), nil
+}
+
+// EigenPod is a read-only binding to a deployed EigenPod
+type EigenPod struct {
+	Address  common.Address
+	contract *bind.BoundContract
+}
+
+// NewEigenPod binds the EigenPod deployed at address
+func NewEigenPod(address common.Address, caller bind.ContractCaller) *EigenPod {
+	return &EigenPod{
+		Address:  address,
+		contract: bind.NewBoundContract(address, podABI, caller, nil, nil),
+	}
+}
+
+// PodOwner returns the address allowed to manage the pod
+func (p *EigenPod) PodOwner(ctx context.Context) (common.Address, error) {
+	return callAddress(ctx, p.contract, "podOwner")
+}
+
+func callAddress(ctx context.Context, contract *bind.BoundContract, method string, args ...any) (common.Address, error) {
+	var out []any
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &out, method, args...); err != nil {
+		return common.Address{}, err
+	}
+	return *abi.ConvertType(out[0], new(common.Address)).(*common.Address), nil
+}
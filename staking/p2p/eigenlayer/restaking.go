@@ -0,0 +1,128 @@
+package eigenlayer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/depositdata"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrWrongWithdrawalCredentials is returned when a restaking deposit does
+// not withdraw to the owner's EigenPod
+var ErrWrongWithdrawalCredentials = errors.New("eigenlayer: withdrawal credentials do not point at the eigenpod")
+
+// managerAddresses are the EigenPodManager proxies EigenLayer deploys
+var managerAddresses = map[string]common.Address{
+	consensus.Mainnet.Name: common.HexToAddress("0x91E677b07F7AF907ec9a428aafA9fc14a0d3A338"),
+	consensus.Holesky.Name: common.HexToAddress("0x30770d7E3e71112d7A6b7259542D1f680a70e315"),
+}
+
+// ManagerAddress returns the EigenPodManager for network
+func ManagerAddress(network consensus.Network) (common.Address, error) {
+	addr, ok := managerAddresses[network.Name]
+	if !ok {
+		return common.Address{}, fmt.Errorf("eigenlayer: no known EigenPodManager on %s", network.Name)
+	}
+	return addr, nil
+}
+
+// Pod is an owner's EigenPod. Deployed is false when the owner has not
+// called createPod yet; Address is then where the pod will be created,
+// and deposits to it are still credited once it is.
+type Pod struct {
+	Owner    common.Address
+	Address  common.Address
+	Deployed bool
+}
+
+// ResolvePod looks up owner's pod and checks the chain agrees on it: a
+// deployed pod must be the one the manager records for owner and must name
+// owner as its podOwner, and an undeployed pod's address must be empty
+func (m *EigenPodManager) ResolvePod(ctx context.Context, owner common.Address) (*Pod, error) {
+	if owner == (common.Address{}) {
+		return nil, errors.New("eigenlayer: eigenpod owner is the zero address")
+	}
+	addr, err := m.GetPod(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("eigenlayer: getPod: %w", err)
+	}
+	if addr == (common.Address{}) {
+		return nil, fmt.Errorf("eigenlayer: manager %s returned no pod for %s", m.Address, owner)
+	}
+	deployed, err := m.HasPod(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("eigenlayer: hasPod: %w", err)
+	}
+	pod := &Pod{Owner: owner, Address: addr, Deployed: deployed}
+
+	if !deployed {
+		code, err := m.caller.CodeAt(ctx, addr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("eigenlayer: code at %s: %w", addr, err)
+		}
+		if len(code) != 0 {
+			return nil, fmt.Errorf("eigenlayer: %s has no pod but %s already holds a contract", owner, addr)
+		}
+		return pod, nil
+	}
+
+	recorded, err := m.OwnerToPod(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("eigenlayer: ownerToPod: %w", err)
+	}
+	if recorded != addr {
+		return nil, fmt.Errorf("eigenlayer: manager records pod %s for %s, getPod returned %s", recorded, owner, addr)
+	}
+	podOwner, err := NewEigenPod(addr, m.caller).PodOwner(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("eigenlayer: podOwner of %s: %w", addr, err)
+	}
+	if podOwner != owner {
+		return nil, fmt.Errorf("eigenlayer: pod %s is owned by %s, not %s", addr, podOwner, owner)
+	}
+	return pod, nil
+}
+
+// WithdrawalCredentials returns the credentials of a validator that
+// withdraws to the pod. prefix is 0x01, or 0x02 for a compounding validator.
+func (p *Pod) WithdrawalCredentials(prefix byte) [32]byte {
+	var creds [32]byte
+	creds[0] = prefix
+	copy(creds[12:], p.Address.Bytes())
+	return creds
+}
+
+// NewRestakingNodeRequest turns payload into a restaking node request for
+// pod. WithdrawalCredentialsType defaults to 0x01.
+func NewRestakingNodeRequest(pod *Pod, payload p2pclient.CreateNodeRequestPayload) (p2pclient.CreateNodeRequestPayload, error) {
+	switch payload.WithdrawalCredentialsType {
+	case "":
+		payload.WithdrawalCredentialsType = "0x01"
+	case "0x01", "0x02":
+	default:
+		return payload, fmt.Errorf("eigenlayer: eigenpods need 0x01 or 0x02 withdrawal credentials, not %s", payload.WithdrawalCredentialsType)
+	}
+	payload.Type = p2pclient.NodeRequestTypeRestaking
+	payload.EigenPodOwnerAddress = pod.Owner.Hex()
+	payload.WithdrawalAddress = pod.Address.Hex()
+	return payload, nil
+}
+
+// CheckWithdrawalCredentials checks every deposit withdraws to pod
+func CheckWithdrawalCredentials(deposits []depositdata.Deposit, pod *Pod) error {
+	for _, d := range deposits {
+		creds := d.WithdrawalCredentials
+		if creds[0] != 0x01 && creds[0] != 0x02 {
+			return fmt.Errorf("%w: %s has 0x%02x credentials", ErrWrongWithdrawalCredentials, d.Pubkey, creds[0])
+		}
+		if creds != pod.WithdrawalCredentials(creds[0]) {
+			return fmt.Errorf("%w: %s withdraws to 0x%x, pod is %s", ErrWrongWithdrawalCredentials, d.Pubkey, creds[12:], pod.Address)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package eigenlayer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/depositdata"
+	"p2p/eigenlayer"
+	"p2p/p2ptest"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+var (
+	manager  = common.HexToAddress("0x91E677b07F7AF907ec9a428aafA9fc14a0d3A338")
+	owner    = common.HexToAddress("0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17")
+	pod      = common.HexToAddress("0x00000000000000000000000000000000000e1900")
+	newOwner = common.HexToAddress("0x53da3c92fCCEb0CFE1764f65DDfF1564A2b15585")
+)
+
+func newManager(t *testing.T, alloc types.GenesisAlloc) *eigenlayer.EigenPodManager {
+	t.Helper()
+	chain := simulated.NewBackend(alloc)
+	t.Cleanup(func() { chain.Close() })
+	return eigenlayer.NewEigenPodManager(manager, chain.Client())
+}
+
+func TestResolvePod(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t, p2ptest.EigenPodManagerAlloc(manager, map[common.Address]common.Address{owner: pod}))
+
+	got, err := m.ResolvePod(ctx, owner)
+	if err != nil {
+		t.Fatalf("resolve deployed pod: %v", err)
+	}
+	if !got.Deployed || got.Address != pod || got.Owner != owner {
+		t.Fatalf("unexpected pod %+v", got)
+	}
+
+	// An owner without a pod gets the address it will be created at
+	future, err := m.ResolvePod(ctx, newOwner)
+	if err != nil {
+		t.Fatalf("resolve future pod: %v", err)
+	}
+	if future.Deployed || future.Address == (common.Address{}) || future.Address == pod {
+		t.Fatalf("unexpected future pod %+v", future)
+	}
+}
+
+func TestResolvePodRejectsForeignPods(t *testing.T) {
+	ctx := context.Background()
+
+	// The manager points owner at a pod that names someone else as podOwner
+	alloc := p2ptest.EigenPodManagerAlloc(manager, map[common.Address]common.Address{owner: pod})
+	for k, v := range p2ptest.EigenPodAlloc(pod, newOwner) {
+		alloc[k] = v
+	}
+	if _, err := newManager(t, alloc).ResolvePod(ctx, owner); err == nil || !strings.Contains(err.Error(), "owned by") {
+		t.Fatalf("expected a pod owner mismatch, got %v", err)
+	}
+
+	// A contract already sits where newOwner's pod would be created
+	m := newManager(t, p2ptest.EigenPodManagerAlloc(manager, nil))
+	future, err := m.ResolvePod(ctx, newOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc = p2ptest.EigenPodManagerAlloc(manager, nil)
+	for k, v := range p2ptest.EigenPodAlloc(future.Address, newOwner) {
+		alloc[k] = v
+	}
+	if _, err := newManager(t, alloc).ResolvePod(ctx, newOwner); err == nil {
+		t.Fatalf("expected a contract at an undeployed pod address to be rejected")
+	}
+
+	if _, err := m.ResolvePod(ctx, common.Address{}); err == nil {
+		t.Fatalf("expected the zero owner to be rejected")
+	}
+}
+
+func TestRestakingDeposits(t *testing.T) {
+	p := &eigenlayer.Pod{Owner: owner, Address: pod, Deployed: true}
+
+	payload, err := eigenlayer.NewRestakingNodeRequest(p, p2pclient.CreateNodeRequestPayload{ID: "req-1", ValidatorsCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Type != p2pclient.NodeRequestTypeRestaking || payload.EigenPodOwnerAddress != owner.Hex() ||
+		payload.WithdrawalAddress != pod.Hex() || payload.WithdrawalCredentialsType != "0x01" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+	if _, err := eigenlayer.NewRestakingNodeRequest(p, p2pclient.CreateNodeRequestPayload{WithdrawalCredentialsType: "0x00"}); err == nil {
+		t.Fatalf("expected BLS credentials to be rejected")
+	}
+
+	status := func(creds [32]byte) *p2pclient.NodeRequestStatus {
+		return &p2pclient.NodeRequestStatus{
+			NodeRequest: p2pclient.NodeRequest{ID: "req-1", Status: p2pclient.NodeRequestReady},
+			DepositData: []p2pclient.NodeDepositData{p2ptest.NewBLSKey().Deposit(creds, 32_000_000_000, consensus.Hoodi)},
+		}
+	}
+
+	requested := p2pclient.CreateNodeRequestPayload{
+		ValidatorsCount:           1,
+		AmountPerValidator:        "32000000000",
+		WithdrawalCredentialsType: "0x02",
+		WithdrawalAddress:         pod.Hex(),
+	}
+	deposits, err := depositdata.FromNodeRequest(status(p.WithdrawalCredentials(0x02)), consensus.Hoodi, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eigenlayer.CheckWithdrawalCredentials(deposits, p); err != nil {
+		t.Fatalf("deposit to the pod rejected: %v", err)
+	}
+
+	other := &eigenlayer.Pod{Owner: owner, Address: owner}
+	requested.WithdrawalCredentialsType, requested.WithdrawalAddress = "0x01", owner.Hex()
+	deposits, _ = depositdata.FromNodeRequest(status(other.WithdrawalCredentials(0x01)), consensus.Hoodi, requested)
+	if err := eigenlayer.CheckWithdrawalCredentials(deposits, p); !errors.Is(err, eigenlayer.ErrWrongWithdrawalCredentials) {
+		t.Fatalf("expected ErrWrongWithdrawalCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"consensus"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"p2p/escrow"
+	"text/tabwriter"
+	"time"
+)
+
+// runEscrow handles "escrow list" and "escrow release"
+func runEscrow(ctx context.Context, out io.Writer, exits *escrow.Escrow, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: escrow list | escrow release -pubkey|-index ... -operator ... -reason ...")
+	}
+	switch args[0] {
+	case "list":
+		return escrowList(out, exits)
+	case "release":
+		return escrowRelease(ctx, out, exits, args[1:])
+	default:
+		return fmt.Errorf("unknown escrow command %q", args[0])
+	}
+}
+
+func escrowList(out io.Writer, exits *escrow.Escrow) error {
+	entries, err := exits.List()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tPUBKEY\tEPOCH\tVEM\tSIGNER\tIMPORTED\tRELEASED")
+	for _, e := range entries {
+		released := "-"
+		if n := len(e.Releases); n > 0 {
+			last := e.Releases[n-1]
+			released = fmt.Sprintf("%s by %s", last.At.Format(time.RFC3339), last.Operator)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			e.ValidatorIndex, e.Pubkey, e.Epoch, e.Provenance.VemID, e.Provenance.Signer.Hex(),
+			e.Provenance.ImportedAt.Format(time.RFC3339), released)
+	}
+	return tw.Flush()
+}
+
+// escrowRelease submits one escrowed exit to a beacon node. It names the
+// validator, the operator and the reason explicitly; all three are audited.
+func escrowRelease(ctx context.Context, out io.Writer, exits *escrow.Escrow, args []string) error {
+	fs := flag.NewFlagSet("escrow release", flag.ContinueOnError)
+	fs.SetOutput(out)
+	pubkeyHex := fs.String("pubkey", "", "validator pubkey to exit")
+	index := fs.Int64("index", -1, "validator index to exit")
+	operator := fs.String("operator", "", "who is releasing the exit (required)")
+	reason := fs.String("reason", "", "why the validator is exiting (required)")
+	beaconURL := fs.String("beacon-url", os.Getenv("BEACON_URL"), "beacon node to submit to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *beaconURL == "" {
+		return errors.New("escrow release: -beacon-url or BEACON_URL is required")
+	}
+
+	var entry escrow.Entry
+	var err error
+	switch {
+	case *pubkeyHex != "" && *index >= 0:
+		return errors.New("escrow release: give -pubkey or -index, not both")
+	case *pubkeyHex != "":
+		pubkey, perr := consensus.ParseBLSPubkey(*pubkeyHex)
+		if perr != nil {
+			return perr
+		}
+		entry, err = exits.Get(pubkey)
+	case *index >= 0:
+		entry, err = exits.ByIndex(uint64(*index))
+	default:
+		return errors.New("escrow release: -pubkey or -index is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	beacon := consensus.NewBeaconClient(*beaconURL)
+	req := escrow.ReleaseRequest{Operator: *operator, Reason: *reason, Beacon: *beaconURL}
+	if _, err := exits.Release(ctx, entry.Pubkey, req, beacon); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Released exit for validator %d (%s) to %s\n", entry.ValidatorIndex, entry.Pubkey, *beaconURL)
+	return nil
+}
@@ -0,0 +1,559 @@
+// Package escrow keeps pre-signed voluntary exits from VEM results sealed on
+// disk until an operator explicitly releases one to a beacon node.
+package escrow
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"consensus"
+	"p2p/internal/atomicfile"
+	"p2p/vemcrypto"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrNotFound is returned when no exit is escrowed for a validator
+	ErrNotFound = errors.New("escrow: no exit escrowed for this validator")
+	// ErrUnexpectedVem is returned when importing a VEM that Expect never
+	// recorded
+	ErrUnexpectedVem = errors.New("escrow: vem request was not expected")
+	// ErrConflict is returned when a validator already has a different exit
+	// in escrow
+	ErrConflict = errors.New("escrow: a different exit is already escrowed for this validator")
+	// ErrFutureEpoch is returned for an exit the beacon chain would not
+	// accept yet
+	ErrFutureEpoch = errors.New("escrow: exit epoch is in the future")
+)
+
+// Audit actions
+const (
+	ActionExpect         = "expect"
+	ActionImport         = "import"
+	ActionReleaseRequest = "release_requested"
+	ActionReleased       = "released"
+	ActionReleaseFailed  = "release_failed"
+)
+
+const (
+	auditFile     = "audit.jsonl"
+	requestsDir   = "requests"
+	exitsDir      = "exits"
+	recordVersion = 1
+)
+
+// Request records a VEM request whose result the escrow is waiting for
+type Request struct {
+	VemID string `json:"vemId"`
+	// Signer is the withdrawal address that authorised the request
+	Signer      common.Address        `json:"signer"`
+	Pubkeys     []consensus.BLSPubkey `json:"pubkeys"`
+	RequestedAt time.Time             `json:"requestedAt"`
+	ImportedAt  *time.Time            `json:"importedAt,omitempty"`
+}
+
+// Provenance records where an escrowed exit came from
+type Provenance struct {
+	VemID       string         `json:"vemId"`
+	Signer      common.Address `json:"signer"`
+	RequestedAt time.Time      `json:"requestedAt"`
+	ImportedAt  time.Time      `json:"importedAt"`
+}
+
+// Release records one submission of an exit to a beacon node
+type Release struct {
+	At       time.Time `json:"at"`
+	Operator string    `json:"operator"`
+	Reason   string    `json:"reason"`
+	Beacon   string    `json:"beacon"`
+}
+
+// Entry describes an escrowed exit. The signed message itself stays sealed
+// until Release.
+type Entry struct {
+	Pubkey         consensus.BLSPubkey `json:"pubkey"`
+	ValidatorIndex uint64              `json:"validatorIndex"`
+	Epoch          uint64              `json:"epoch"`
+	Provenance     Provenance          `json:"provenance"`
+	Releases       []Release           `json:"releases,omitempty"`
+}
+
+// Imported is an entry as Import returns it, with the exit it seals
+type Imported struct {
+	Entry
+	Exit consensus.SignedVoluntaryExit
+}
+
+// record is the on-disk form of one escrowed exit
+type record struct {
+	Version int `json:"version"`
+	Entry
+	Exit vemcrypto.SealedBox `json:"exit"`
+}
+
+// AuditEvent is one line of the audit log
+type AuditEvent struct {
+	Time           time.Time `json:"time"`
+	Action         string    `json:"action"`
+	VemID          string    `json:"vemId,omitempty"`
+	Pubkey         string    `json:"pubkey,omitempty"`
+	ValidatorIndex *uint64   `json:"validatorIndex,omitempty"`
+	Operator       string    `json:"operator,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Beacon         string    `json:"beacon,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Submitter hands a signed exit to a beacon node; consensus.BeaconClient
+// satisfies it
+type Submitter interface {
+	SubmitVoluntaryExit(ctx context.Context, exit *consensus.SignedVoluntaryExit) error
+}
+
+// ReleaseRequest says who releases an exit, why, and to which beacon node
+type ReleaseRequest struct {
+	Operator string
+	Reason   string
+	// Beacon names the node in the audit log, usually its URL
+	Beacon string
+}
+
+// Escrow is a directory of sealed exits, one file per validator, with the
+// VEM requests they answer and an append-only audit log
+type Escrow struct {
+	dir     string
+	sealer  vemcrypto.Sealer
+	network consensus.Network
+
+	mu sync.Mutex
+}
+
+// Open opens or creates an escrow in dir. Exits are validated for network.
+func Open(dir string, sealer vemcrypto.Sealer, network consensus.Network) (*Escrow, error) {
+	for _, sub := range []string{requestsDir, exitsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Escrow{dir: dir, sealer: sealer, network: network}, nil
+}
+
+/*
+   ---------- IMPORT ----------
+*/
+
+// Expect records that vemID asks for exits of pubkeys on behalf of signer,
+// so its result can be checked and attributed when it arrives
+func (e *Escrow) Expect(vemID string, signer common.Address, pubkeys []consensus.BLSPubkey) error {
+	if err := checkID(vemID); err != nil {
+		return err
+	}
+	if len(pubkeys) == 0 {
+		return errors.New("escrow: vem request has no pubkeys")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if existing, err := e.loadRequest(vemID); err == nil {
+		if existing.Signer != signer || !slices.Equal(existing.Pubkeys, pubkeys) {
+			return fmt.Errorf("escrow: vem %s is already expected for other validators or another signer", vemID)
+		}
+		return nil
+	} else if !errors.Is(err, ErrUnexpectedVem) {
+		return err
+	}
+
+	req := Request{VemID: vemID, Signer: signer, Pubkeys: pubkeys, RequestedAt: time.Now().UTC()}
+	if err := e.saveRequest(&req); err != nil {
+		return err
+	}
+	return e.audit(AuditEvent{Action: ActionExpect, VemID: vemID})
+}
+
+// Import checks the decrypted result of vemID and seals each exit. Every
+// exit must be signed by one of the requested validators for the escrow's
+// network and carry an epoch that has already started. Nothing is stored
+// unless every exit passes. Importing the same result again is a no-op.
+// Each returned entry carries the exit it seals, so callers need not verify
+// the result themselves.
+func (e *Escrow) Import(vemID string, plaintext []byte) ([]Imported, error) {
+	exits, err := consensus.ParseSignedVoluntaryExits(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("escrow: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	req, err := e.loadRequest(vemID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	current := e.network.EpochAt(now)
+	for _, exit := range exits {
+		if exit.Message.Epoch > current {
+			return nil, fmt.Errorf("%w: validator %d exits at epoch %d, %s is at %d",
+				ErrFutureEpoch, exit.Message.ValidatorIndex, exit.Message.Epoch, e.network.Name, current)
+		}
+	}
+	signers, err := consensus.MatchExitSigners(exits, req.Pubkeys, e.network)
+	if err != nil {
+		return nil, fmt.Errorf("escrow: vem %s: %w", vemID, err)
+	}
+
+	records := make([]*record, 0, len(exits))
+	seen := make(map[consensus.BLSPubkey]bool)
+	for i, exit := range exits {
+		if signers[i] == nil {
+			return nil, fmt.Errorf("escrow: exit for validator %d is not signed by any validator in vem %s on %s: %w",
+				exit.Message.ValidatorIndex, vemID, e.network.Name, consensus.ErrInvalidSignature)
+		}
+		pubkey := *signers[i]
+		if seen[pubkey] {
+			return nil, fmt.Errorf("escrow: vem %s returned two exits for %s", vemID, pubkey)
+		}
+		seen[pubkey] = true
+
+		rec := &record{Version: recordVersion, Entry: Entry{
+			Pubkey:         pubkey,
+			ValidatorIndex: exit.Message.ValidatorIndex,
+			Epoch:          exit.Message.Epoch,
+			Provenance: Provenance{
+				VemID:       vemID,
+				Signer:      req.Signer,
+				RequestedAt: req.RequestedAt,
+				ImportedAt:  now,
+			},
+		}}
+		records = append(records, rec)
+	}
+
+	// Check every validator before writing anything
+	var fresh []*record
+	entries := make([]Imported, 0, len(records))
+	for i, rec := range records {
+		existing, err := e.loadRecord(rec.Pubkey)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			raw, err := json.Marshal(exits[i])
+			if err != nil {
+				return nil, err
+			}
+			if rec.Exit, err = e.sealer.Seal(raw, rec.aad()); err != nil {
+				return nil, err
+			}
+			fresh = append(fresh, rec)
+			entries = append(entries, Imported{Entry: rec.Entry, Exit: exits[i]})
+		case err != nil:
+			return nil, err
+		default:
+			stored, err := e.openExit(existing)
+			if err != nil {
+				return nil, err
+			}
+			if stored.Message != exits[i].Message || stored.Signature != exits[i].Signature {
+				return nil, fmt.Errorf("%w: %s", ErrConflict, rec.Pubkey)
+			}
+			entries = append(entries, Imported{Entry: existing.Entry, Exit: exits[i]})
+		}
+	}
+
+	for _, rec := range fresh {
+		if err := e.saveRecord(rec); err != nil {
+			return nil, err
+		}
+		index := rec.ValidatorIndex
+		if err := e.audit(AuditEvent{Action: ActionImport, VemID: vemID, Pubkey: rec.Pubkey.String(), ValidatorIndex: &index}); err != nil {
+			return nil, err
+		}
+	}
+	if req.ImportedAt == nil {
+		req.ImportedAt = &now
+		if err := e.saveRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+/*
+   ---------- LOOKUP ----------
+*/
+
+// List returns every escrowed exit ordered by validator index
+func (e *Escrow) List() ([]Entry, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.list()
+}
+
+func (e *Escrow) list() ([]Entry, error) {
+	files, err := os.ReadDir(filepath.Join(e.dir, exitsDir))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() {
+			continue
+		}
+		pubkey, err := consensus.ParseBLSPubkey(name)
+		if err != nil {
+			continue
+		}
+		rec, err := e.loadRecord(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, rec.Entry)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ValidatorIndex < entries[b].ValidatorIndex })
+	return entries, nil
+}
+
+// Get returns the entry for pubkey
+func (e *Escrow) Get(pubkey consensus.BLSPubkey) (Entry, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec, err := e.loadRecord(pubkey)
+	if err != nil {
+		return Entry{}, err
+	}
+	return rec.Entry, nil
+}
+
+// ByIndex returns the entry for a validator index
+func (e *Escrow) ByIndex(index uint64) (Entry, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	entries, err := e.list()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ValidatorIndex == index {
+			return entry, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("%w: index %d", ErrNotFound, index)
+}
+
+/*
+   ---------- RELEASE ----------
+*/
+
+// Release unseals the exit for pubkey and submits it through submitter. The
+// attempt is written to the audit log before anything is submitted, and its
+// outcome after; without an audit record nothing is released.
+func (e *Escrow) Release(ctx context.Context, pubkey consensus.BLSPubkey, req ReleaseRequest, submitter Submitter) (*consensus.SignedVoluntaryExit, error) {
+	if strings.TrimSpace(req.Operator) == "" || strings.TrimSpace(req.Reason) == "" {
+		return nil, errors.New("escrow: releasing an exit needs an operator and a reason")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rec, err := e.loadRecord(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	exit, err := e.openExit(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := exit.Verify(pubkey, e.network); err != nil {
+		return nil, fmt.Errorf("escrow: %w", err)
+	}
+
+	index := rec.ValidatorIndex
+	event := AuditEvent{
+		VemID:          rec.Provenance.VemID,
+		Pubkey:         pubkey.String(),
+		ValidatorIndex: &index,
+		Operator:       req.Operator,
+		Reason:         req.Reason,
+		Beacon:         req.Beacon,
+	}
+	event.Action = ActionReleaseRequest
+	if err := e.audit(event); err != nil {
+		return nil, fmt.Errorf("escrow: not releasing without an audit record: %w", err)
+	}
+
+	if err := submitter.SubmitVoluntaryExit(ctx, exit); err != nil {
+		event.Action, event.Error = ActionReleaseFailed, err.Error()
+		if auditErr := e.audit(event); auditErr != nil {
+			return nil, errors.Join(err, auditErr)
+		}
+		return nil, err
+	}
+
+	event.Action = ActionReleased
+	rec.Releases = append(rec.Releases, Release{
+		At:       time.Now().UTC(),
+		Operator: req.Operator,
+		Reason:   req.Reason,
+		Beacon:   req.Beacon,
+	})
+	if err := e.saveRecord(rec); err != nil {
+		return exit, err
+	}
+	return exit, e.audit(event)
+}
+
+// Audit returns the audit log oldest first
+func (e *Escrow) Audit() ([]AuditEvent, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	f, err := os.Open(filepath.Join(e.dir, auditFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("escrow: corrupt audit log line %d: %w", len(events)+1, err)
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+/*
+   ---------- STORAGE ----------
+*/
+
+// aad binds the sealed exit to the clear metadata next to it, so an edited
+// index or epoch will not open
+func (r *record) aad() []byte {
+	aad := make([]byte, 0, len(r.Pubkey)+16)
+	aad = append(aad, r.Pubkey[:]...)
+	aad = binary.BigEndian.AppendUint64(aad, r.ValidatorIndex)
+	return binary.BigEndian.AppendUint64(aad, r.Epoch)
+}
+
+func (e *Escrow) openExit(rec *record) (*consensus.SignedVoluntaryExit, error) {
+	raw, err := e.sealer.Open(rec.Exit, rec.aad())
+	if err != nil {
+		return nil, fmt.Errorf("escrow: exit for %s: %w", rec.Pubkey, err)
+	}
+	var exit consensus.SignedVoluntaryExit
+	if err := json.Unmarshal(raw, &exit); err != nil {
+		return nil, fmt.Errorf("escrow: exit for %s: %w", rec.Pubkey, err)
+	}
+	if exit.Message.ValidatorIndex != rec.ValidatorIndex || exit.Message.Epoch != rec.Epoch {
+		return nil, fmt.Errorf("escrow: exit for %s does not match its record", rec.Pubkey)
+	}
+	return &exit, nil
+}
+
+func (e *Escrow) recordPath(pubkey consensus.BLSPubkey) string {
+	return filepath.Join(e.dir, exitsDir, pubkey.String()+".json")
+}
+
+func (e *Escrow) loadRecord(pubkey consensus.BLSPubkey) (*record, error) {
+	data, err := os.ReadFile(e.recordPath(pubkey))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, pubkey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("escrow: corrupt record for %s: %w", pubkey, err)
+	}
+	if rec.Version != recordVersion {
+		return nil, fmt.Errorf("escrow: unsupported record version %d", rec.Version)
+	}
+	if rec.Pubkey != pubkey {
+		return nil, fmt.Errorf("escrow: record for %s names %s", pubkey, rec.Pubkey)
+	}
+	return &rec, nil
+}
+
+func (e *Escrow) saveRecord(rec *record) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(e.recordPath(rec.Pubkey), data)
+}
+
+func (e *Escrow) loadRequest(vemID string) (*Request, error) {
+	if err := checkID(vemID); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(e.dir, requestsDir, vemID+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedVem, vemID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("escrow: corrupt request %s: %w", vemID, err)
+	}
+	return &req, nil
+}
+
+func (e *Escrow) saveRequest(req *Request) error {
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(e.dir, requestsDir, req.VemID+".json"), data)
+}
+
+// audit appends ev to the log and syncs it. It must be called with e.mu held.
+func (e *Escrow) audit(ev AuditEvent) error {
+	ev.Time = time.Now().UTC()
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(e.dir, auditFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func checkID(vemID string) error {
+	if vemID == "" || strings.ContainsAny(vemID, `/\`) || vemID == "." || vemID == ".." {
+		return fmt.Errorf("escrow: invalid vem request ID %q", vemID)
+	}
+	return nil
+}
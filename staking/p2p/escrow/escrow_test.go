@@ -0,0 +1,179 @@
+package escrow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"consensus"
+	"p2p/escrow"
+	"p2p/p2ptest"
+	"p2p/vemcrypto"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var signer = common.HexToAddress("0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17")
+
+// recordingBeacon accepts every exit
+type recordingBeacon struct {
+	exits []*consensus.SignedVoluntaryExit
+	err   error
+}
+
+func (b *recordingBeacon) SubmitVoluntaryExit(_ context.Context, exit *consensus.SignedVoluntaryExit) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.exits = append(b.exits, exit)
+	return nil
+}
+
+func openEscrow(t *testing.T, dir string) *escrow.Escrow {
+	t.Helper()
+	sealer, err := vemcrypto.KeySealer([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := escrow.Open(dir, sealer, consensus.Hoodi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func marshal(t *testing.T, exits ...consensus.SignedVoluntaryExit) []byte {
+	t.Helper()
+	b, err := json.Marshal(exits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestImportAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	e := openEscrow(t, dir)
+	a, b := p2ptest.NewBLSKey(), p2ptest.NewBLSKey()
+
+	if err := e.Expect("vem-1", signer, []consensus.BLSPubkey{a.Pubkey, b.Pubkey}); err != nil {
+		t.Fatal(err)
+	}
+	// Exits may come back in any order
+	result := marshal(t, b.Exit(7, 1000, consensus.Hoodi), a.Exit(5, 1000, consensus.Hoodi))
+	entries, err := e.Import("vem-1", result)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Pubkey != b.Pubkey || entries[1].Provenance.Signer != signer {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if _, err := e.Import("vem-1", result); err != nil {
+		t.Fatalf("re-import of the same result: %v", err)
+	}
+
+	// Nothing signed is stored in the clear
+	data, _ := os.ReadFile(filepath.Join(dir, "exits", a.Pubkey.String()+".json"))
+	if strings.Contains(string(data), "signature") {
+		t.Fatalf("exit stored in the clear:\n%s", data)
+	}
+
+	entry, err := e.ByIndex(5)
+	if err != nil || entry.Pubkey != a.Pubkey || entry.Provenance.VemID != "vem-1" {
+		t.Fatalf("lookup by index: %+v %v", entry, err)
+	}
+
+	beacon := &recordingBeacon{}
+	if _, err := e.Release(context.Background(), a.Pubkey, escrow.ReleaseRequest{Reason: "offboarding"}, beacon); err == nil {
+		t.Fatalf("expected a release without an operator to be refused")
+	}
+	exit, err := e.Release(context.Background(), a.Pubkey,
+		escrow.ReleaseRequest{Operator: "alice", Reason: "offboarding", Beacon: "http://beacon"}, beacon)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if len(beacon.exits) != 1 || beacon.exits[0].Message.ValidatorIndex != 5 || exit.Verify(a.Pubkey, consensus.Hoodi) != nil {
+		t.Fatalf("unexpected submitted exits %+v", beacon.exits)
+	}
+	if entry, _ := e.Get(a.Pubkey); len(entry.Releases) != 1 || entry.Releases[0].Operator != "alice" {
+		t.Fatalf("release not recorded: %+v", entry)
+	}
+
+	// A failed submission is audited too
+	failing := &recordingBeacon{err: errors.New("connection refused")}
+	if _, err := e.Release(context.Background(), b.Pubkey, escrow.ReleaseRequest{Operator: "bob", Reason: "test"}, failing); err == nil {
+		t.Fatalf("expected the submit error")
+	}
+
+	events, err := e.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, ev := range events {
+		actions = append(actions, ev.Action)
+	}
+	want := "expect import import release_requested released release_requested release_failed"
+	if got := strings.Join(actions, " "); got != want {
+		t.Fatalf("audit log %q, want %q", got, want)
+	}
+}
+
+func TestImportRejectsBadExits(t *testing.T) {
+	e := openEscrow(t, t.TempDir())
+	a, stranger := p2ptest.NewBLSKey(), p2ptest.NewBLSKey()
+	if err := e.Expect("vem-1", signer, []consensus.BLSPubkey{a.Pubkey}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]byte{
+		"signed by another validator": marshal(t, stranger.Exit(5, 1000, consensus.Hoodi)),
+		"signed for another network":  marshal(t, a.Exit(5, 1000, consensus.Mainnet)),
+		"tampered index":              []byte(strings.Replace(string(marshal(t, a.Exit(5, 1000, consensus.Hoodi))), `"5"`, `"6"`, 1)),
+	}
+	for name, result := range cases {
+		if _, err := e.Import("vem-1", result); !errors.Is(err, consensus.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+	if _, err := e.Import("vem-1", marshal(t, a.Exit(5, 1<<40, consensus.Hoodi))); !errors.Is(err, escrow.ErrFutureEpoch) {
+		t.Errorf("expected ErrFutureEpoch, got %v", err)
+	}
+	if _, err := e.Import("vem-2", marshal(t, a.Exit(5, 1000, consensus.Hoodi))); !errors.Is(err, escrow.ErrUnexpectedVem) {
+		t.Errorf("expected ErrUnexpectedVem, got %v", err)
+	}
+	if entries, _ := e.List(); len(entries) != 0 {
+		t.Fatalf("rejected exits were stored: %+v", entries)
+	}
+
+	if _, err := e.Import("vem-1", marshal(t, a.Exit(5, 1000, consensus.Hoodi))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Import("vem-1", marshal(t, a.Exit(5, 1001, consensus.Hoodi))); !errors.Is(err, escrow.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestEditedRecordDoesNotOpen(t *testing.T) {
+	dir := t.TempDir()
+	e := openEscrow(t, dir)
+	a := p2ptest.NewBLSKey()
+	e.Expect("vem-1", signer, []consensus.BLSPubkey{a.Pubkey})
+	if _, err := e.Import("vem-1", marshal(t, a.Exit(5, 1000, consensus.Hoodi))); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "exits", a.Pubkey.String()+".json")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"validatorIndex": 5`, `"validatorIndex": 6`, 1)), 0o600)
+
+	beacon := &recordingBeacon{}
+	_, err := e.Release(context.Background(), a.Pubkey, escrow.ReleaseRequest{Operator: "alice", Reason: "test"}, beacon)
+	if !errors.Is(err, vemcrypto.ErrUnseal) || len(beacon.exits) != 0 {
+		t.Fatalf("expected an edited record to fail to unseal, got %v", err)
+	}
+}
@@ -1,20 +1,97 @@
 package main
 
 import (
+	"consensus"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	p2pclient "p2p/client"
+	"p2p/depositdata"
+	"p2p/eigenlayer"
+	"p2p/poll"
 	"p2p/vemcrypto"
 	"p2p/vemflow"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	token := "<P2P_BEARER_TOKEN>"
-	client := p2pclient.NewHTTPClient()
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// run is the whole provision and exit flow, configured from the
+// environment. $P2P_POLL_INTERVAL sets the first delay between status polls.
+func run(ctx context.Context, args []string, out io.Writer) error {
+	baseURL := os.Getenv("P2P_BASE_URL")
+	if baseURL == "" {
+		baseURL = p2pclient.TestnetBaseURL
+	}
+	client := p2pclient.NewClient(baseURL, p2pclient.StaticToken(os.Getenv("P2P_BEARER_TOKEN")))
+
+	// relays list|update: show the relay sets on offer or move running
+	// validators to another. Neither touches the sealed keys or the escrow.
+	if len(args) > 0 && args[0] == "relays" {
+		return runRelays(ctx, out, client, args[1:])
+	}
+
+	networkName := os.Getenv("P2P_NETWORK")
+	if networkName == "" {
+		networkName = consensus.Hoodi.Name
+	}
+	network, err := consensus.NetworkByName(networkName)
+	if err != nil {
+		return err
+	}
+
+	sealer, err := openSealer()
+	if err != nil {
+		return err
+	}
+	keys, err := openKeyStore(sealer)
+	if err != nil {
+		return err
+	}
+	exits, err := openEscrow(sealer, network)
+	if err != nil {
+		return err
+	}
+	pollConfig := poll.Config{}
+	if interval := os.Getenv("P2P_POLL_INTERVAL"); interval != "" {
+		if pollConfig.Initial, err = time.ParseDuration(interval); err != nil {
+			return fmt.Errorf("invalid P2P_POLL_INTERVAL: %w", err)
+		}
+	}
+	// $P2P_VEM_SUITE requires VEM results in one encryption suite, so P2P
+	// cannot downgrade them; unset accepts any known suite
+	suite := vemcrypto.Suite(os.Getenv("P2P_VEM_SUITE"))
+	switch suite {
+	case "", vemcrypto.SuiteP256SHA256AESGCM, vemcrypto.SuiteP256HKDFSHA256AESGCM:
+	default:
+		return fmt.Errorf("invalid P2P_VEM_SUITE %q", suite)
+	}
+
+	switch {
+	// resume <vem-id>: reload the sealed ECDH key of an earlier run and keep
+	// polling for its result
+	case len(args) == 2 && args[0] == "resume":
+		return resume(ctx, out, client, keys, exits, pollConfig, suite, args[1])
+	// escrow list|release: inspect escrowed exits or submit one
+	case len(args) > 0 && args[0] == "escrow":
+		return runEscrow(ctx, out, exits, args[1:])
+	case len(args) > 0:
+		return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+	}
 
 	/*
 	   ----------------------------------------------------------------
@@ -24,34 +101,55 @@ func main() {
 
 	provisionID := "3611b95c-e1b3-40c0-9086-3de0a4379943"
 
+	// In production the withdrawal key lives with your custody / signer; it
+	// receives withdrawals and signs exit requests
+	withdrawalKey, err := crypto.HexToECDSA(strings.TrimPrefix(os.Getenv("WITHDRAWAL_PRIVATE_KEY"), "0x"))
+	if err != nil {
+		return err
+	}
+	withdrawalAddress := crypto.PubkeyToAddress(withdrawalKey.PublicKey)
+
 	createPayload := p2pclient.CreateNodeRequestPayload{
 		ID:                        provisionID,
-		Type:                      "REGULAR",
+		Type:                      p2pclient.NodeRequestTypeRegular,
 		ValidatorsCount:           2,
 		AmountPerValidator:        "32000000000",
 		WithdrawalCredentialsType: "0x01",
-		WithdrawalAddress:         "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		WithdrawalAddress:         withdrawalAddress.Hex(),
 		EigenPodOwnerAddress:      "",
-		ControllerAddress:         "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17",
+		ControllerAddress:         withdrawalAddress.Hex(),
 		FeeRecipientAddress:       "0x53da3c92fCCEb0CFE1764f65DDfF1564A2b15585",
+		// $P2P_LOCATION and $P2P_RELAYS_SET pick where the nodes run and
+		// which MEV relays they use; both are checked before sending
 		NodesOptions: p2pclient.NodesOptionsInput{
-			Location:  "any",
-			RelaysSet: "",
+			Location:  p2pclient.LocationAny,
+			RelaysSet: p2pclient.RelaysSet(os.Getenv("P2P_RELAYS_SET")),
 		},
 	}
+	if location := os.Getenv("P2P_LOCATION"); location != "" {
+		createPayload.NodesOptions.Location = p2pclient.Location(location)
+	}
 
-	createReq, err := p2pclient.NewCreateNodeRequest(ctx, createPayload, token)
-	if err != nil {
-		panic(err)
+	// Restaking: withdraw to the owner's EigenPod instead
+	var pod *eigenlayer.Pod
+	if os.Getenv("EIGENPOD_OWNER") != "" {
+		pod, err = restakingPod(ctx, network)
+		if err != nil {
+			return err
+		}
+		createPayload, err = eigenlayer.NewRestakingNodeRequest(pod, createPayload)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Restaking to EigenPod %s (deployed: %t)\n", pod.Address, pod.Deployed)
 	}
 
-	body, status, err := p2pclient.DoRequest(client, createReq)
+	nodeRequest, err := client.CreateNodeRequest(ctx, createPayload)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Println("Provision create status:", status)
-	fmt.Println("Provision create response:", string(body))
+	fmt.Fprintln(out, "Provision create status:", nodeRequest.Status)
 
 	/*
 	   ----------------------------------------------------------------
@@ -59,110 +157,124 @@ func main() {
 	   ----------------------------------------------------------------
 	*/
 
-	statusReq, err := p2pclient.NewGetNodeRequestStatusRequest(
-		ctx,
-		provisionID,
-		token,
-	)
+	nodeStatus, err := vemflow.PollNodeRequest(ctx, client, provisionID, pollConfig,
+		func(p poll.Progress[*p2pclient.NodeRequestStatus]) {
+			switch {
+			case p.Err != nil:
+				fmt.Fprintf(out, "Provision status attempt %d failed: %v\n", p.Attempt, p.Err)
+			case p.Value != nil:
+				fmt.Fprintf(out, "Provision status attempt %d: %s\n", p.Attempt, p.Value.Status)
+			}
+		})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	statusBody, statusCode, err := p2pclient.DoRequest(client, statusReq)
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Println("Provision status HTTP:", statusCode)
-	fmt.Println("Provision status response:", string(statusBody))
-
-	/*
-	   ----------------------------------------------------------------
-	   3. EXIT: GENERATE ECDH KEYS
-	   ----------------------------------------------------------------
-	*/
+	fmt.Fprintln(out, "Provision status:", nodeStatus.Status)
 
-	ecdhPrivKey, ecdhPubKeyBase64, err := vemcrypto.GenerateECDHKeypair()
+	// Verify P2P's deposit data against what was asked for and hand it over
+	// in launchpad format
+	deposits, err := depositdata.FromNodeRequest(nodeStatus, network, createPayload)
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	/*
-	   ----------------------------------------------------------------
-	   4. EXIT: BUILD & SIGN VEM REQUEST
-	   ----------------------------------------------------------------
-	*/
-
-	// Inner VEM request MUST be a JSON STRING
-	vemRequest := fmt.Sprintf(
-		`{"action":"vem_request","pubkeys":["0xVALIDATOR_BLS_PUBKEY"],"ecdh_client_pubkey":"%s"}`,
-		ecdhPubKeyBase64,
-	)
-
-	// Ethereum signature of vemRequest (EIP-191)
-	// This MUST be produced by your custody / signer
-	vemSignature := "<ETH_SIGNATURE_HEX>"
-	vemSignedBy := "0x39D02C253dA1d9F85ddbEB3B6Dc30bc1EcBbFA17"
-
-	vemID := "uuid-vem-request-id"
-
-	vemPayload := p2pclient.VemCreatePayload{
-		ID:                  vemID,
-		Type:                "off_chain",
-		VemRequest:          vemRequest,
-		VemRequestSignature: vemSignature,
-		VemRequestSignedBy:  vemSignedBy,
+	if pod != nil {
+		if err := eigenlayer.CheckWithdrawalCredentials(deposits, pod); err != nil {
+			return err
+		}
 	}
-
+	if err := depositdata.WriteLaunchpadFile("deposit_data.json", deposits); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %d deposits to deposit_data.json\n", len(deposits))
 	/*
 	   ----------------------------------------------------------------
-	   5. EXIT: CREATE VEM
+	   3. EXIT: CHOOSE VALIDATORS AND AUTHORISATION
 	   ----------------------------------------------------------------
 	*/
 
-	vemCreateReq, err := p2pclient.NewVemCreateRequest(ctx, vemPayload, token)
-	if err != nil {
-		panic(err)
+	// $VALIDATOR_PUBKEY is a comma-separated list of validators to exit, by
+	// default the first one just provisioned
+	validatorPubkeys := []string{deposits[0].Pubkey.String()}
+	if list := os.Getenv("VALIDATOR_PUBKEY"); list != "" {
+		validatorPubkeys = strings.Split(list, ",")
+		for i := range validatorPubkeys {
+			validatorPubkeys[i] = strings.TrimSpace(validatorPubkeys[i])
+		}
 	}
 
-	vemCreateBody, vemCreateStatus, err := p2pclient.DoRequest(client, vemCreateReq)
-	if err != nil {
-		panic(err)
+	// Off chain: Ethereum signature of each request (EIP-191). On chain: the
+	// withdrawal address sends each request as calldata and the signed
+	// transaction is the proof.
+	authorize := vemflow.OffChainAuthorizer(withdrawalKey)
+	if rpcURL := os.Getenv("ETH_RPC_URL"); rpcURL != "" {
+		eth, err := ethclient.DialContext(ctx, rpcURL)
+		if err != nil {
+			return err
+		}
+		defer eth.Close()
+		authorize = vemflow.OnChainAuthorizer(eth, vemflow.KeySigner(withdrawalKey), withdrawalAddress)
 	}
 
-	fmt.Println("VEM create HTTP:", vemCreateStatus)
-	fmt.Println("VEM create response:", string(vemCreateBody))
+	// $P2P_VEM_CHUNK_SIZE caps the validators per VEM request, and
+	// $P2P_VEM_SHARED_KEY=true encrypts every chunk to one ECDH key
+	batch := vemflow.BatchConfig{
+		Network:   network,
+		Poll:      pollConfig,
+		Keys:      keys,
+		SharedKey: os.Getenv("P2P_VEM_SHARED_KEY") == "true",
+		Suite:     suite,
+	}
+	if size := os.Getenv("P2P_VEM_CHUNK_SIZE"); size != "" {
+		if batch.ChunkSize, err = strconv.Atoi(size); err != nil {
+			return fmt.Errorf("P2P_VEM_CHUNK_SIZE: %w", err)
+		}
+	}
 
 	/*
 	   ----------------------------------------------------------------
-	   6. EXIT: POLL FOR SIGNED EXIT MESSAGE
+	   4. EXIT: CREATE ONE VEM PER CHUNK
 	   ----------------------------------------------------------------
 	*/
 
-	encryptedVemResult, err := vemflow.PollVemResult(
-		ctx,
-		client,
-		token,
-		vemID,
-	)
-	if err != nil {
-		panic(err)
+	// Each chunk's ECDH key is sealed before its request is sent, so "resume"
+	// can decrypt the result if this process dies while polling, and deleted
+	// once its exits are escrowed. The escrow only accepts results it was
+	// told to expect, and records who asked.
+	batch.BeforeCreate = func(payload p2pclient.VemCreatePayload, pubkeys []consensus.BLSPubkey) error {
+		if err := exits.Expect(payload.ID, withdrawalAddress, pubkeys); err != nil {
+			return err
+		}
+		if payload.VemRequestTxId != "" {
+			fmt.Fprintln(out, "VEM transaction:", payload.VemRequestTxId)
+		}
+		fmt.Fprintf(out, "VEM request %s for %d validators\n", payload.ID, len(pubkeys))
+		return nil
 	}
 
 	/*
 	   ----------------------------------------------------------------
-	   7. EXIT: DECRYPT SIGNED VALIDATOR EXIT MESSAGE
+	   5. EXIT: POLL FOR, DECRYPT AND ESCROW THE SIGNED EXITS
 	   ----------------------------------------------------------------
 	*/
 
-	signedExitMessage, err := vemcrypto.DecryptVemResult(
-		ecdhPrivKey,
-		encryptedVemResult,
-	)
-	if err != nil {
-		panic(err)
+	// The escrow verifies each chunk as it seals it, in place of the batch
+	batch.Import = func(vemID string, plaintext []byte) (map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, error) {
+		entries, err := exits.Import(vemID, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		signed := make(map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, len(entries))
+		for _, entry := range entries {
+			fmt.Fprintf(out, "Escrowed exit for validator %d (%s) at epoch %d\n", entry.ValidatorIndex, entry.Pubkey, entry.Epoch)
+			signed[entry.Pubkey] = &entry.Exit
+		}
+		return signed, nil
 	}
 
-	fmt.Println("SIGNED VALIDATOR EXIT MESSAGE:")
-	fmt.Println(string(signedExitMessage))
+	result, err := vemflow.RunBatch(ctx, client, validatorPubkeys, authorize, batch)
+	if err != nil {
+		return err
+	}
+	return result.Err()
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/depositdata"
+	"p2p/p2ptest"
+	"p2p/vemcrypto"
+	"p2p/vemflow"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// setupFlow points the flow at a fake P2P API with a fresh withdrawal key,
+// inside a temporary working directory
+func setupFlow(t *testing.T) *p2ptest.Server {
+	t.Helper()
+	srv := p2ptest.NewServer()
+	t.Cleanup(srv.Close)
+	t.Chdir(t.TempDir())
+
+	key, _ := crypto.GenerateKey()
+	t.Setenv("P2P_BASE_URL", srv.URL)
+	t.Setenv("P2P_BEARER_TOKEN", srv.Token)
+	t.Setenv("P2P_NETWORK", "hoodi")
+	t.Setenv("P2P_POLL_INTERVAL", "10ms")
+	t.Setenv("P2P_KEY_DIR", "vem-keys")
+	t.Setenv("P2P_ESCROW_DIR", "exit-escrow")
+	t.Setenv("P2P_KEY_SECRET", "")
+	t.Setenv("P2P_KEY_PASSPHRASE", "correct horse")
+	t.Setenv("WITHDRAWAL_PRIVATE_KEY", hex.EncodeToString(crypto.FromECDSA(key)))
+	t.Setenv("VALIDATOR_PUBKEY", "")
+	t.Setenv("ETH_RPC_URL", "")
+	t.Setenv("EIGENPOD_OWNER", "")
+	t.Setenv("P2P_LOCATION", "")
+	t.Setenv("P2P_RELAYS_SET", "")
+	return srv
+}
+
+// fakeBeacon records the exits submitted to its pool
+func fakeBeacon(t *testing.T) (*httptest.Server, *[]consensus.SignedVoluntaryExit) {
+	t.Helper()
+	var pool []consensus.SignedVoluntaryExit
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var exit consensus.SignedVoluntaryExit
+		if r.URL.Path != "/eth/v1/beacon/pool/voluntary_exits" || json.NewDecoder(r.Body).Decode(&exit) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pool = append(pool, exit)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pool
+}
+
+func TestRunFlowAgainstFakeAPI(t *testing.T) {
+	srv := setupFlow(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	if err := run(ctx, nil, &out); err != nil {
+		t.Fatalf("run: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Provision status attempt 1: processing") {
+		t.Fatalf("expected to see the request processing:\n%s", out.String())
+	}
+
+	data, err := os.ReadFile("deposit_data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []depositdata.LaunchpadEntry
+	if err := json.Unmarshal(data, &entries); err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected deposit_data.json (%v):\n%s", err, data)
+	}
+
+	// The exit is escrowed, not printed
+	pubkey, _ := consensus.ParseBLSPubkey(entries[0].Pubkey)
+	index, _ := srv.ValidatorIndex(pubkey)
+	if strings.Contains(out.String(), "signature") || !strings.Contains(out.String(), fmt.Sprintf("Escrowed exit for validator %d", index)) {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	// Once the exits are escrowed the sealed ECDH key is deleted
+	created := regexp.MustCompile(`VEM request (\S+) for 1 validators`).FindStringSubmatch(out.String())
+	if created == nil {
+		t.Fatalf("expected the VEM request ID:\n%s", out.String())
+	}
+	if err := run(ctx, []string{"resume", created[1]}, new(bytes.Buffer)); !errors.Is(err, vemcrypto.ErrKeyNotFound) {
+		t.Fatalf("expected the key to be gone after escrow, got %v", err)
+	}
+
+	out.Reset()
+	if err := run(ctx, []string{"escrow", "list"}, &out); err != nil || !strings.Contains(out.String(), pubkey.String()) {
+		t.Fatalf("escrow list (%v):\n%s", err, out.String())
+	}
+
+	beacon, pool := fakeBeacon(t)
+	release := []string{"escrow", "release", "-index", strconv.FormatUint(index, 10), "-beacon-url", beacon.URL}
+	if err := run(ctx, release, new(bytes.Buffer)); err == nil {
+		t.Fatalf("expected a release without operator and reason to be refused")
+	}
+	release = append(release, "-operator", "alice", "-reason", "offboarding")
+	if err := run(ctx, release, new(bytes.Buffer)); err != nil {
+		t.Fatalf("escrow release: %v", err)
+	}
+	if len(*pool) != 1 || (*pool)[0].Message.ValidatorIndex != index {
+		t.Fatalf("unexpected beacon pool %+v", *pool)
+	}
+	if err := (*pool)[0].Verify(pubkey, consensus.Hoodi); err != nil {
+		t.Fatalf("released exit does not verify: %v", err)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestResumeInterruptedRun(t *testing.T) {
+	srv := setupFlow(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Hold the VEM result back once the request is signed, and stop the run
+	// once it has been sent
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var out bytes.Buffer
+	w := writerFunc(func(p []byte) (int, error) {
+		if bytes.HasPrefix(p, []byte("VEM request")) {
+			srv.SetSteps(1 << 30)
+			go func() {
+				for srv.Requests("/api/v1/eth/staking/direct/vem/create") == 0 && runCtx.Err() == nil {
+					time.Sleep(5 * time.Millisecond)
+				}
+				stop()
+			}()
+		}
+		return out.Write(p)
+	})
+	if err := run(runCtx, nil, w); err == nil {
+		t.Fatalf("expected the interrupted run to fail:\n%s", out.String())
+	}
+	created := regexp.MustCompile(`VEM request (\S+) for 1 validators`).FindStringSubmatch(out.String())
+	if created == nil {
+		t.Fatalf("expected the VEM request ID:\n%s", out.String())
+	}
+
+	srv.SetSteps(1)
+	out.Reset()
+	if err := run(ctx, []string{"resume", created[1]}, &out); err != nil || !strings.Contains(out.String(), "Escrowed exit") {
+		t.Fatalf("resume (%v):\n%s", err, out.String())
+	}
+	if err := run(ctx, []string{"resume", created[1]}, new(bytes.Buffer)); !errors.Is(err, vemcrypto.ErrKeyNotFound) {
+		t.Fatalf("expected the key deleted after resume, got %v", err)
+	}
+}
+
+func TestRunFlowReportsFailedVem(t *testing.T) {
+	srv := setupFlow(t)
+	srv.FailNextVem(p2pclient.VemStatusError, "validator is not active")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := run(ctx, nil, new(bytes.Buffer))
+	var failed *vemflow.RequestFailedError
+	if !errors.As(err, &failed) || failed.Detail != "validator is not active" {
+		t.Fatalf("expected a failed VEM, got %v", err)
+	}
+}
+
+func TestRunRelays(t *testing.T) {
+	srv := setupFlow(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// An unknown relay set is refused before the node request is sent
+	t.Setenv("P2P_RELAYS_SET", "everything")
+	if err := run(ctx, nil, new(bytes.Buffer)); !errors.Is(err, p2pclient.ErrInvalidNodesOptions) {
+		t.Fatalf("expected invalid nodes options, got %v", err)
+	}
+	if n := srv.Requests("/api/v1/eth/staking/direct/nodes-request/create"); n != 0 {
+		t.Fatalf("expected no node request, got %d", n)
+	}
+
+	t.Setenv("P2P_RELAYS_SET", string(p2pclient.RelaysSetMaxProfit))
+	if err := run(ctx, nil, new(bytes.Buffer)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	data, _ := os.ReadFile("deposit_data.json")
+	var entries []depositdata.LaunchpadEntry
+	json.Unmarshal(data, &entries)
+	pubkey, _ := consensus.ParseBLSPubkey(entries[0].Pubkey)
+	if set, _ := srv.RelaysSet(pubkey); set != p2pclient.RelaysSetMaxProfit {
+		t.Fatalf("expected the node on max-profit, got %q", set)
+	}
+
+	// Relay commands need no key passphrase
+	t.Setenv("P2P_KEY_PASSPHRASE", "")
+	var out bytes.Buffer
+	if err := run(ctx, []string{"relays", "update", "ethical", pubkey.String()}, &out); err != nil {
+		t.Fatalf("relays update: %v", err)
+	}
+	if set, _ := srv.RelaysSet(pubkey); set != p2pclient.RelaysSetEthical {
+		t.Fatalf("expected the node moved to ethical, got %q", set)
+	}
+	if err := run(ctx, []string{"relays", "list"}, &out); err != nil || !strings.Contains(out.String(), "ethical") {
+		t.Fatalf("relays list (%v):\n%s", err, out.String())
+	}
+}
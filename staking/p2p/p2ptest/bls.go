@@ -0,0 +1,35 @@
+package p2ptest
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"consensus"
+	"consensus/blstest"
+	p2pclient "p2p/client"
+)
+
+// BLSKey is a validator signing key held by the fake
+type BLSKey struct {
+	blstest.Key
+}
+
+// NewBLSKey returns a random validator key
+func NewBLSKey() BLSKey {
+	return BLSKey{blstest.NewKey()}
+}
+
+// Deposit returns a signed deposit for the key in the shape P2P returns it
+func (k BLSKey) Deposit(creds [32]byte, amountGwei uint64, network consensus.Network) p2pclient.NodeDepositData {
+	data := k.Key.Deposit(creds, amountGwei, network)
+	msgRoot := data.DepositMessage.HashTreeRoot()
+	dataRoot := data.HashTreeRoot()
+	return p2pclient.NodeDepositData{
+		Pubkey:                k.Pubkey.String(),
+		WithdrawalCredentials: "0x" + hex.EncodeToString(creds[:]),
+		Amount:                strconv.FormatUint(amountGwei, 10),
+		Signature:             data.Signature.String(),
+		DepositMessageRoot:    "0x" + hex.EncodeToString(msgRoot[:]),
+		DepositDataRoot:       "0x" + hex.EncodeToString(dataRoot[:]),
+	}
+}
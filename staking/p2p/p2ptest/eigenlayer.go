@@ -0,0 +1,95 @@
+package p2ptest
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/program"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var addressMask = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+
+// EigenPodManagerAlloc returns genesis accounts for a stand-in
+// EigenPodManager at manager and a stand-in EigenPod for each owner in pods.
+// The manager keeps owner => pod in the storage slot numbered by the owner
+// address, and getPod for an owner without a pod returns the low 20 bytes
+// of keccak256(owner) in place of EigenLayer's CREATE2 address.
+func EigenPodManagerAlloc(manager common.Address, pods map[common.Address]common.Address) types.GenesisAlloc {
+	storage := make(map[common.Hash]common.Hash, len(pods))
+	alloc := types.GenesisAlloc{}
+	for owner, pod := range pods {
+		storage[common.BytesToHash(owner.Bytes())] = common.BytesToHash(pod.Bytes())
+		alloc[pod] = types.Account{
+			Code:    eigenPodCode,
+			Balance: new(big.Int),
+			Storage: map[common.Hash]common.Hash{{}: common.BytesToHash(owner.Bytes())},
+		}
+	}
+	alloc[manager] = types.Account{Code: eigenPodManagerCode, Balance: new(big.Int), Storage: storage}
+	return alloc
+}
+
+// EigenPodAlloc returns a genesis account for a stand-in EigenPod at pod
+// that names owner as its podOwner, without registering it with a manager
+func EigenPodAlloc(pod, owner common.Address) types.GenesisAlloc {
+	return types.GenesisAlloc{pod: {
+		Code:    eigenPodCode,
+		Balance: new(big.Int),
+		Storage: map[common.Hash]common.Hash{{}: common.BytesToHash(owner.Bytes())},
+	}}
+}
+
+var (
+	eigenPodManagerCode = assemble(managerProgram)
+	// eigenPodCode answers podOwner() with storage slot 0
+	eigenPodCode = program.New().Push(0).Op(vm.SLOAD).Push(0).Op(vm.MSTORE).Return(0, 32).Bytes()
+)
+
+func selector(sig string) []byte {
+	return crypto.Keccak256([]byte(sig))[:4]
+}
+
+// assemble builds code twice so forward jumps see their final offsets
+func assemble(build func(labels map[string]uint64) *program.Program) []byte {
+	labels := make(map[string]uint64)
+	first := build(labels).Size()
+	code := build(labels).Bytes()
+	if len(code) != first {
+		panic("p2ptest: jump offsets changed the code size")
+	}
+	return code
+}
+
+func managerProgram(labels map[string]uint64) *program.Program {
+	p := program.New()
+	mark := func(name string) {
+		_, labels[name] = p.Jumpdest()
+	}
+
+	// [owner, sload(owner), selector]
+	p.InputAddressToStack(4).Op(vm.DUP1, vm.SLOAD)
+	p.Push(0).Op(vm.CALLDATALOAD).Push(224).Op(vm.SHR)
+	for _, fn := range []string{"hasPod(address)", "getPod(address)", "ownerToPod(address)"} {
+		p.Op(vm.DUP1).Push(selector(fn)).Op(vm.EQ).Push(labels[fn]).Op(vm.JUMPI)
+	}
+	p.Push(0).Op(vm.DUP1, vm.REVERT)
+
+	mark("hasPod(address)")
+	p.Op(vm.POP, vm.ISZERO, vm.ISZERO).Jump(labels["return"])
+
+	mark("getPod(address)")
+	p.Op(vm.POP, vm.DUP1).Push(labels["return"]).Op(vm.JUMPI)
+	p.Op(vm.POP).Push(0).Op(vm.MSTORE).Push(32).Push(0).Op(vm.KECCAK256).Push(addressMask).Op(vm.AND)
+	p.Jump(labels["return"])
+
+	mark("ownerToPod(address)")
+	p.Op(vm.POP)
+
+	// Return the word on top of the stack
+	mark("return")
+	p.Push(0).Op(vm.MSTORE).Return(0, 32)
+	return p
+}
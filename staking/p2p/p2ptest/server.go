@@ -0,0 +1,594 @@
+// Package p2ptest provides an in-process stand-in for the P2P unified
+// staking API so the client and the full staking flow can be exercised
+// without a bearer token for api-test.p2p.org.
+package p2ptest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/vemcrypto"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	nodesRequestPath = "/api/v1/eth/staking/direct/nodes-request"
+	vemPath          = "/api/v1/eth/staking/direct/vem"
+	nodesOptionsPath = "/api/v1/eth/staking/direct/nodes-options"
+	nodesPath        = "/api/v1/eth/staking/direct/nodes"
+
+	// minDepositGwei and maxEffectiveBalanceGwei bound amountPerValidator
+	minDepositGwei          = 32_000_000_000
+	maxEffectiveBalanceGwei = 2048_000_000_000
+)
+
+type nodeRequest struct {
+	p2pclient.NodeRequest
+	// polls counts status calls, which drive the request forward
+	polls      int
+	validators []*validator
+}
+
+type validator struct {
+	key   BLSKey
+	index uint64
+	creds [32]byte
+	// exitSigner is the address allowed to request the validator's exit
+	exitSigner common.Address
+	relaysSet  p2pclient.RelaysSet
+}
+
+type vem struct {
+	p2pclient.VemStatus
+	polls      int
+	recipient  string
+	validators []*validator
+	// failure replaces the result once the VEM finishes
+	failure *vemFailure
+}
+
+type vemFailure struct {
+	status string
+	reason string
+}
+
+type fault struct {
+	status int
+	times  int
+}
+
+// Server is a fake P2P API backed by in-memory state. Node requests and VEMs
+// advance one step per status call: a node request goes init, processing,
+// then ready, and a VEM stays pending, each after SetSteps status calls.
+type Server struct {
+	*httptest.Server
+
+	// Token is the bearer token every request must carry
+	Token string
+
+	mu           sync.Mutex
+	nodeRequests map[string]*nodeRequest
+	vems         map[string]*vem
+	validators   map[consensus.BLSPubkey]*validator
+	faults       map[string]*fault
+	vemFailure   *vemFailure
+	requests     map[string]int
+	steps        int
+	nextIndex    uint64
+	epoch        uint64
+	network      consensus.Network
+	suite        vemcrypto.Suite
+	nodesOptions p2pclient.NodesOptions
+}
+
+// NewServer starts a fake P2P API. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		Token:        "p2ptest-" + randomHex(8),
+		nodeRequests: make(map[string]*nodeRequest),
+		vems:         make(map[string]*vem),
+		validators:   make(map[consensus.BLSPubkey]*validator),
+		faults:       make(map[string]*fault),
+		requests:     make(map[string]int),
+		steps:        2,
+		nextIndex:    100000,
+		epoch:        1000,
+		network:      consensus.Hoodi,
+		suite:        vemcrypto.SuiteP256SHA256AESGCM,
+		nodesOptions: p2pclient.NodesOptions{
+			Locations: []p2pclient.Location{p2pclient.LocationAny, p2pclient.LocationEU, p2pclient.LocationUS, p2pclient.LocationAsia},
+			RelaysSets: []p2pclient.RelaysSetInfo{
+				{Name: p2pclient.RelaysSetMaxProfit, Relays: []string{"relay-a", "relay-b"}},
+				{Name: p2pclient.RelaysSetEthical, Relays: []string{"relay-b"}},
+			},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+nodesRequestPath+"/create", s.authenticated(s.handleCreateNodeRequest))
+	mux.HandleFunc("GET "+nodesRequestPath+"/status/{id}", s.authenticated(s.handleNodeRequestStatus))
+	mux.HandleFunc("POST "+vemPath+"/create", s.authenticated(s.handleCreateVem))
+	mux.HandleFunc("GET "+vemPath+"/status/{id}", s.authenticated(s.handleVemStatus))
+	mux.HandleFunc("GET "+nodesOptionsPath, s.authenticated(s.handleNodesOptions))
+	mux.HandleFunc("POST "+nodesPath+"/relays-set", s.authenticated(s.handleUpdateRelays))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// Client returns an API client for the server
+func (s *Server) Client() *p2pclient.Client {
+	return p2pclient.NewClient(s.URL, p2pclient.StaticToken(s.Token))
+}
+
+/*
+   ---------- CONFIGURATION ----------
+*/
+
+// SetSteps sets how many status calls a request takes to finish
+func (s *Server) SetSteps(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = max(n, 1)
+}
+
+// SetNetwork sets the network deposits and exits are signed for
+func (s *Server) SetNetwork(network consensus.Network) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.network = network
+}
+
+// SetEpoch sets the epoch exit messages are signed for
+func (s *Server) SetEpoch(epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch = epoch
+}
+
+// SetSuite sets the suite VEM results are encrypted with
+func (s *Server) SetSuite(suite vemcrypto.Suite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suite = suite
+}
+
+// SetNodesOptions sets the locations and relay sets the server offers and
+// accepts
+func (s *Server) SetNodesOptions(opts p2pclient.NodesOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodesOptions = opts
+}
+
+/*
+   ---------- FAILURE INJECTION ----------
+*/
+
+// FailNext makes the next n requests to path answer with status instead of
+// reaching the handler
+func (s *Server) FailNext(path string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[path] = &fault{status: status, times: n}
+}
+
+// CancelNodeRequest moves a node request to cancelled with reason
+func (s *Server) CancelNodeRequest(id, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nr, ok := s.nodeRequests[id]
+	if !ok {
+		return fmt.Errorf("unknown node request %s", id)
+	}
+	nr.Status = p2pclient.NodeRequestCancelled
+	nr.ErrorMessage = reason
+	return nil
+}
+
+// FailVem moves a VEM to status, error or fault, with reason
+func (s *Server) FailVem(id, status, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.vems[id]
+	if !ok {
+		return fmt.Errorf("unknown vem %s", id)
+	}
+	v.Status = status
+	v.ErrorMessage = reason
+	return nil
+}
+
+// FailNextVem makes the next VEM created end with status, error or fault,
+// and reason instead of a result
+func (s *Server) FailNextVem(status, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vemFailure = &vemFailure{status: status, reason: reason}
+}
+
+// Requests returns how many requests reached path, including injected failures
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// ValidatorIndex returns the index assigned to pubkey once its node request
+// is ready
+func (s *Server) ValidatorIndex(pubkey consensus.BLSPubkey) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.validators[pubkey]
+	if !ok {
+		return 0, false
+	}
+	return v.index, true
+}
+
+// RelaysSet returns the relay set pubkey's node uses once its node request
+// is ready
+func (s *Server) RelaysSet(pubkey consensus.BLSPubkey) (p2pclient.RelaysSet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.validators[pubkey]
+	if !ok {
+		return "", false
+	}
+	return v.relaysSet, true
+}
+
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		var status int
+		if f, ok := s.faults[r.URL.Path]; ok && f.times > 0 {
+			f.times--
+			status = f.status
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.Token {
+			writeError(w, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+/*
+   ---------- NODE REQUESTS ----------
+*/
+
+func (s *Server) handleCreateNodeRequest(w http.ResponseWriter, r *http.Request) {
+	var req p2pclient.CreateNodeRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if msg := validateNodeRequest(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The client checks options first, so only a stale list gets this far
+	if err := s.nodesOptions.Validate(req.NodesOptions); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, exists := s.nodeRequests[req.ID]; exists {
+		writeError(w, http.StatusConflict, "node request "+req.ID+" already exists")
+		return
+	}
+	nr := &nodeRequest{NodeRequest: p2pclient.NodeRequest{
+		ID:                        req.ID,
+		Type:                      req.Type,
+		Status:                    p2pclient.NodeRequestInit,
+		ValidatorsCount:           req.ValidatorsCount,
+		AmountPerValidator:        req.AmountPerValidator,
+		WithdrawalCredentialsType: req.WithdrawalCredentialsType,
+		WithdrawalAddress:         req.WithdrawalAddress,
+		EigenPodOwnerAddress:      req.EigenPodOwnerAddress,
+		ControllerAddress:         req.ControllerAddress,
+		FeeRecipientAddress:       req.FeeRecipientAddress,
+		NodesOptions:              req.NodesOptions,
+	}}
+	s.nodeRequests[req.ID] = nr
+	writeJSON(w, http.StatusOK, nr.NodeRequest)
+}
+
+func (s *Server) handleNodeRequestStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nr, ok := s.nodeRequests[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "node request not found")
+		return
+	}
+	nr.polls++
+	if nr.Status == p2pclient.NodeRequestInit || nr.Status == p2pclient.NodeRequestProcessing {
+		nr.Status = p2pclient.NodeRequestProcessing
+		if nr.polls >= s.steps {
+			s.provision(nr)
+		}
+	}
+
+	status := p2pclient.NodeRequestStatus{NodeRequest: nr.NodeRequest}
+	if nr.Status == p2pclient.NodeRequestReady {
+		amount, _ := strconv.ParseUint(nr.AmountPerValidator, 10, 64)
+		for _, v := range nr.validators {
+			status.DepositData = append(status.DepositData, v.key.Deposit(v.creds, amount, s.network))
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// provision generates the validators of nr and marks it ready. It must be
+// called with s.mu held.
+func (s *Server) provision(nr *nodeRequest) {
+	prefix := byte(0x01)
+	if nr.WithdrawalCredentialsType == "0x02" {
+		prefix = 0x02
+	}
+	var creds [32]byte
+	creds[0] = prefix
+	copy(creds[12:], common.HexToAddress(nr.WithdrawalAddress).Bytes())
+
+	// A restaking pod is managed by its owner, so the owner requests exits
+	exitSigner := common.HexToAddress(nr.WithdrawalAddress)
+	if nr.Type == p2pclient.NodeRequestTypeRestaking {
+		exitSigner = common.HexToAddress(nr.EigenPodOwnerAddress)
+	}
+
+	for range nr.ValidatorsCount {
+		v := &validator{
+			key:        NewBLSKey(),
+			index:      s.nextIndex,
+			creds:      creds,
+			exitSigner: exitSigner,
+			relaysSet:  nr.NodesOptions.RelaysSet,
+		}
+		s.nextIndex++
+		s.validators[v.key.Pubkey] = v
+		nr.validators = append(nr.validators, v)
+	}
+	nr.Status = p2pclient.NodeRequestReady
+}
+
+func validateNodeRequest(req p2pclient.CreateNodeRequestPayload) string {
+	switch {
+	case req.ID == "":
+		return "id is required"
+	case req.Type != p2pclient.NodeRequestTypeRegular && req.Type != p2pclient.NodeRequestTypeRestaking:
+		return "type must be REGULAR or RESTAKING"
+	case req.ValidatorsCount < 1:
+		return "validatorsCount must be at least 1"
+	case req.WithdrawalCredentialsType != "0x01" && req.WithdrawalCredentialsType != "0x02":
+		return "withdrawalCredentialsType must be 0x01 or 0x02"
+	case !common.IsHexAddress(req.WithdrawalAddress):
+		return "withdrawalAddress must be a hex address"
+	case !common.IsHexAddress(req.ControllerAddress):
+		return "controllerAddress must be a hex address"
+	case !common.IsHexAddress(req.FeeRecipientAddress):
+		return "feeRecipientAddress must be a hex address"
+	case req.Type == p2pclient.NodeRequestTypeRestaking && !common.IsHexAddress(req.EigenPodOwnerAddress):
+		return "eigenPodOwnerAddress is required for RESTAKING"
+	case req.Type == p2pclient.NodeRequestTypeRegular && req.EigenPodOwnerAddress != "":
+		return "eigenPodOwnerAddress is only allowed for RESTAKING"
+	}
+
+	amount, err := strconv.ParseUint(req.AmountPerValidator, 10, 64)
+	switch {
+	case err != nil:
+		return "amountPerValidator must be an integer amount of gwei"
+	case req.WithdrawalCredentialsType == "0x01" && amount != minDepositGwei:
+		return "amountPerValidator must be 32000000000 for 0x01 validators"
+	case amount < minDepositGwei || amount > maxEffectiveBalanceGwei:
+		return "amountPerValidator must be between 32 and 2048 ETH"
+	}
+	return ""
+}
+
+/*
+   ---------- NODES ----------
+*/
+
+func (s *Server) handleNodesOptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.nodesOptions)
+}
+
+func (s *Server) handleUpdateRelays(w http.ResponseWriter, r *http.Request) {
+	var req p2pclient.UpdateRelaysPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.RelaysSet != p2pclient.RelaysSetDefault {
+		if _, ok := s.nodesOptions.Relays(req.RelaysSet); !ok {
+			writeError(w, http.StatusBadRequest, "relaysSet "+string(req.RelaysSet)+" is not offered")
+			return
+		}
+	}
+	// Validate every pubkey before changing any node
+	var vals []*validator
+	for _, pk := range req.Pubkeys {
+		pubkey, err := consensus.ParseBLSPubkey(pk)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		v, ok := s.validators[pubkey]
+		if !ok {
+			writeError(w, http.StatusNotFound, "validator "+pk+" is not managed by P2P")
+			return
+		}
+		vals = append(vals, v)
+	}
+	for _, v := range vals {
+		v.relaysSet = req.RelaysSet
+	}
+	writeJSON(w, http.StatusOK, p2pclient.UpdateRelaysResult{Pubkeys: req.Pubkeys, RelaysSet: req.RelaysSet})
+}
+
+/*
+   ---------- VEM ----------
+*/
+
+func (s *Server) handleCreateVem(w http.ResponseWriter, r *http.Request) {
+	var p p2pclient.VemCreatePayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if p.ID == "" {
+		writeError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+	// The real service checks the signature or transaction the same way
+	if err := p.Verify(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req, _ := p2pclient.ParseVemRequest(p.VemRequest)
+	signer := common.HexToAddress(p.VemRequestSignedBy)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.vems[p.ID]; exists {
+		writeError(w, http.StatusConflict, "vem "+p.ID+" already exists")
+		return
+	}
+	v := &vem{VemStatus: p2pclient.VemStatus{ID: p.ID, Status: p2pclient.VemStatusPending}, recipient: req.ECDHClientPubkey}
+	for _, pk := range req.Pubkeys {
+		pubkey, _ := consensus.ParseBLSPubkey(pk)
+		val, ok := s.validators[pubkey]
+		if !ok {
+			writeError(w, http.StatusNotFound, "validator "+pk+" is not managed by P2P")
+			return
+		}
+		if val.exitSigner != signer {
+			writeError(w, http.StatusForbidden, "validator "+pk+" exits are not controlled by "+signer.Hex())
+			return
+		}
+		v.validators = append(v.validators, val)
+	}
+	v.failure, s.vemFailure = s.vemFailure, nil
+	s.vems[p.ID] = v
+	writeJSON(w, http.StatusOK, v.VemStatus)
+}
+
+func (s *Server) handleVemStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vems[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "vem not found")
+		return
+	}
+	v.polls++
+	if v.Status == p2pclient.VemStatusPending && v.polls >= s.steps {
+		result, err := s.vemResult(v)
+		switch {
+		case v.failure != nil:
+			v.Status = v.failure.status
+			v.ErrorMessage = v.failure.reason
+		case err != nil:
+			v.Status = p2pclient.VemStatusFault
+			v.ErrorMessage = err.Error()
+		default:
+			v.Status = p2pclient.VemStatusSuccess
+			v.VemResult = result
+		}
+	}
+	writeJSON(w, http.StatusOK, v.VemStatus)
+}
+
+// vemResult signs an exit for every validator in v and encrypts the JSON
+// array to the request's ECDH key. It must be called with s.mu held.
+func (s *Server) vemResult(v *vem) (string, error) {
+	exits := make([]consensus.SignedVoluntaryExit, len(v.validators))
+	for i, val := range v.validators {
+		exits[i] = s.signedExit(val.key, val.index)
+	}
+	plaintext, err := json.Marshal(exits)
+	if err != nil {
+		return "", err
+	}
+	recipient, err := vemcrypto.ParseECDHPublicKey(v.recipient)
+	if err != nil {
+		return "", err
+	}
+	return vemcrypto.EncryptVemResult(recipient, s.suite, plaintext, nil)
+}
+
+// SignedExit signs an exit for index with key at the server's epoch and
+// network
+func (s *Server) SignedExit(key BLSKey, index uint64) consensus.SignedVoluntaryExit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signedExit(key, index)
+}
+
+// signedExit must be called with s.mu held
+func (s *Server) signedExit(key BLSKey, index uint64) consensus.SignedVoluntaryExit {
+	return key.Exit(index, s.epoch, s.network)
+}
+
+/*
+   ---------- HELPERS ----------
+*/
+
+func writeJSON(w http.ResponseWriter, status int, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"result": result})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": p2pclient.APIError{
+		Code:    status,
+		Name:    strings.ReplaceAll(http.StatusText(status), " ", ""),
+		Message: msg,
+	}})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config controls how often and how long Until polls. Zero fields take the
+// defaults noted on each.
+type Config struct {
+	// Initial is the delay before the second attempt (default 2s)
+	Initial time.Duration
+	// Max caps the delay between attempts (default 1m)
+	Max time.Duration
+	// Multiplier grows the delay after each attempt (default 2)
+	Multiplier float64
+	// MaxAttempts stops polling after this many attempts; 0 means until the
+	// context is done
+	MaxAttempts int
+	// AttemptTimeout bounds each individual check (default 15s)
+	AttemptTimeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Initial <= 0 {
+		c.Initial = 2 * time.Second
+	}
+	if c.Max <= 0 {
+		c.Max = time.Minute
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	if c.AttemptTimeout <= 0 {
+		c.AttemptTimeout = 15 * time.Second
+	}
+	return c
+}
+
+// Progress describes one finished attempt
+type Progress[T any] struct {
+	Attempt int
+	// Value is what the check returned; the zero value when it failed
+	Value T
+	Err   error
+	// Next is the delay before the following attempt
+	Next time.Duration
+}
+
+// Check performs one attempt. It reports done once the value is final;
+// errors wrapped with Permanent stop polling, any other error is retried.
+type Check[T any] func(ctx context.Context) (value T, done bool, err error)
+
+// permanentError marks an error that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so Until returns it at once
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// ExhaustedError is returned when MaxAttempts pass without a final value
+type ExhaustedError struct {
+	Attempts int
+	// Last is the error of the final attempt, nil if it simply was not done
+	Last error
+}
+
+func (e *ExhaustedError) Error() string {
+	if e.Last != nil {
+		return fmt.Sprintf("poll: gave up after %d attempts: %v", e.Attempts, e.Last)
+	}
+	return fmt.Sprintf("poll: gave up after %d attempts", e.Attempts)
+}
+
+func (e *ExhaustedError) Unwrap() error { return e.Last }
+
+// Until runs check with exponential backoff until it is done, fails
+// permanently, MaxAttempts is reached or ctx is done. onProgress, if not
+// nil, is called after every attempt.
+func Until[T any](ctx context.Context, cfg Config, check Check[T], onProgress func(Progress[T])) (T, error) {
+	cfg = cfg.withDefaults()
+	delay := cfg.Initial
+
+	var zero T
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, cfg.AttemptTimeout)
+		value, done, err := check(attemptCtx)
+		cancel()
+
+		var permanent *permanentError
+		switch {
+		case err == nil && done:
+			report(onProgress, Progress[T]{Attempt: attempt, Value: value})
+			return value, nil
+		case errors.As(err, &permanent):
+			report(onProgress, Progress[T]{Attempt: attempt, Err: permanent.err})
+			return zero, permanent.err
+		case ctx.Err() != nil:
+			return zero, ctx.Err()
+		}
+
+		if cfg.MaxAttempts > 0 && attempt >= cfg.MaxAttempts {
+			report(onProgress, Progress[T]{Attempt: attempt, Value: value, Err: err})
+			return zero, &ExhaustedError{Attempts: attempt, Last: err}
+		}
+		report(onProgress, Progress[T]{Attempt: attempt, Value: value, Err: err, Next: delay})
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return zero, ctx.Err()
+		case <-t.C:
+		}
+		delay = min(time.Duration(float64(delay)*cfg.Multiplier), cfg.Max)
+	}
+}
+
+func report[T any](fn func(Progress[T]), p Progress[T]) {
+	if fn != nil {
+		fn(p)
+	}
+}
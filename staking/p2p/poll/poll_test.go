@@ -0,0 +1,69 @@
+package poll_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"p2p/poll"
+)
+
+var fast = poll.Config{Initial: time.Millisecond, Max: 4 * time.Millisecond}
+
+func TestUntilBacksOffUntilDone(t *testing.T) {
+	calls := 0
+	var delays []time.Duration
+	got, err := poll.Until(context.Background(), fast, func(context.Context) (int, bool, error) {
+		calls++
+		if calls == 2 {
+			return 0, false, errors.New("transient")
+		}
+		return calls, calls == 5, nil
+	}, func(p poll.Progress[int]) {
+		delays = append(delays, p.Next)
+	})
+	if err != nil || got != 5 {
+		t.Fatalf("expected 5, got %d: %v", got, err)
+	}
+	want := []time.Duration{1, 2, 4, 4, 0}
+	for i := range want {
+		if delays[i] != want[i]*time.Millisecond {
+			t.Fatalf("unexpected delays %v", delays)
+		}
+	}
+}
+
+func TestUntilStopsOnPermanentError(t *testing.T) {
+	sentinel := errors.New("gone")
+	calls := 0
+	_, err := poll.Until(context.Background(), fast, func(context.Context) (int, bool, error) {
+		calls++
+		return 0, false, poll.Permanent(sentinel)
+	}, nil)
+	if !errors.Is(err, sentinel) || calls != 1 {
+		t.Fatalf("expected one call returning the sentinel, got %d calls: %v", calls, err)
+	}
+}
+
+func TestUntilMaxAttemptsAndTimeouts(t *testing.T) {
+	cfg := fast
+	cfg.MaxAttempts = 3
+	cfg.AttemptTimeout = time.Millisecond
+	_, err := poll.Until(context.Background(), cfg, func(ctx context.Context) (int, bool, error) {
+		<-ctx.Done()
+		return 0, false, ctx.Err()
+	}, nil)
+	var exhausted *poll.ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected exhaustion after 3 timed out attempts, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := poll.Until(ctx, fast, func(context.Context) (int, bool, error) {
+		return 0, false, nil
+	}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context cancellation, got %v", err)
+	}
+}
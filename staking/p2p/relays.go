@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	p2pclient "p2p/client"
+	"strings"
+	"text/tabwriter"
+)
+
+// runRelays handles "relays list" and "relays update <set> <pubkey>..."
+func runRelays(ctx context.Context, out io.Writer, client *p2pclient.Client, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		return relaysList(ctx, out, client)
+	case len(args) >= 3 && args[0] == "update":
+		result, err := client.UpdateRelays(ctx, p2pclient.UpdateRelaysPayload{
+			RelaysSet: p2pclient.RelaysSet(args[1]),
+			Pubkeys:   args[2:],
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Moved %d validators to relays set %q\n", len(result.Pubkeys), result.RelaysSet)
+		return nil
+	default:
+		return errors.New("usage: relays list | relays update <set> <pubkey>...")
+	}
+}
+
+func relaysList(ctx context.Context, out io.Writer, client *p2pclient.Client) error {
+	opts, err := client.LoadNodesOptions(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.Fallback {
+		fmt.Fprintln(out, "P2P did not list its options; showing the built-in locations, relay sets are unknown")
+	}
+	fmt.Fprintln(out, "Locations:", opts.Locations)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELAYS SET\tRELAYS\tLOCATIONS")
+	for _, set := range opts.RelaysSets {
+		locations := "any"
+		if len(set.Locations) > 0 {
+			locations = fmt.Sprint(set.Locations)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", set.Name, strings.Join(set.Relays, ","), locations)
+	}
+	return tw.Flush()
+}
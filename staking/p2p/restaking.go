@@ -0,0 +1,45 @@
+package main
+
+import (
+	"consensus"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"p2p/eigenlayer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// restakingPod resolves the EigenPod of $EIGENPOD_OWNER through the
+// EigenPodManager on $ETH_RPC_URL. $EIGENPOD_MANAGER overrides the manager
+// address for networks without a known deployment.
+func restakingPod(ctx context.Context, network consensus.Network) (*eigenlayer.Pod, error) {
+	owner := os.Getenv("EIGENPOD_OWNER")
+	if !common.IsHexAddress(owner) {
+		return nil, fmt.Errorf("invalid EIGENPOD_OWNER %q", owner)
+	}
+	rpcURL := os.Getenv("ETH_RPC_URL")
+	if rpcURL == "" {
+		return nil, errors.New("restaking needs ETH_RPC_URL to look up the eigenpod")
+	}
+
+	managerAddr, err := eigenlayer.ManagerAddress(network)
+	if override := os.Getenv("EIGENPOD_MANAGER"); override != "" {
+		if !common.IsHexAddress(override) {
+			return nil, fmt.Errorf("invalid EIGENPOD_MANAGER %q", override)
+		}
+		managerAddr, err = common.HexToAddress(override), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	eth, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer eth.Close()
+	return eigenlayer.NewEigenPodManager(managerAddr, eth).ResolvePod(ctx, common.HexToAddress(owner))
+}
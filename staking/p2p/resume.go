@@ -0,0 +1,127 @@
+package main
+
+import (
+	"consensus"
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	p2pclient "p2p/client"
+	"p2p/escrow"
+	"p2p/poll"
+	"p2p/vemcrypto"
+	"p2p/vemflow"
+	"strings"
+
+	"secretmanager/keys"
+	"secretmanager/secrets"
+)
+
+// openSealer returns the secret that seals ECDH keys and escrowed exits:
+// $P2P_KEY_PASSPHRASE, or a base64 32-byte key read from the Secret Manager
+// resource in $P2P_KEY_SECRET (projects/<p>/secrets/<s>[/versions/<v>])
+func openSealer() (vemcrypto.Sealer, error) {
+	switch name := os.Getenv("P2P_KEY_SECRET"); {
+	case name != "":
+		return secretSealer(name)
+	case os.Getenv("P2P_KEY_PASSPHRASE") != "":
+		return vemcrypto.PassphraseSealer(os.Getenv("P2P_KEY_PASSPHRASE"))
+	default:
+		return vemcrypto.Sealer{}, errors.New("set P2P_KEY_PASSPHRASE or P2P_KEY_SECRET to seal VEM keys")
+	}
+}
+
+// openKeyStore opens the sealed ECDH key directory ($P2P_KEY_DIR, default
+// ./vem-keys)
+func openKeyStore(sealer vemcrypto.Sealer) (*vemcrypto.KeyStore, error) {
+	dir := os.Getenv("P2P_KEY_DIR")
+	if dir == "" {
+		dir = "vem-keys"
+	}
+	return vemcrypto.NewKeyStore(dir, sealer)
+}
+
+// openEscrow opens the exit escrow ($P2P_ESCROW_DIR, default ./exit-escrow)
+func openEscrow(sealer vemcrypto.Sealer, network consensus.Network) (*escrow.Escrow, error) {
+	dir := os.Getenv("P2P_ESCROW_DIR")
+	if dir == "" {
+		dir = "exit-escrow"
+	}
+	return escrow.Open(dir, sealer, network)
+}
+
+func secretSealer(name string) (vemcrypto.Sealer, error) {
+	project, secret, version, err := keys.ParseSecretName(name)
+	if err != nil {
+		return vemcrypto.Sealer{}, err
+	}
+	value, err := secrets.GetSecret(project, secret, version)
+	if err != nil {
+		return vemcrypto.Sealer{}, fmt.Errorf("failed to load VEM sealing key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return vemcrypto.Sealer{}, fmt.Errorf("VEM sealing key must be base64: %w", err)
+	}
+	return vemcrypto.KeySealer(key)
+}
+
+// resume reloads the ECDH key stored for vemID and waits for its result
+func resume(
+	ctx context.Context,
+	out io.Writer,
+	client *p2pclient.Client,
+	keys *vemcrypto.KeyStore,
+	exits *escrow.Escrow,
+	cfg poll.Config,
+	suite vemcrypto.Suite,
+	vemID string,
+) error {
+	priv, err := keys.Load(vemID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Resuming VEM request", vemID)
+	return awaitSignedExit(ctx, out, client, keys, exits, priv, cfg, suite, vemID)
+}
+
+// awaitSignedExit polls vemID until P2P returns its result, decrypts the
+// signed validator exits and moves them into the escrow, then deletes the
+// request's key. The exits are never printed; "escrow release" submits one.
+func awaitSignedExit(
+	ctx context.Context,
+	out io.Writer,
+	client *p2pclient.Client,
+	keys *vemcrypto.KeyStore,
+	exits *escrow.Escrow,
+	priv *ecdh.PrivateKey,
+	cfg poll.Config,
+	suite vemcrypto.Suite,
+	vemID string,
+) error {
+	status, err := vemflow.PollVemStatus(ctx, client, vemID, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	signedExitMessage, err := vemcrypto.DecryptVemResult(priv, status.VemResult, suite)
+	if err != nil {
+		return err
+	}
+
+	entries, err := exits.Import(vemID, signedExitMessage)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(out, "Escrowed exit for validator %d (%s) at epoch %d\n", entry.ValidatorIndex, entry.Pubkey, entry.Epoch)
+	}
+	// The escrow holds the exits now, so the key has nothing left to open
+	if err := keys.Delete(vemID); err != nil {
+		return fmt.Errorf("exits escrowed but VEM key not deleted: %w", err)
+	}
+	return nil
+}
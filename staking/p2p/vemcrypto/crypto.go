@@ -4,13 +4,39 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 )
 
+// Suite identifies how a VEM result is encrypted. Every suite uses an
+// ephemeral P-256 ECDH key and AES-256-GCM; they differ in key derivation.
+type Suite string
+
+const (
+	// SuiteP256SHA256AESGCM derives the AES key as SHA-256 of the shared
+	// secret and takes no associated data. It is what P2P sends today and is
+	// assumed when a result names no suite.
+	SuiteP256SHA256AESGCM Suite = "p256-sha256-aes256gcm"
+	// SuiteP256HKDFSHA256AESGCM derives the AES key with HKDF-SHA256, salted
+	// with both public keys, and authenticates associated data
+	SuiteP256HKDFSHA256AESGCM Suite = "p256-hkdf-sha256-aes256gcm"
+)
+
+// ErrDecrypt is returned when a result fails authentication: the wrong key,
+// the wrong associated data, or a tampered ciphertext
+var ErrDecrypt = errors.New("vemcrypto: vem result failed authentication")
+
+// ErrSuiteMismatch is returned when a result is not in the suite the caller
+// required, e.g. a legacy envelope where AAD was expected
+var ErrSuiteMismatch = errors.New("vemcrypto: vem result is in the wrong suite")
+
 // GenerateECDHKeypair generates a P-256 ECDH keypair
 func GenerateECDHKeypair() (*ecdh.PrivateKey, string, error) {
 	curve := ecdh.P256()
@@ -29,45 +55,195 @@ func GenerateECDHKeypair() (*ecdh.PrivateKey, string, error) {
 	return priv, pubBase64, nil
 }
 
+// ParseECDHPublicKey decodes a base64 PKIX P-256 key as sent in
+// ecdh_client_pubkey
+func ParseECDHPublicKey(pubBase64 string) (*ecdh.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(pubBase64)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: public key is not base64: %w", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: public key is not PKIX: %w", err)
+	}
+	ec, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("vemcrypto: public key is %T, not an EC key", pub)
+	}
+	key, err := ec.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: public key: %w", err)
+	}
+	if key.Curve() != ecdh.P256() {
+		return nil, errors.New("vemcrypto: public key must be on P-256")
+	}
+	return key, nil
+}
+
 type EncryptedVemResult struct {
+	// Suite is empty in results from before suites were named
+	Suite           Suite  `json:"suite,omitempty"`
 	EphemeralPubKey string `json:"ephemeralPubKey"`
 	Nonce           string `json:"nonce"`
 	Ciphertext      string `json:"ciphertext"`
 }
 
-// DecryptVemResult decrypts the ECIES payload
+// EncryptVemResult encrypts plaintext to recipient with suite and returns the
+// base64 JSON envelope P2P places in vemResult. aad must be nil for
+// SuiteP256SHA256AESGCM.
+func EncryptVemResult(recipient *ecdh.PublicKey, suite Suite, plaintext, aad []byte) (string, error) {
+	if recipient.Curve() != ecdh.P256() {
+		return "", errors.New("vemcrypto: recipient key must be on P-256")
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", fmt.Errorf("vemcrypto: ecdh: %w", err)
+	}
+	gcm, err := newGCM(suite, shared, ephemeral.PublicKey(), recipient, aad)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	enc := EncryptedVemResult{
+		EphemeralPubKey: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:           base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:      base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, aad)),
+	}
+	// Results in the original suite stay byte-compatible with what P2P sends
+	if suite != SuiteP256SHA256AESGCM {
+		enc.Suite = suite
+	}
+	raw, err := json.Marshal(enc)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// DecryptVemResult decrypts a result that carries no associated data. A
+// non-empty want rejects a result in any other suite.
 func DecryptVemResult(
 	priv *ecdh.PrivateKey,
 	encryptedBase64 string,
+	want Suite,
+) ([]byte, error) {
+	return DecryptVemResultWithAAD(priv, encryptedBase64, nil, want)
+}
+
+// DecryptVemResultWithAAD decrypts a result, checking aad when the suite
+// authenticates it. The envelope names its suite, so an empty want accepts
+// any known suite; pass one to stop a server downgrading the result.
+func DecryptVemResultWithAAD(
+	priv *ecdh.PrivateKey,
+	encryptedBase64 string,
+	aad []byte,
+	want Suite,
 ) ([]byte, error) {
 	raw, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("vemcrypto: vem result is not base64: %w", err)
 	}
 
 	var enc EncryptedVemResult
 	if err := json.Unmarshal(raw, &enc); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("vemcrypto: vem result is not a JSON envelope: %w", err)
+	}
+	suite := enc.Suite
+	if suite == "" {
+		suite = SuiteP256SHA256AESGCM
+	}
+	if want != "" && suite != want {
+		return nil, fmt.Errorf("%w: want %s, got %s", ErrSuiteMismatch, want, suite)
 	}
 
-	ephemeralPubBytes, _ := base64.StdEncoding.DecodeString(enc.EphemeralPubKey)
-	nonce, _ := base64.StdEncoding.DecodeString(enc.Nonce)
-	ciphertext, _ := base64.StdEncoding.DecodeString(enc.Ciphertext)
-
-	ephemeralPub, err := ecdh.P256().NewPublicKey(ephemeralPubBytes)
+	ephemeralPubBytes, err := decodeField("ephemeralPubKey", enc.EphemeralPubKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := decodeField("nonce", enc.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := decodeField("ciphertext", enc.Ciphertext)
 	if err != nil {
 		return nil, err
 	}
 
+	ephemeralPub, err := ecdh.P256().NewPublicKey(ephemeralPubBytes)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: ephemeralPubKey is not an uncompressed P-256 point: %w", err)
+	}
 	sharedSecret, err := priv.ECDH(ephemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: ecdh: %w", err)
+	}
+
+	gcm, err := newGCM(suite, sharedSecret, ephemeralPub, priv.PublicKey(), aad)
 	if err != nil {
 		return nil, err
 	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("vemcrypto: nonce must be %d bytes, got %d", gcm.NonceSize(), len(nonce))
+	}
+	if len(ciphertext) < gcm.Overhead() {
+		return nil, fmt.Errorf("vemcrypto: ciphertext is %d bytes, shorter than the %d byte tag", len(ciphertext), gcm.Overhead())
+	}
 
-	key := sha256.Sum256(sharedSecret)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
 
-	block, _ := aes.NewCipher(key[:])
-	gcm, _ := cipher.NewGCM(block)
+// newGCM derives the AES-256-GCM key for suite
+func newGCM(suite Suite, shared []byte, ephemeral, recipient *ecdh.PublicKey, aad []byte) (cipher.AEAD, error) {
+	var key []byte
+	switch suite {
+	case SuiteP256SHA256AESGCM:
+		if len(aad) != 0 {
+			return nil, fmt.Errorf("vemcrypto: suite %s does not support associated data", suite)
+		}
+		sum := sha256.Sum256(shared)
+		key = sum[:]
+	case SuiteP256HKDFSHA256AESGCM:
+		salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+		var err error
+		key, err = hkdf.Key(sha256.New, shared, salt, string(suite), 32)
+		if err != nil {
+			return nil, fmt.Errorf("vemcrypto: hkdf: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("vemcrypto: unknown suite %q", suite)
+	}
 
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: aes: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+func decodeField(name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("vemcrypto: vem result has no %s", name)
+	}
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("vemcrypto: %s is not base64: %w", name, err)
+	}
+	return b, nil
 }
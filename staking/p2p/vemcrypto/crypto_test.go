@@ -0,0 +1,126 @@
+package vemcrypto_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"p2p/vemcrypto"
+)
+
+func TestVemResultRoundTrip(t *testing.T) {
+	priv, pubBase64, err := vemcrypto.GenerateECDHKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := vemcrypto.ParseECDHPublicKey(pubBase64)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	plaintext := []byte(`{"message":{"epoch":"1","validator_index":"2"}}`)
+
+	for _, tc := range []struct {
+		suite vemcrypto.Suite
+		aad   []byte
+	}{
+		{vemcrypto.SuiteP256SHA256AESGCM, nil},
+		{vemcrypto.SuiteP256HKDFSHA256AESGCM, nil},
+		{vemcrypto.SuiteP256HKDFSHA256AESGCM, []byte("vem-1")},
+	} {
+		enc, err := vemcrypto.EncryptVemResult(pub, tc.suite, plaintext, tc.aad)
+		if err != nil {
+			t.Fatalf("%s: encrypt: %v", tc.suite, err)
+		}
+		got, err := vemcrypto.DecryptVemResultWithAAD(priv, enc, tc.aad, tc.suite)
+		if err != nil {
+			t.Fatalf("%s: decrypt: %v", tc.suite, err)
+		}
+		if string(got) != string(plaintext) {
+			t.Fatalf("%s: round trip mismatch: %s", tc.suite, got)
+		}
+	}
+}
+
+func TestVemResultAssociatedData(t *testing.T) {
+	priv, pubBase64, _ := vemcrypto.GenerateECDHKeypair()
+	pub, _ := vemcrypto.ParseECDHPublicKey(pubBase64)
+
+	enc, err := vemcrypto.EncryptVemResult(pub, vemcrypto.SuiteP256HKDFSHA256AESGCM, []byte("exit"), []byte("vem-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vemcrypto.DecryptVemResultWithAAD(priv, enc, []byte("vem-2"), ""); !errors.Is(err, vemcrypto.ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for the wrong associated data, got %v", err)
+	}
+	if _, err := vemcrypto.EncryptVemResult(pub, vemcrypto.SuiteP256SHA256AESGCM, []byte("exit"), []byte("vem-1")); err == nil {
+		t.Fatalf("expected the legacy suite to refuse associated data")
+	}
+
+	other, _, _ := vemcrypto.GenerateECDHKeypair()
+	if _, err := vemcrypto.DecryptVemResultWithAAD(other, enc, []byte("vem-1"), ""); !errors.Is(err, vemcrypto.ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for the wrong key, got %v", err)
+	}
+}
+
+func TestDecryptVemResultRequiresSuite(t *testing.T) {
+	priv, pubBase64, _ := vemcrypto.GenerateECDHKeypair()
+	pub, _ := vemcrypto.ParseECDHPublicKey(pubBase64)
+
+	// A server that answers in the legacy suite is refused by a caller that
+	// asked for HKDF, even though the envelope itself is valid
+	legacy, _ := vemcrypto.EncryptVemResult(pub, vemcrypto.SuiteP256SHA256AESGCM, []byte("exit"), nil)
+	if _, err := vemcrypto.DecryptVemResult(priv, legacy, vemcrypto.SuiteP256HKDFSHA256AESGCM); !errors.Is(err, vemcrypto.ErrSuiteMismatch) {
+		t.Fatalf("expected ErrSuiteMismatch for a downgraded result, got %v", err)
+	}
+	if _, err := vemcrypto.DecryptVemResult(priv, legacy, ""); err != nil {
+		t.Fatalf("no required suite should accept the legacy result: %v", err)
+	}
+
+	hkdf, _ := vemcrypto.EncryptVemResult(pub, vemcrypto.SuiteP256HKDFSHA256AESGCM, []byte("exit"), nil)
+	if _, err := vemcrypto.DecryptVemResult(priv, hkdf, vemcrypto.SuiteP256SHA256AESGCM); !errors.Is(err, vemcrypto.ErrSuiteMismatch) {
+		t.Fatalf("expected ErrSuiteMismatch for the wrong suite, got %v", err)
+	}
+}
+
+func TestDecryptVemResultMalformed(t *testing.T) {
+	priv, pubBase64, _ := vemcrypto.GenerateECDHKeypair()
+	pub, _ := vemcrypto.ParseECDHPublicKey(pubBase64)
+	valid, _ := vemcrypto.EncryptVemResult(pub, vemcrypto.SuiteP256SHA256AESGCM, []byte("exit"), nil)
+
+	var good vemcrypto.EncryptedVemResult
+	raw, _ := base64.StdEncoding.DecodeString(valid)
+	json.Unmarshal(raw, &good)
+
+	envelope := func(mutate func(e *vemcrypto.EncryptedVemResult)) string {
+		e := good
+		mutate(&e)
+		b, _ := json.Marshal(e)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	for _, tc := range []struct {
+		name, input, want string
+	}{
+		{"outer base64", "not base64!", "not base64"},
+		{"json", base64.StdEncoding.EncodeToString([]byte("[")), "not a JSON envelope"},
+		{"suite", envelope(func(e *vemcrypto.EncryptedVemResult) { e.Suite = "rot13" }), "unknown suite"},
+		{"missing key", envelope(func(e *vemcrypto.EncryptedVemResult) { e.EphemeralPubKey = "" }), "no ephemeralPubKey"},
+		{"key base64", envelope(func(e *vemcrypto.EncryptedVemResult) { e.EphemeralPubKey = "%%" }), "ephemeralPubKey is not base64"},
+		{"key point", envelope(func(e *vemcrypto.EncryptedVemResult) { e.EphemeralPubKey = "AAAA" }), "not an uncompressed P-256 point"},
+		{"nonce base64", envelope(func(e *vemcrypto.EncryptedVemResult) { e.Nonce = "%%" }), "nonce is not base64"},
+		{"nonce length", envelope(func(e *vemcrypto.EncryptedVemResult) { e.Nonce = "AAAA" }), "nonce must be 12 bytes"},
+		{"ciphertext base64", envelope(func(e *vemcrypto.EncryptedVemResult) { e.Ciphertext = "%%" }), "ciphertext is not base64"},
+		{"ciphertext length", envelope(func(e *vemcrypto.EncryptedVemResult) { e.Ciphertext = "AAAA" }), "shorter than the 16 byte tag"},
+	} {
+		_, err := vemcrypto.DecryptVemResult(priv, tc.input, "")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	if _, err := vemcrypto.DecryptVemResult(priv, valid, ""); err != nil {
+		t.Fatalf("valid result should still decrypt: %v", err)
+	}
+}
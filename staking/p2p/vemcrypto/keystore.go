@@ -0,0 +1,249 @@
+package vemcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"p2p/internal/atomicfile"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfScrypt = "scrypt"
+	kdfRaw    = "raw"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrKeyNotFound is returned when no key is stored for a VEM request ID
+var ErrKeyNotFound = errors.New("vemcrypto: no ECDH key stored for this vem request")
+
+// Sealer holds the secret that encrypts ECDH private keys at rest: either a
+// passphrase stretched with scrypt, or a 32-byte key such as one kept in
+// Secret Manager
+type Sealer struct {
+	kdf    string
+	secret []byte
+}
+
+// PassphraseSealer derives a per-file key from passphrase with scrypt
+func PassphraseSealer(passphrase string) (Sealer, error) {
+	if passphrase == "" {
+		return Sealer{}, errors.New("vemcrypto: empty passphrase")
+	}
+	return Sealer{kdf: kdfScrypt, secret: []byte(passphrase)}, nil
+}
+
+// KeySealer uses a 32-byte AES-256 key directly
+func KeySealer(key []byte) (Sealer, error) {
+	if len(key) != 32 {
+		return Sealer{}, fmt.Errorf("vemcrypto: sealing key must be 32 bytes, got %d", len(key))
+	}
+	return Sealer{kdf: kdfRaw, secret: key}, nil
+}
+
+func (s Sealer) key(salt []byte) ([]byte, error) {
+	switch s.kdf {
+	case kdfScrypt:
+		return scrypt.Key(s.secret, salt, scryptN, scryptR, scryptP, 32)
+	case kdfRaw:
+		return s.secret, nil
+	default:
+		return nil, errors.New("vemcrypto: sealer is not initialised")
+	}
+}
+
+// ErrUnseal is returned when sealed data does not open: the wrong passphrase
+// or key, or data that was tampered with
+var ErrUnseal = errors.New("vemcrypto: cannot unseal: wrong passphrase or key, or the data was tampered with")
+
+// SealedBox is data encrypted at rest by a Sealer
+type SealedBox struct {
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Seal encrypts plaintext with AES-256-GCM, authenticating aad. Passphrase
+// sealers draw a fresh scrypt salt for every box.
+func (s Sealer) Seal(plaintext, aad []byte) (SealedBox, error) {
+	box := SealedBox{KDF: s.kdf}
+	if box.KDF == kdfScrypt {
+		box.Salt = make([]byte, 16)
+		if _, err := rand.Read(box.Salt); err != nil {
+			return box, err
+		}
+	}
+	gcm, err := s.gcm(box.Salt)
+	if err != nil {
+		return box, err
+	}
+	box.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(box.Nonce); err != nil {
+		return box, err
+	}
+	box.Ciphertext = gcm.Seal(nil, box.Nonce, plaintext, aad)
+	return box, nil
+}
+
+// Open decrypts a box sealed with the same secret and aad
+func (s Sealer) Open(box SealedBox, aad []byte) ([]byte, error) {
+	if box.KDF != s.kdf {
+		return nil, fmt.Errorf("vemcrypto: data was sealed with %s, not %s", box.KDF, s.kdf)
+	}
+	gcm, err := s.gcm(box.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(box.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("vemcrypto: sealed nonce must be %d bytes", gcm.NonceSize())
+	}
+	plaintext, err := gcm.Open(nil, box.Nonce, box.Ciphertext, aad)
+	if err != nil {
+		return nil, ErrUnseal
+	}
+	return plaintext, nil
+}
+
+func (s Sealer) gcm(salt []byte) (cipher.AEAD, error) {
+	key, err := s.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealedKey is the on-disk form of one ECDH private key
+type sealedKey struct {
+	Version int    `json:"version"`
+	VemID   string `json:"vemId"`
+	SealedBox
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// KeyStore keeps VEM ECDH private keys sealed on disk, one file per VEM
+// request ID, so a result can still be decrypted after a restart
+type KeyStore struct {
+	dir    string
+	sealer Sealer
+}
+
+// NewKeyStore opens or creates the key directory
+func NewKeyStore(dir string, sealer Sealer) (*KeyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &KeyStore{dir: dir, sealer: sealer}, nil
+}
+
+// Save seals priv under vemID. The VEM ID is bound in as associated data so
+// a key file renamed to another ID will not open.
+func (s *KeyStore) Save(vemID string, priv *ecdh.PrivateKey) error {
+	path, err := s.path(vemID)
+	if err != nil {
+		return err
+	}
+	if priv.Curve() != ecdh.P256() {
+		return errors.New("vemcrypto: only P-256 keys can be stored")
+	}
+
+	box, err := s.sealer.Seal(priv.Bytes(), []byte(vemID))
+	if err != nil {
+		return err
+	}
+	sk := sealedKey{Version: 1, VemID: vemID, SealedBox: box, CreatedAt: time.Now().UTC()}
+
+	data, err := json.MarshalIndent(sk, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data)
+}
+
+// Load opens the key stored for vemID
+func (s *KeyStore) Load(vemID string) (*ecdh.PrivateKey, error) {
+	path, err := s.path(vemID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, vemID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sk sealedKey
+	if err := json.Unmarshal(data, &sk); err != nil {
+		return nil, fmt.Errorf("vemcrypto: corrupt key file %s: %w", path, err)
+	}
+	if sk.Version != 1 {
+		return nil, fmt.Errorf("vemcrypto: unsupported key file version %d", sk.Version)
+	}
+	if sk.KDF != s.sealer.kdf {
+		return nil, fmt.Errorf("vemcrypto: key for %s was sealed with %s, not %s", vemID, sk.KDF, s.sealer.kdf)
+	}
+	raw, err := s.sealer.Open(sk.SealedBox, []byte(vemID))
+	if errors.Is(err, ErrUnseal) {
+		return nil, fmt.Errorf("vemcrypto: cannot unseal key for %s: wrong passphrase or key, or the file was tampered with", vemID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.P256().NewPrivateKey(raw)
+}
+
+// Delete removes the key for vemID once its result is safely stored
+func (s *KeyStore) Delete(vemID string) error {
+	path, err := s.path(vemID)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, vemID)
+	}
+	return err
+}
+
+// List returns the VEM request IDs that have a stored key
+func (s *KeyStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".key.json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *KeyStore) path(vemID string) (string, error) {
+	if vemID == "" || strings.ContainsAny(vemID, `/\`) || vemID == "." || vemID == ".." {
+		return "", fmt.Errorf("vemcrypto: invalid vem request ID %q", vemID)
+	}
+	return filepath.Join(s.dir, vemID+".key.json"), nil
+}
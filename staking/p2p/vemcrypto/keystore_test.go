@@ -0,0 +1,96 @@
+package vemcrypto_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"p2p/vemcrypto"
+)
+
+func TestKeyStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	sealer, err := vemcrypto.PassphraseSealer("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := vemcrypto.NewKeyStore(dir, sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, _, err := vemcrypto.GenerateECDHKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("vem-1", priv); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// A fresh store over the same directory, as after a restart
+	reopened, _ := vemcrypto.NewKeyStore(dir, sealer)
+	loaded, err := reopened.Load("vem-1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !bytes.Equal(loaded.Bytes(), priv.Bytes()) {
+		t.Fatalf("loaded key differs from saved key")
+	}
+
+	ids, err := reopened.List()
+	if err != nil || len(ids) != 1 || ids[0] != "vem-1" {
+		t.Fatalf("unexpected list %v: %v", ids, err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "vem-1.key.json"))
+	if bytes.Contains(data, priv.Bytes()) {
+		t.Fatalf("private key stored in the clear")
+	}
+}
+
+func TestKeyStoreRejectsWrongSecretAndSwappedFiles(t *testing.T) {
+	dir := t.TempDir()
+	sealer, _ := vemcrypto.PassphraseSealer("correct horse")
+	store, _ := vemcrypto.NewKeyStore(dir, sealer)
+	priv, _, _ := vemcrypto.GenerateECDHKeypair()
+	if err := store.Save("vem-1", priv); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong, _ := vemcrypto.PassphraseSealer("battery staple")
+	wrongStore, _ := vemcrypto.NewKeyStore(dir, wrong)
+	if _, err := wrongStore.Load("vem-1"); err == nil {
+		t.Fatalf("expected the wrong passphrase to fail")
+	}
+
+	os.Rename(filepath.Join(dir, "vem-1.key.json"), filepath.Join(dir, "vem-2.key.json"))
+	if _, err := store.Load("vem-2"); err == nil {
+		t.Fatalf("expected a key file renamed to another VEM ID to fail")
+	}
+	if _, err := store.Load("vem-1"); !errors.Is(err, vemcrypto.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if err := store.Save("../escape", priv); err == nil {
+		t.Fatalf("expected a path-like VEM ID to be rejected")
+	}
+}
+
+func TestKeySealer(t *testing.T) {
+	if _, err := vemcrypto.KeySealer([]byte("short")); err == nil {
+		t.Fatalf("expected a short key to be rejected")
+	}
+	sealer, err := vemcrypto.KeySealer(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := vemcrypto.NewKeyStore(t.TempDir(), sealer)
+	priv, _, _ := vemcrypto.GenerateECDHKeypair()
+	if err := store.Save("vem-1", priv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("vem-1"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package vemflow
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/poll"
+	"p2p/vemcrypto"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// DefaultChunkSize is how many validators go into one VEM request unless
+// BatchConfig says otherwise. It keeps each request well inside the API's
+// body limits; lower it if P2P rejects a chunk as too large.
+const DefaultChunkSize = 100
+
+// Authorizer turns a VEM request into a create payload signed by the
+// withdrawal address
+type Authorizer func(ctx context.Context, id string, request *p2pclient.VemRequest) (p2pclient.VemCreatePayload, error)
+
+// OffChainAuthorizer signs requests with an EIP-191 signature from key
+func OffChainAuthorizer(key *ecdsa.PrivateKey) Authorizer {
+	signedBy := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	return func(_ context.Context, id string, request *p2pclient.VemRequest) (p2pclient.VemCreatePayload, error) {
+		canonical, err := request.Canonical()
+		if err != nil {
+			return p2pclient.VemCreatePayload{}, err
+		}
+		signature, err := p2pclient.SignVemRequest(canonical, key)
+		if err != nil {
+			return p2pclient.VemCreatePayload{}, err
+		}
+		return p2pclient.NewOffChainVemPayload(id, request, signature, signedBy)
+	}
+}
+
+// OnChainAuthorizer sends each request as a transaction from the withdrawal
+// address and waits for it to be mined
+func OnChainAuthorizer(backend ChainBackend, sign TxSigner, from common.Address) Authorizer {
+	return func(ctx context.Context, id string, request *p2pclient.VemRequest) (p2pclient.VemCreatePayload, error) {
+		return SubmitOnChainVem(ctx, backend, sign, from, id, request)
+	}
+}
+
+// BatchConfig controls RunBatch. Zero fields take the defaults noted on each.
+type BatchConfig struct {
+	// Network is the chain the exits must verify for
+	Network consensus.Network
+	// ChunkSize caps the validators per VEM request (default DefaultChunkSize)
+	ChunkSize int
+	// SharedKey encrypts every chunk's result to one ECDH key instead of a
+	// fresh key per chunk
+	SharedKey bool
+	// Suite, when set, rejects results encrypted in any other suite
+	Suite vemcrypto.Suite
+	// Concurrency caps how many chunks are polled at once (default 4)
+	Concurrency int
+	Poll        poll.Config
+	// Keys, when set, stores each chunk's ECDH key under its VEM ID before the
+	// request is sent, so a chunk can be resumed after a crash. Once Import
+	// has taken a chunk's exits, its key is deleted.
+	Keys *vemcrypto.KeyStore
+	// NewID names each chunk's VEM request (default a random UUID)
+	NewID func(chunk int) string
+	// BeforeCreate is called with each signed payload just before it is sent;
+	// an error skips the chunk
+	BeforeCreate func(payload p2pclient.VemCreatePayload, pubkeys []consensus.BLSPubkey) error
+	// Import, when set, checks each decrypted chunk in place of RunBatch and
+	// returns the exit each validator signed, so a result that is escrowed
+	// is only verified once. An error fails the whole chunk.
+	Import func(vemID string, plaintext []byte) (map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, error)
+}
+
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	if c.NewID == nil {
+		c.NewID = func(int) string { return uuid.NewString() }
+	}
+	return c
+}
+
+// ChunkResult is the outcome of one VEM request in a batch
+type ChunkResult struct {
+	VemID   string
+	Pubkeys []consensus.BLSPubkey
+	// Plaintext is the decrypted result, for callers that escrow it
+	Plaintext []byte
+	// Err is set when the chunk as a whole failed, or when its result held
+	// exits for validators it did not ask for
+	Err error
+}
+
+// ValidatorResult is the exit, or the failure, for one validator
+type ValidatorResult struct {
+	VemID string
+	Exit  *consensus.SignedVoluntaryExit
+	Err   error
+}
+
+// BatchResult merges every chunk of a batch
+type BatchResult struct {
+	Chunks     []ChunkResult
+	Validators map[consensus.BLSPubkey]*ValidatorResult
+}
+
+// Failed returns the validators that have no exit, ordered by pubkey
+func (r *BatchResult) Failed() []consensus.BLSPubkey {
+	var failed []consensus.BLSPubkey
+	for pk, v := range r.Validators {
+		if v.Err != nil {
+			failed = append(failed, pk)
+		}
+	}
+	sort.Slice(failed, func(a, b int) bool { return failed[a].String() < failed[b].String() })
+	return failed
+}
+
+// Err returns a *BatchError if any validator has no exit
+func (r *BatchResult) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make(map[consensus.BLSPubkey]error, len(failed))
+	for _, pk := range failed {
+		errs[pk] = r.Validators[pk].Err
+	}
+	return &BatchError{Total: len(r.Validators), Failed: errs}
+}
+
+// BatchError reports the validators a batch could not exit
+type BatchError struct {
+	Total  int
+	Failed map[consensus.BLSPubkey]error
+}
+
+func (e *BatchError) Error() string {
+	lines := make([]string, 0, len(e.Failed))
+	for pk, err := range e.Failed {
+		lines = append(lines, fmt.Sprintf("  %s: %v", pk, err))
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("%d of %d validators have no exit:\n%s", len(e.Failed), e.Total, strings.Join(lines, "\n"))
+}
+
+// Unwrap exposes the per-validator errors to errors.Is and errors.As
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// RunBatch exits pubkeys through one VEM request per chunk. Chunks are
+// authorised and created in order, since on-chain authorisation needs
+// sequential nonces, and each is polled concurrently as soon as it exists.
+// Every decrypted exit is verified and assigned to the validator that
+// signed it. A failed chunk does not stop the others; check Err on the
+// result.
+func RunBatch(
+	ctx context.Context,
+	client *p2pclient.Client,
+	pubkeys []string,
+	authorize Authorizer,
+	cfg BatchConfig,
+) (*BatchResult, error) {
+	cfg = cfg.withDefaults()
+	if cfg.Network.Name == "" {
+		return nil, errors.New("vemflow: batch needs a network to verify exits")
+	}
+	parsed, err := parsePubkeys(pubkeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared *ecdh.PrivateKey
+	var sharedPub string
+	if cfg.SharedKey {
+		if shared, sharedPub, err = vemcrypto.GenerateECDHKeypair(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BatchResult{Validators: make(map[consensus.BLSPubkey]*ValidatorResult, len(parsed))}
+	for start := 0; start < len(parsed); start += cfg.ChunkSize {
+		chunk := parsed[start:min(start+cfg.ChunkSize, len(parsed))]
+		result.Chunks = append(result.Chunks, ChunkResult{VemID: cfg.NewID(len(result.Chunks)), Pubkeys: chunk})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Concurrency)
+	for i := range result.Chunks {
+		chunk := &result.Chunks[i]
+		priv, pubBase64 := shared, sharedPub
+		if priv == nil {
+			if priv, pubBase64, err = vemcrypto.GenerateECDHKeypair(); err != nil {
+				chunk.Err = err
+				continue
+			}
+		}
+		if chunk.Err = createChunk(ctx, client, authorize, cfg, chunk, priv, pubBase64); chunk.Err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				chunk.Err = ctx.Err()
+				return
+			}
+			chunk.Plaintext, chunk.Err = awaitChunk(ctx, client, cfg, chunk.VemID, priv)
+		}()
+	}
+	wg.Wait()
+
+	for i := range result.Chunks {
+		mergeChunk(result, &result.Chunks[i], cfg)
+	}
+	return result, nil
+}
+
+func createChunk(
+	ctx context.Context,
+	client *p2pclient.Client,
+	authorize Authorizer,
+	cfg BatchConfig,
+	chunk *ChunkResult,
+	priv *ecdh.PrivateKey,
+	pubBase64 string,
+) error {
+	pubkeys := make([]string, len(chunk.Pubkeys))
+	for i, pk := range chunk.Pubkeys {
+		pubkeys[i] = pk.String()
+	}
+	request, err := p2pclient.NewVemRequest(pubkeys, pubBase64)
+	if err != nil {
+		return err
+	}
+	if cfg.Keys != nil {
+		if err := cfg.Keys.Save(chunk.VemID, priv); err != nil {
+			return err
+		}
+	}
+	payload, err := authorize(ctx, chunk.VemID, request)
+	if err != nil {
+		return fmt.Errorf("authorize vem %s: %w", chunk.VemID, err)
+	}
+	if cfg.BeforeCreate != nil {
+		if err := cfg.BeforeCreate(payload, chunk.Pubkeys); err != nil {
+			return err
+		}
+	}
+	if _, err := client.CreateVem(ctx, payload); err != nil {
+		return fmt.Errorf("create vem %s: %w", chunk.VemID, err)
+	}
+	return nil
+}
+
+func awaitChunk(ctx context.Context, client *p2pclient.Client, cfg BatchConfig, vemID string, priv *ecdh.PrivateKey) ([]byte, error) {
+	status, err := PollVemStatus(ctx, client, vemID, cfg.Poll, nil)
+	if err != nil {
+		return nil, err
+	}
+	return vemcrypto.DecryptVemResult(priv, status.VemResult, cfg.Suite)
+}
+
+// mergeChunk assigns each exit in chunk to the validator whose key signed it
+func mergeChunk(result *BatchResult, chunk *ChunkResult, cfg BatchConfig) {
+	fail := func(err error) {
+		for _, pk := range chunk.Pubkeys {
+			result.Validators[pk] = &ValidatorResult{VemID: chunk.VemID, Err: err}
+		}
+	}
+	if chunk.Err != nil {
+		fail(chunk.Err)
+		return
+	}
+
+	match := cfg.Import
+	if match == nil {
+		match = func(vemID string, plaintext []byte) (map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, error) {
+			return matchChunk(plaintext, chunk.Pubkeys, cfg.Network)
+		}
+	}
+	signed, err := match(chunk.VemID, chunk.Plaintext)
+	if err != nil {
+		chunk.Err = fmt.Errorf("vem %s: %w", chunk.VemID, err)
+		if signed == nil {
+			fail(chunk.Err)
+			return
+		}
+	} else if cfg.Import != nil && cfg.Keys != nil {
+		if err := cfg.Keys.Delete(chunk.VemID); err != nil {
+			chunk.Err = fmt.Errorf("vem %s: exits imported but key not deleted: %w", chunk.VemID, err)
+		}
+	}
+
+	for _, pk := range chunk.Pubkeys {
+		if exit, ok := signed[pk]; ok {
+			result.Validators[pk] = &ValidatorResult{VemID: chunk.VemID, Exit: exit}
+			continue
+		}
+		result.Validators[pk] = &ValidatorResult{
+			VemID: chunk.VemID,
+			Err:   fmt.Errorf("vem %s returned no valid exit for this validator", chunk.VemID),
+		}
+	}
+}
+
+// matchChunk verifies a decrypted chunk against the validators it asked for.
+// Exits signed by none of them are reported after the ones that matched.
+func matchChunk(plaintext []byte, pubkeys []consensus.BLSPubkey, network consensus.Network) (map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, error) {
+	exits, err := consensus.ParseSignedVoluntaryExits(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := consensus.MatchExitSigners(exits, pubkeys, network)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := make(map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, len(exits))
+	unmatched := 0
+	for i, pk := range signers {
+		if pk == nil {
+			unmatched++
+			continue
+		}
+		signed[*pk] = &exits[i]
+	}
+	if unmatched > 0 {
+		return signed, fmt.Errorf("returned %d exits signed by no requested validator", unmatched)
+	}
+	return signed, nil
+}
+
+func parsePubkeys(pubkeys []string) ([]consensus.BLSPubkey, error) {
+	if len(pubkeys) == 0 {
+		return nil, errors.New("vemflow: batch has no pubkeys")
+	}
+	parsed := make([]consensus.BLSPubkey, len(pubkeys))
+	seen := make(map[consensus.BLSPubkey]bool, len(pubkeys))
+	for i, s := range pubkeys {
+		pk, err := consensus.ParseBLSPubkey(s)
+		if err != nil {
+			return nil, fmt.Errorf("vemflow: pubkey %d: %w", i, err)
+		}
+		if seen[pk] {
+			return nil, fmt.Errorf("vemflow: pubkey %s appears twice", pk)
+		}
+		seen[pk] = true
+		parsed[i] = pk
+	}
+	return parsed, nil
+}
@@ -0,0 +1,208 @@
+package vemflow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"consensus"
+	p2pclient "p2p/client"
+	"p2p/p2ptest"
+	"p2p/vemcrypto"
+	"p2p/vemflow"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// provisioned starts a fake API and provisions n validators that withdraw to
+// a fresh key, returned with their pubkeys
+func provisioned(t *testing.T, n int) (*p2ptest.Server, vemflow.Authorizer, []string) {
+	t.Helper()
+	srv := p2ptest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.SetSteps(1)
+
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	client := srv.Client()
+	_, err := client.CreateNodeRequest(context.Background(), p2pclient.CreateNodeRequestPayload{
+		ID:                        "batch",
+		Type:                      p2pclient.NodeRequestTypeRegular,
+		ValidatorsCount:           n,
+		AmountPerValidator:        "32000000000",
+		WithdrawalCredentialsType: "0x01",
+		WithdrawalAddress:         address,
+		ControllerAddress:         address,
+		FeeRecipientAddress:       address,
+		NodesOptions:              p2pclient.NodesOptionsInput{Location: "any"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := vemflow.PollNodeRequest(context.Background(), client, "batch", fast, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkeys := make([]string, len(status.DepositData))
+	for i, d := range status.DepositData {
+		pubkeys[i] = d.Pubkey
+	}
+	return srv, vemflow.OffChainAuthorizer(key), pubkeys
+}
+
+func TestRunBatchChunksAndMergesExits(t *testing.T) {
+	srv, authorize, pubkeys := provisioned(t, 5)
+	sealer, _ := vemcrypto.PassphraseSealer("batch")
+	keys, err := vemcrypto.NewKeyStore(t.TempDir(), sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created [][]consensus.BLSPubkey
+	result, err := vemflow.RunBatch(context.Background(), srv.Client(), pubkeys, authorize, vemflow.BatchConfig{
+		Network:   consensus.Hoodi,
+		ChunkSize: 2,
+		Poll:      fast,
+		Keys:      keys,
+		BeforeCreate: func(_ p2pclient.VemCreatePayload, chunk []consensus.BLSPubkey) error {
+			created = append(created, chunk)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err != nil {
+		t.Fatalf("unexpected failures: %v", err)
+	}
+	if len(result.Chunks) != 3 || len(created) != 3 || len(created[2]) != 1 {
+		t.Fatalf("expected chunks of 2, 2 and 1, got %d chunks", len(result.Chunks))
+	}
+	if len(result.Validators) != 5 {
+		t.Fatalf("expected 5 validators, got %d", len(result.Validators))
+	}
+	for pk, v := range result.Validators {
+		index, _ := srv.ValidatorIndex(pk)
+		if v.Exit == nil || v.Exit.Message.ValidatorIndex != index || v.Exit.Verify(pk, consensus.Hoodi) != nil {
+			t.Fatalf("wrong exit for %s: %+v", pk, v.Exit)
+		}
+	}
+	// Every chunk's key was sealed, so each can be resumed
+	for _, chunk := range result.Chunks {
+		if _, err := keys.Load(chunk.VemID); err != nil {
+			t.Fatalf("key for %s: %v", chunk.VemID, err)
+		}
+	}
+}
+
+func TestRunBatchReportsPartialFailure(t *testing.T) {
+	srv, authorize, pubkeys := provisioned(t, 5)
+	// Chunks are created in order, so the first one fails
+	srv.FailNextVem(p2pclient.VemStatusError, "validator is not active")
+
+	result, err := vemflow.RunBatch(context.Background(), srv.Client(), pubkeys, authorize, vemflow.BatchConfig{
+		Network:   consensus.Hoodi,
+		ChunkSize: 2,
+		SharedKey: true,
+		Poll:      fast,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := result.Failed()
+	if len(failed) != 2 || result.Chunks[0].Err == nil || result.Chunks[1].Err != nil {
+		t.Fatalf("expected the first chunk to fail, got %v", failed)
+	}
+	for _, pk := range pubkeys[2:] {
+		parsed, _ := consensus.ParseBLSPubkey(pk)
+		if result.Validators[parsed].Exit == nil {
+			t.Fatalf("expected an exit for %s", pk)
+		}
+	}
+
+	var batchErr *vemflow.BatchError
+	var reqErr *vemflow.RequestFailedError
+	err = result.Err()
+	if !errors.As(err, &batchErr) || batchErr.Total != 5 || len(batchErr.Failed) != 2 {
+		t.Fatalf("expected a batch error for 2 of 5, got %v", err)
+	}
+	if !errors.As(err, &reqErr) || reqErr.Detail != "validator is not active" {
+		t.Fatalf("expected the VEM failure to be reachable, got %v", err)
+	}
+}
+
+func TestRunBatchRejectsDuplicates(t *testing.T) {
+	srv, authorize, pubkeys := provisioned(t, 1)
+	_, err := vemflow.RunBatch(context.Background(), srv.Client(), []string{pubkeys[0], pubkeys[0]}, authorize,
+		vemflow.BatchConfig{Network: consensus.Hoodi, Poll: fast})
+	if err == nil {
+		t.Fatal("expected a duplicate pubkey to be rejected")
+	}
+}
+
+func TestRunBatchImportFailsChunk(t *testing.T) {
+	srv, authorize, pubkeys := provisioned(t, 4)
+	sealer, _ := vemcrypto.PassphraseSealer("batch")
+	keys, err := vemcrypto.NewKeyStore(t.TempDir(), sealer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var imported []string
+	result, err := vemflow.RunBatch(context.Background(), srv.Client(), pubkeys, authorize, vemflow.BatchConfig{
+		Network:   consensus.Hoodi,
+		ChunkSize: 2,
+		Poll:      fast,
+		Keys:      keys,
+		Import: func(vemID string, plaintext []byte) (map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit, error) {
+			imported = append(imported, vemID)
+			if len(imported) == 1 {
+				return nil, errors.New("escrow refused")
+			}
+			exits, err := consensus.ParseSignedVoluntaryExits(plaintext)
+			if err != nil {
+				return nil, err
+			}
+			signed := make(map[consensus.BLSPubkey]*consensus.SignedVoluntaryExit)
+			for i := range exits {
+				for _, pk := range pubkeys {
+					parsed, _ := consensus.ParseBLSPubkey(pk)
+					if index, _ := srv.ValidatorIndex(parsed); index == exits[i].Message.ValidatorIndex {
+						signed[parsed] = &exits[i]
+					}
+				}
+			}
+			return signed, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("expected one import per chunk, got %v", imported)
+	}
+	if failed := result.Failed(); len(failed) != 2 || result.Chunks[0].Err == nil || result.Chunks[1].Err != nil {
+		t.Fatalf("expected the refused chunk to fail, got %v", failed)
+	}
+	// Only the refused chunk keeps its key for a later resume
+	if ids, _ := keys.List(); len(ids) != 1 || ids[0] != imported[0] {
+		t.Fatalf("expected only the key for %s left, got %v", imported[0], ids)
+	}
+}
+
+func TestRunBatchRejectsDowngradedSuite(t *testing.T) {
+	srv, authorize, pubkeys := provisioned(t, 2)
+	srv.SetSuite(vemcrypto.SuiteP256SHA256AESGCM)
+
+	result, err := vemflow.RunBatch(context.Background(), srv.Client(), pubkeys, authorize, vemflow.BatchConfig{
+		Network: consensus.Hoodi,
+		Suite:   vemcrypto.SuiteP256HKDFSHA256AESGCM,
+		Poll:    fast,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); !errors.Is(err, vemcrypto.ErrSuiteMismatch) {
+		t.Fatalf("expected the legacy result to be refused, got %v", err)
+	}
+}
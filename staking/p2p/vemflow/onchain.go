@@ -0,0 +1,164 @@
+package vemflow
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	p2pclient "p2p/client"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ChainBackend is the part of an execution client the on-chain VEM flow
+// needs; ethclient.Client and the simulated backend both satisfy it
+type ChainBackend interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// TxSigner signs a transaction as the withdrawal address, typically by
+// handing it to a custody provider
+type TxSigner func(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+
+// KeySigner signs with a local withdrawal address key
+func KeySigner(key *ecdsa.PrivateKey) TxSigner {
+	return func(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	}
+}
+
+// BuildVemTransaction returns an unsigned zero-value transaction from the
+// withdrawal address to itself whose calldata is the canonical VEM request
+func BuildVemTransaction(
+	ctx context.Context,
+	backend ChainBackend,
+	from common.Address,
+	request *p2pclient.VemRequest,
+) (*types.Transaction, *big.Int, error) {
+	data, err := request.Canonical()
+	if err != nil {
+		return nil, nil, err
+	}
+	chainID, err := backend.ChainID(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chain id: %w", err)
+	}
+	nonce, err := backend.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("nonce: %w", err)
+	}
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("latest header: %w", err)
+	}
+	gas, err := backend.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &from, Data: []byte(data)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("estimate gas: %w", err)
+	}
+
+	// Chains without EIP-1559 have no base fee and take legacy transactions
+	if head.BaseFee == nil {
+		price, err := backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gas price: %w", err)
+		}
+		tx := types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: price,
+			Gas:      gas,
+			To:       &from,
+			Data:     []byte(data),
+		})
+		return tx, chainID, nil
+	}
+	tip, err := backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gas tip: %w", err)
+	}
+
+	// Leave room for the base fee to double before the transaction lands
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        &from,
+		Data:      []byte(data),
+	})
+	return tx, chainID, nil
+}
+
+// SubmitOnChainVem builds, signs and broadcasts the VEM transaction and waits
+// for it to be mined. It returns the create payload carrying the transaction
+// hash and proof.
+func SubmitOnChainVem(
+	ctx context.Context,
+	backend ChainBackend,
+	sign TxSigner,
+	from common.Address,
+	vemID string,
+	request *p2pclient.VemRequest,
+) (p2pclient.VemCreatePayload, error) {
+	tx, chainID, err := BuildVemTransaction(ctx, backend, from, request)
+	if err != nil {
+		return p2pclient.VemCreatePayload{}, err
+	}
+	signed, err := sign(tx, chainID)
+	if err != nil {
+		return p2pclient.VemCreatePayload{}, fmt.Errorf("sign vem transaction: %w", err)
+	}
+
+	// Verify before broadcasting so a wrong signer never costs gas
+	payload, err := p2pclient.NewOnChainVemPayload(vemID, request, signed)
+	if err != nil {
+		return p2pclient.VemCreatePayload{}, err
+	}
+	if payload.VemRequestSignedBy != from.Hex() {
+		return p2pclient.VemCreatePayload{}, fmt.Errorf("%w: transaction signed by %s, expected %s",
+			p2pclient.ErrSignerMismatch, payload.VemRequestSignedBy, from.Hex())
+	}
+
+	if err := backend.SendTransaction(ctx, signed); err != nil {
+		return p2pclient.VemCreatePayload{}, fmt.Errorf("send vem transaction: %w", err)
+	}
+	if _, err := WaitMined(ctx, backend, signed.Hash()); err != nil {
+		return p2pclient.VemCreatePayload{}, err
+	}
+	return payload, nil
+}
+
+// WaitMined polls for the receipt of txHash and fails if it reverted. Lookup
+// errors are retried, as nodes report "not found" and "indexing in progress"
+// while the transaction is pending.
+func WaitMined(ctx context.Context, backend ChainBackend, txHash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := backend.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return nil, fmt.Errorf("vem transaction %s reverted", txHash)
+			}
+			return receipt, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for vem transaction %s: %w (last error: %v)", txHash, ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
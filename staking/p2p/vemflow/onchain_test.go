@@ -0,0 +1,189 @@
+package vemflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	p2pclient "p2p/client"
+	"p2p/vemcrypto"
+	"p2p/vemflow"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+const signedExit = `{"message":{"epoch":"1000","validator_index":"42"},"signature":"0x00"}`
+
+// fakeVemAPI accepts VEM creates that pass payload verification and answers
+// status with signedExit encrypted to the request's ECDH key
+type fakeVemAPI struct {
+	mu       sync.Mutex
+	payloads map[string]p2pclient.VemCreatePayload
+}
+
+func (f *fakeVemAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/vem/create"):
+		var p p2pclient.VemCreatePayload
+		json.NewDecoder(r.Body).Decode(&p)
+		if err := p.Verify(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": err.Error()}})
+			return
+		}
+		f.payloads[p.ID] = p
+		json.NewEncoder(w).Encode(map[string]any{"result": p2pclient.VemStatus{ID: p.ID, Status: p2pclient.VemStatusPending}})
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/vem/status/"):
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		p, ok := f.payloads[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req, _ := p2pclient.ParseVemRequest(p.VemRequest)
+		recipient, err := vemcrypto.ParseECDHPublicKey(req.ECDHClientPubkey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		result, err := vemcrypto.EncryptVemResult(recipient, vemcrypto.SuiteP256SHA256AESGCM, []byte(signedExit), nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": p2pclient.VemStatus{ID: id, Status: p2pclient.VemStatusSuccess, VemResult: result}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOnChainVemFlow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	withdrawalKey, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(withdrawalKey.PublicKey)
+	chain := simulated.NewBackend(types.GenesisAlloc{
+		from: {Balance: new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))},
+	})
+	defer chain.Close()
+
+	// Mine continuously until the flow is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+				chain.Commit()
+			}
+		}
+	}()
+
+	srv := httptest.NewServer(&fakeVemAPI{payloads: make(map[string]p2pclient.VemCreatePayload)})
+	defer srv.Close()
+	client := p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+
+	ecdhPriv, ecdhPub, err := vemcrypto.GenerateECDHKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := p2pclient.NewVemRequest([]string{"0x" + strings.Repeat("b2", 48)}, ecdhPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := vemflow.SubmitOnChainVem(ctx, chain.Client(), vemflow.KeySigner(withdrawalKey), from, "vem-onchain", request)
+	if err != nil {
+		t.Fatalf("submit on-chain vem: %v", err)
+	}
+	if payload.Type != p2pclient.VemTypeOnChain || payload.VemRequestTxId == "" || payload.VemRequestProof == "" {
+		t.Fatalf("incomplete payload %+v", payload)
+	}
+	receipt, err := chain.Client().TransactionReceipt(ctx, common.HexToHash(payload.VemRequestTxId))
+	if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("vem transaction not mined: %v", err)
+	}
+
+	if _, err := client.CreateVem(ctx, payload); err != nil {
+		t.Fatalf("create vem: %v", err)
+	}
+	status, err := client.GetVemStatus(ctx, "vem-onchain")
+	if err != nil {
+		t.Fatalf("vem status: %v", err)
+	}
+	plaintext, err := vemcrypto.DecryptVemResult(ecdhPriv, status.VemResult, "")
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if string(plaintext) != signedExit {
+		t.Fatalf("unexpected exit message %s", plaintext)
+	}
+}
+
+func TestOnChainVemRejectsForeignSigner(t *testing.T) {
+	ctx := context.Background()
+	withdrawalKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(withdrawalKey.PublicKey)
+	chain := simulated.NewBackend(types.GenesisAlloc{
+		from: {Balance: big.NewInt(1e18)},
+	})
+	defer chain.Close()
+
+	_, ecdhPub, _ := vemcrypto.GenerateECDHKeypair()
+	request, _ := p2pclient.NewVemRequest([]string{"0x" + strings.Repeat("b2", 48)}, ecdhPub)
+
+	_, err := vemflow.SubmitOnChainVem(ctx, chain.Client(), vemflow.KeySigner(otherKey), from, "vem-1", request)
+	if err == nil {
+		t.Fatalf("expected a transaction signed by another key to be rejected")
+	}
+}
+
+// preLondon is a chain without EIP-1559: its headers carry no base fee
+type preLondon struct{ vemflow.ChainBackend }
+
+func (c preLondon) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	head, err := c.ChainBackend.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	head = types.CopyHeader(head)
+	head.BaseFee = nil
+	return head, nil
+}
+
+func TestBuildVemTransactionWithoutBaseFee(t *testing.T) {
+	ctx := context.Background()
+	withdrawalKey, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(withdrawalKey.PublicKey)
+	chain := simulated.NewBackend(types.GenesisAlloc{
+		from: {Balance: big.NewInt(1e18)},
+	})
+	defer chain.Close()
+
+	_, ecdhPub, _ := vemcrypto.GenerateECDHKeypair()
+	request, _ := p2pclient.NewVemRequest([]string{"0x" + strings.Repeat("b2", 48)}, ecdhPub)
+
+	tx, _, err := vemflow.BuildVemTransaction(ctx, preLondon{chain.Client()}, from, request)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if tx.Type() != types.LegacyTxType || tx.GasPrice().Sign() <= 0 {
+		t.Fatalf("expected a priced legacy transaction, got type %d at %s", tx.Type(), tx.GasPrice())
+	}
+}
@@ -2,47 +2,107 @@ package vemflow
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	p2pclient "p2p/client"
-	"time"
+	"p2p/poll"
 )
 
-type VemStatusResponse struct {
-	Status    string `json:"status"`
-	VemResult string `json:"vemResult"`
+// RequestFailedError reports a VEM or node request that P2P moved to a
+// failure state
+type RequestFailedError struct {
+	// Kind is "vem" or "node request"
+	Kind   string
+	ID     string
+	Status string
+	// Detail is the server's explanation, when it gave one
+	Detail string
 }
 
+func (e *RequestFailedError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s %s ended with status %s", e.Kind, e.ID, e.Status)
+	}
+	return fmt.Sprintf("%s %s ended with status %s: %s", e.Kind, e.ID, e.Status, e.Detail)
+}
+
+// PollVemResult waits with default backoff for requestID to succeed and
+// returns its encrypted result
 func PollVemResult(
 	ctx context.Context,
-	client *http.Client,
-	token string,
+	client *p2pclient.Client,
 	requestID string,
 ) (string, error) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	status, err := PollVemStatus(ctx, client, requestID, poll.Config{}, nil)
+	if err != nil {
+		return "", err
+	}
+	return status.VemResult, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-ticker.C:
-			req, _ := p2pclient.NewVemStatusRequest(ctx, requestID, token)
-			body, _, err := p2pclient.DoRequest(client, req)
-			if err != nil {
-				return "", err
+// PollVemStatus polls a VEM request until it succeeds. An error or fault
+// status is returned as a *RequestFailedError.
+func PollVemStatus(
+	ctx context.Context,
+	client *p2pclient.Client,
+	requestID string,
+	cfg poll.Config,
+	onProgress func(poll.Progress[*p2pclient.VemStatus]),
+) (*p2pclient.VemStatus, error) {
+	return poll.Until(ctx, cfg, func(ctx context.Context) (*p2pclient.VemStatus, bool, error) {
+		status, err := client.GetVemStatus(ctx, requestID)
+		if err != nil {
+			return nil, false, classify(err)
+		}
+		switch status.Status {
+		case p2pclient.VemStatusSuccess:
+			if status.VemResult == "" {
+				return status, false, poll.Permanent(fmt.Errorf("vem %s succeeded without a result", requestID))
 			}
+			return status, true, nil
+		case p2pclient.VemStatusError, p2pclient.VemStatusFault:
+			return status, false, poll.Permanent(&RequestFailedError{
+				Kind: "vem", ID: requestID, Status: status.Status, Detail: status.ErrorMessage,
+			})
+		}
+		return status, false, nil
+	}, onProgress)
+}
 
-			var resp VemStatusResponse
-			_ = json.Unmarshal(body, &resp)
-
-			switch resp.Status {
-			case "success":
-				return resp.VemResult, nil
-			case "error", "fault":
-				return "", errors.New("vem request failed")
-			}
+// PollNodeRequest polls a node request until it is ready. A cancelled
+// request is returned as a *RequestFailedError.
+func PollNodeRequest(
+	ctx context.Context,
+	client *p2pclient.Client,
+	nodeRequestID string,
+	cfg poll.Config,
+	onProgress func(poll.Progress[*p2pclient.NodeRequestStatus]),
+) (*p2pclient.NodeRequestStatus, error) {
+	return poll.Until(ctx, cfg, func(ctx context.Context) (*p2pclient.NodeRequestStatus, bool, error) {
+		status, err := client.GetNodeRequestStatus(ctx, nodeRequestID)
+		if err != nil {
+			return nil, false, classify(err)
+		}
+		switch status.Status {
+		case p2pclient.NodeRequestReady:
+			return status, true, nil
+		case p2pclient.NodeRequestCancelled:
+			return status, false, poll.Permanent(&RequestFailedError{
+				Kind: "node request", ID: nodeRequestID, Status: status.Status, Detail: status.ErrorMessage,
+			})
 		}
+		return status, false, nil
+	}, onProgress)
+}
+
+// classify marks client errors other than timeouts and rate limits as
+// permanent; server errors and transport failures are retried
+func classify(err error) error {
+	var apiErr *p2pclient.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusRequestTimeout && apiErr.StatusCode != http.StatusTooManyRequests {
+		return poll.Permanent(err)
 	}
+	return err
 }
@@ -0,0 +1,90 @@
+package vemflow_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	p2pclient "p2p/client"
+	"p2p/poll"
+	"p2p/vemflow"
+)
+
+var fast = poll.Config{Initial: time.Millisecond, Max: time.Millisecond, MaxAttempts: 10}
+
+// statusServer answers successive status calls with the given bodies, then
+// repeats the last one
+func statusServer(t *testing.T, codes []int, bodies []string) *p2pclient.Client {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := min(int(n.Add(1))-1, len(bodies)-1)
+		w.WriteHeader(codes[i])
+		w.Write([]byte(bodies[i]))
+	}))
+	t.Cleanup(srv.Close)
+	return p2pclient.NewClient(srv.URL, p2pclient.StaticToken("tok"))
+}
+
+func TestPollVemStatusRetriesThenSucceeds(t *testing.T) {
+	client := statusServer(t,
+		[]int{503, 200, 200},
+		[]string{
+			`upstream unavailable`,
+			`{"result":{"id":"vem-1","status":"pending"}}`,
+			`{"result":{"id":"vem-1","status":"success","vemResult":"ciphertext"}}`,
+		})
+
+	var attempts int
+	status, err := vemflow.PollVemStatus(context.Background(), client, "vem-1", fast,
+		func(p poll.Progress[*p2pclient.VemStatus]) { attempts = p.Attempt })
+	if err != nil || status.VemResult != "ciphertext" {
+		t.Fatalf("unexpected result %+v: %v", status, err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestPollVemStatusReportsServerFailure(t *testing.T) {
+	client := statusServer(t, []int{200},
+		[]string{`{"result":{"id":"vem-1","status":"fault","errorMessage":"validator already exited"}}`})
+
+	_, err := vemflow.PollVemStatus(context.Background(), client, "vem-1", fast, nil)
+	var failed *vemflow.RequestFailedError
+	if !errors.As(err, &failed) || failed.Status != "fault" || failed.Detail != "validator already exited" {
+		t.Fatalf("expected typed failure with detail, got %v", err)
+	}
+}
+
+func TestPollNodeRequestStopsOnClientError(t *testing.T) {
+	client := statusServer(t, []int{404},
+		[]string{`{"error":{"code":404,"name":"NotFound","message":"no such node request"}}`})
+
+	_, err := vemflow.PollNodeRequest(context.Background(), client, "req-1", fast, nil)
+	var apiErr *p2pclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "no such node request" {
+		t.Fatalf("expected the API error, got %v", err)
+	}
+	var exhausted *poll.ExhaustedError
+	if errors.As(err, &exhausted) {
+		t.Fatalf("a 404 should not be retried")
+	}
+}
+
+func TestPollNodeRequestReady(t *testing.T) {
+	client := statusServer(t, []int{200, 200},
+		[]string{
+			`{"result":{"id":"req-1","status":"processing"}}`,
+			`{"result":{"id":"req-1","status":"ready","validatorsCount":2}}`,
+		})
+
+	req, err := vemflow.PollNodeRequest(context.Background(), client, "req-1", fast, nil)
+	if err != nil || req.Status != p2pclient.NodeRequestReady {
+		t.Fatalf("unexpected node request %+v: %v", req, err)
+	}
+}